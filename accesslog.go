@@ -0,0 +1,142 @@
+package nhe
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+var defaultScrubParams = []string{
+	"token",
+	"key",
+	"secret",
+	"password",
+	"auth",
+	"signature",
+	"session",
+}
+
+type accessLogConfig struct {
+	sampleAfter int
+	sampleRate  float64
+	scrub       []string
+}
+
+type accessLog struct {
+	cfg    accessLogConfig
+	rand   func() float64
+	mu     sync.Mutex
+	window time.Time
+	count  int
+}
+
+func newAccessLog(cfg accessLogConfig) *accessLog {
+	return &accessLog{cfg: cfg, rand: rand.Float64}
+}
+
+func (l *accessLog) sampled(now time.Time) bool {
+	if l.cfg.sampleAfter <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if second := now.Truncate(time.Second); !second.Equal(l.window) {
+		l.window, l.count = second, 0
+	}
+	l.count++
+
+	if l.count <= l.cfg.sampleAfter {
+		return true
+	}
+	return l.rand() < l.cfg.sampleRate
+}
+
+func (l *accessLog) sensitive(param string) bool {
+	param = strings.ToLower(param)
+	for _, s := range l.cfg.scrub {
+		if strings.Contains(param, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *accessLog) scrubQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+
+	clean := url.Values{}
+	for k, vs := range q {
+		if !l.sensitive(k) {
+			clean[k] = vs
+			continue
+		}
+		for range vs {
+			clean.Add(k, redacted)
+		}
+	}
+	return clean.Encode()
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func withAccessLog(next http.Handler, l *accessLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		if sw.status < 500 && !l.sampled(start) {
+			return
+		}
+
+		slog.Info(
+			"request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"query", l.scrubQuery(r.URL.Query()),
+			"status", sw.status,
+			"bytes", sw.bytes,
+			"duration", time.Since(start),
+			"client", clientAddr(r),
+		)
+	})
+}
@@ -0,0 +1,76 @@
+package nhe
+
+import (
+	"fmt"
+	"math"
+)
+
+type YearBasis string
+
+const (
+	CalendarYears YearBasis = "calendar"
+	FiscalYears   YearBasis = "fiscal"
+)
+
+func parseBasis(s string) (YearBasis, error) {
+	switch YearBasis(s) {
+	case "", CalendarYears:
+		return CalendarYears, nil
+	case FiscalYears:
+		return FiscalYears, nil
+	}
+	return "", fmt.Errorf("unknown year basis %q", s)
+}
+
+func (b YearBasis) Label(year int) string {
+	if b == FiscalYears {
+		return fmt.Sprintf("FY%d", year)
+	}
+	return fmt.Sprintf("%d", year)
+}
+
+func fiscalYears(years []int) []int {
+	var fy []int
+	for i := 1; i < len(years); i++ {
+		if years[i-1] == years[i]-1 {
+			fy = append(fy, years[i])
+		}
+	}
+	return fy
+}
+
+func toFiscal(years []int, values []*int) []*int {
+	var fy []*int
+	for i := 1; i < len(years); i++ {
+		if years[i-1] != years[i]-1 {
+			continue
+		}
+
+		prev, cur := values[i-1], values[i]
+		if prev == nil || cur == nil {
+			fy = append(fy, nil)
+			continue
+		}
+
+		amount := int(math.Round(
+			fiscalPriorWeight*float64(*prev) +
+				fiscalCurrentWeight*float64(*cur),
+		))
+		fy = append(fy, &amount)
+	}
+	return fy
+}
+
+func basisYears(basis YearBasis, years []int) []int {
+	if basis != FiscalYears {
+		return years
+	}
+	return fiscalYears(years)
+}
+
+func basisValues(basis YearBasis, years []int, values []*int) []*int {
+	if basis != FiscalYears {
+		return values
+	}
+	return toFiscal(years, values)
+}
@@ -0,0 +1,240 @@
+package nhe
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+type Annotation struct {
+	Category  string `json:"category"`
+	Year      int    `json:"year"`
+	Note      string `json:"note"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type TableNote struct {
+	Number   int    `json:"number"`
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Year     int    `json:"year"`
+	Note     string `json:"note"`
+}
+
+type annotationKey struct {
+	category string
+	year     int
+}
+
+func listAnnotations(db *sql.DB) ([]Annotation, error) {
+	if !capsOf(db).has("annotations", "") {
+		return []Annotation{}, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT category, year, note, updated_at
+		FROM annotations
+		ORDER BY category, year
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []Annotation{}
+	for rows.Next() {
+		var a Annotation
+		err := rows.Scan(&a.Category, &a.Year, &a.Note, &a.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, a)
+	}
+	return notes, rows.Err()
+}
+
+func annotationIndex(db *sql.DB) (map[annotationKey]string, error) {
+	notes, err := listAnnotations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[annotationKey]string, len(notes))
+	for _, a := range notes {
+		index[annotationKey{a.Category, a.Year}] = a.Note
+	}
+	return index, nil
+}
+
+func saveAnnotation(db *sql.DB, a Annotation) error {
+	refs, err := categoryRefs(db)
+	if err != nil {
+		return err
+	}
+	if _, ok := findCategoryRef(refs, a.Category); !ok {
+		return badQuery("unknown category %q", a.Category)
+	}
+
+	var exists bool
+	err = db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM years WHERE year = ?)",
+		a.Year,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return badQuery("no data for year %d", a.Year)
+	}
+
+	note := strings.TrimSpace(a.Note)
+	if note == "" {
+		_, err := db.Exec(
+			"DELETE FROM annotations WHERE category = ? AND year = ?",
+			a.Category,
+			a.Year,
+		)
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO annotations (category, year, note) VALUES (?, ?, ?)
+		ON CONFLICT (category, year) DO UPDATE SET
+			note = excluded.note,
+			updated_at = CURRENT_TIMESTAMP
+	`, a.Category, a.Year, note)
+	return err
+}
+
+func annotateTable(
+	data *TableData,
+	index map[annotationKey]string,
+) *TableData {
+	if len(index) == 0 || data.Basis == FiscalYears {
+		return data
+	}
+
+	annotated := *data
+	annotated.Notes = nil
+	annotated.Categories = slices.Clone(data.Categories)
+	for i := range annotated.Categories {
+		cat := &annotated.Categories[i]
+		cat.Notes = nil
+		for _, year := range annotated.Years {
+			note, ok := index[annotationKey{cat.Slug, year}]
+			if !ok {
+				continue
+			}
+
+			tn := &TableNote{
+				Number:   len(annotated.Notes) + 1,
+				Category: cat.Slug,
+				Name:     cat.Name,
+				Year:     year,
+				Note:     note,
+			}
+			if cat.Notes == nil {
+				cat.Notes = map[int]*TableNote{}
+			}
+			cat.Notes[year] = tn
+			annotated.Notes = append(annotated.Notes, *tn)
+		}
+	}
+	return &annotated
+}
+
+func annotatedTable(db *sql.DB, data *TableData) (*TableData, error) {
+	index, err := annotationIndex(db)
+	if err != nil {
+		return nil, err
+	}
+	return annotateTable(data, index), nil
+}
+
+func annotationsHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notes, err := listAnnotations(app.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, r, notes)
+	}
+}
+
+func saveAnnotationHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		year, err := strconv.Atoi(r.PostForm.Get("year"))
+		if err != nil {
+			http.Error(w, "invalid year", http.StatusBadRequest)
+			return
+		}
+
+		err = saveAnnotation(app.db, Annotation{
+			Category: r.PostForm.Get("category"),
+			Year:     year,
+			Note:     r.PostForm.Get("note"),
+		})
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		w.Header().Set("Location", app.url("/"))
+		w.WriteHeader(http.StatusSeeOther)
+	}
+}
+
+func annotationsCommand(app *App) *cli.Command {
+	return &cli.Command{
+		Name:  "annotations",
+		Usage: "manage notes attached to category/year cells",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "set",
+				Usage:     "attach a note to a cell; an empty note removes it",
+				ArgsUsage: "CATEGORY-SLUG YEAR NOTE",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 3 {
+						return fmt.Errorf(
+							"annotations set needs CATEGORY-SLUG, YEAR, and NOTE",
+						)
+					}
+					year, err := strconv.Atoi(c.Args().Get(1))
+					if err != nil {
+						return badQuery("invalid year %q", c.Args().Get(1))
+					}
+					return saveAnnotation(app.db, Annotation{
+						Category: c.Args().Get(0),
+						Year:     year,
+						Note:     c.Args().Get(2),
+					})
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "list notes",
+				Action: func(c *cli.Context) error {
+					notes, err := listAnnotations(app.db)
+					if err != nil {
+						return err
+					}
+					for _, a := range notes {
+						fmt.Printf("%s\t%d\t%s\n", a.Category, a.Year, a.Note)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,893 @@
+package nhe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+type Dataset struct {
+	Version  string `json:"version"`
+	Source   string `json:"source"`
+	LoadedAt string `json:"loaded_at"`
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	if fields := parseFields(r.URL.Query().Get("fields")); fields != nil {
+		projected, err := projectFields(v, fields)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		v = projected
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("encode JSON response", "error", err)
+	}
+}
+
+func wantSQL(app *App, r *http.Request) bool {
+	return app.debugSQL && r.URL.Query().Get("debug") == "sql"
+}
+
+func currentVersion(db *sql.DB) (string, error) {
+	var version string
+	err := db.QueryRow(
+		"SELECT version FROM loads ORDER BY id DESC LIMIT 1",
+	).Scan(&version)
+	return version, err
+}
+
+func versionAsOf(db *sql.DB, t time.Time) (string, error) {
+	var version string
+	err := db.QueryRow(`
+		SELECT version
+		FROM loads
+		WHERE loaded_at <= ?
+		ORDER BY loaded_at DESC, id DESC
+		LIMIT 1
+	`, t.UTC().Format(time.DateTime)).Scan(&version)
+	return version, err
+}
+
+func listDatasets(db *sql.DB) ([]Dataset, error) {
+	rows, err := db.Query(`
+		SELECT version, source, loaded_at
+		FROM loads
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	datasets := []Dataset{}
+	for rows.Next() {
+		var d Dataset
+		if err := rows.Scan(&d.Version, &d.Source, &d.LoadedAt); err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, d)
+	}
+	return datasets, rows.Err()
+}
+
+func openVersion(app *App, version string) (*sql.DB, error) {
+	current, err := currentVersion(app.db)
+	if err != nil {
+		return nil, err
+	}
+	if version == current {
+		return app.db, nil
+	}
+
+	if app.dbPath == "" {
+		return nil, os.ErrNotExist
+	}
+
+	path := backupPath(app.dbPath)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	retained, err := currentVersion(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if retained != version {
+		db.Close()
+		return nil, os.ErrNotExist
+	}
+
+	return db, nil
+}
+
+func closeVersion(db *sql.DB) {
+	forgetCaps(db)
+	db.Close()
+}
+
+func tableData(
+	ctx context.Context,
+	app *App,
+	db *sql.DB,
+	view TableView,
+	opts QueryOptions,
+) (*TableData, error) {
+	if db == app.db {
+		return cachedTableData(ctx, app, view, opts)
+	}
+	return nheData(db, view, opts)
+}
+
+func readTable(
+	app *App,
+	r *http.Request,
+) (*TableData, []SQLStatement, error) {
+	view, err := tableView(app, r.URL.Query())
+	if err != nil {
+		return nil, nil, badQuery("%v", err)
+	}
+
+	opts, err := requestQueryOptions(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, done, err := datasetDB(app, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+
+	data, err := tableData(r.Context(), app, db, view, opts)
+	if err != nil || !wantSQL(app, r) {
+		return data, nil, err
+	}
+
+	stmts, err := tableSQL(db, opts)
+	return data, stmts, err
+}
+
+type datasetHandlerFunc func(
+	w http.ResponseWriter,
+	r *http.Request,
+	db *sql.DB,
+) error
+
+func datasetHandler(app *App, fn datasetHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		version := r.PathValue("version")
+
+		if version == "latest" {
+			current, err := currentVersion(app.db)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			target := strings.Replace(
+				r.URL.Path,
+				"/latest/",
+				"/"+current+"/",
+				1,
+			)
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, app.url(target), http.StatusFound)
+			return
+		}
+
+		db, err := openVersion(app, version)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, sql.ErrNoRows) {
+			http.Error(
+				w,
+				fmt.Sprintf("dataset %s not retained", version),
+				http.StatusNotFound,
+			)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if db != app.db {
+			defer closeVersion(db)
+		}
+
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Cache-Control", immutableCacheControl)
+		w.Header().Set("ETag", etag)
+
+		if err := fn(w, r, db); err != nil {
+			w.Header().Del("Cache-Control")
+			w.Header().Del("ETag")
+			writeReadError(w, err)
+		}
+	}
+}
+
+func apiV1Routes(app *App) []Route {
+	return []Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/table",
+			Summary: "Expenditure table as JSON",
+			Params: slices.Concat(tableViewParams, []RouteParam{
+				{
+					Name:        "page",
+					In:          "query",
+					Type:        "integer",
+					Description: "Page of years, as on the HTML table",
+				},
+			}, queryOptionParams),
+			Response: TableData{},
+			Handler:  apiTableHandler(app),
+			Auth:     AuthPublic,
+			Cache:    CacheRevalidate,
+			Rate:     RateStandard,
+			Stale:    viewStaleness,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/categories",
+			Summary: "Categories in sort order, one page at a time",
+			Params: []RouteParam{
+				{
+					Name:        "limit",
+					In:          "query",
+					Type:        "integer",
+					Description: "Categories per page (default 50, max 500)",
+				},
+				{
+					Name:        "offset",
+					In:          "query",
+					Type:        "integer",
+					Description: "Categories to skip; use next_offset",
+				},
+				{
+					Name:        "parent_id",
+					In:          "query",
+					Type:        "string",
+					Description: "Only children of this id, or null for roots",
+				},
+				{
+					Name:        "is_major_heading",
+					In:          "query",
+					Type:        "boolean",
+					Description: "Only major headings (true) or others (false)",
+				},
+				{
+					Name:        "first_year",
+					In:          "query",
+					Type:        "string",
+					Description: "First data year: 1966, 1990-, -1970, or 1960-1980",
+				},
+			},
+			Response: CategoryPage{},
+			Handler:  categoriesHandler(app),
+			Auth:     AuthPublic,
+			Cache:    CacheRevalidate,
+			Rate:     RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/categories/{id}/series",
+			Summary: "Year-by-year series for one category",
+			Params: append([]RouteParam{
+				{
+					Name:        "id",
+					In:          "path",
+					Type:        "integer",
+					Description: "Category id",
+				},
+				shapeParam,
+			}, queryOptionParams...),
+			Response: CategorySeries{},
+			Handler:  categorySeriesHandler(app),
+			Auth:     AuthPublic,
+			Cache:    CacheRevalidate,
+			Rate:     RateStandard,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/query",
+			Summary:  "Several categories by slug, name, or id in one call",
+			Request:  QueryRequest{},
+			Response: QueryResponse{},
+			Handler:  queryHandler(app),
+			Auth:     AuthPublic,
+			Cache:    CacheNoStore,
+			Rate:     RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/regimes",
+			Summary: "Average growth by category across regime periods",
+			Params: []RouteParam{
+				{
+					Name:        "periods",
+					In:          "query",
+					Type:        "string",
+					Description: "Comma-separated [label=]FROM-TO periods",
+				},
+				{
+					Name:        "category",
+					In:          "query",
+					Type:        "string",
+					Description: "Category slug or name; repeat for several (default all)",
+				},
+			},
+			Response: RegimeReport{},
+			Handler:  regimesHandler(app),
+			Auth:     AuthPublic,
+			Cache:    CacheRevalidate,
+			Rate:     RateStandard,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/annotations",
+			Summary:  "Notes attached to category/year cells",
+			Response: []Annotation{},
+			Handler:  annotationsHandler(app),
+			Auth:     AuthPublic,
+			Cache:    CacheRevalidate,
+			Rate:     RateStandard,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/datasets",
+			Summary:  "Retained dataset versions",
+			Response: []Dataset{},
+			Handler:  datasetsHandler(app),
+			Auth:     AuthPublic,
+			Cache:    CacheRevalidate,
+			Rate:     RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/datasets/{version}/table",
+			Summary: "Expenditure table for one dataset version",
+			Params: append([]RouteParam{
+				{
+					Name:        "version",
+					In:          "path",
+					Type:        "string",
+					Description: "Dataset version, or latest",
+				},
+			}, slices.Concat(tableViewParams, queryOptionParams)...),
+			Response: TableData{},
+			Handler:  datasetHandler(app, datasetTableHandler(app)),
+			Auth:     AuthPublic,
+			Cache:    CacheImmutable,
+			Rate:     RateStandard,
+		},
+	}
+}
+
+func apiPageYears(data *TableData, r *http.Request) *TableData {
+	perPage := max(1, len(data.Years))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page > 0 {
+		perPage = yearsPerPage
+	}
+	return pageYears(data, page, perPage)
+}
+
+func writeTable(
+	w http.ResponseWriter,
+	r *http.Request,
+	format string,
+	data *TableData,
+) {
+	if format != mimeCSV {
+		writeJSON(w, r, data)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	if err := writeTableCSV(w, data); err != nil {
+		slog.Error("write table CSV", "error", err)
+	}
+}
+
+func apiTableHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := negotiated(w, r, mimeJSON, mimeCSV)
+		if !ok {
+			return
+		}
+
+		start := time.Now()
+		data, stmts, err := readTable(app, r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		notes, err := annotationIndex(app.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		data = annotateTable(apiPageYears(data, r), notes)
+		data.SQL = stmts
+
+		writeTable(w, r, format, data)
+	}
+}
+
+func datasetsHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		datasets, err := listDatasets(app.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, r, datasets)
+	}
+}
+
+func datasetTableHandler(app *App) datasetHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, db *sql.DB) error {
+		view, err := tableView(app, r.URL.Query())
+		if err != nil {
+			return err
+		}
+
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		data, err := tableData(r.Context(), app, db, view, opts)
+		if err != nil {
+			return err
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		official := *data
+		official.Categories = slices.DeleteFunc(
+			slices.Clone(data.Categories),
+			func(c TableCategory) bool { return c.User },
+		)
+		data = &official
+
+		if wantSQL(app, r) {
+			withSQL := *data
+			if withSQL.SQL, err = tableSQL(db, opts); err != nil {
+				return err
+			}
+			data = &withSQL
+		}
+
+		writeJSON(w, r, data)
+		return nil
+	}
+}
+
+type SeriesPoint struct {
+	Year   int        `json:"year"`
+	Amount *int       `json:"amount"`
+	Status CellStatus `json:"status"`
+	Value  *float64   `json:"value,omitempty"`
+}
+
+type CategorySeries struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	ParentID    *int          `json:"parent_id"`
+	Units       string        `json:"units"`
+	Scale       int64         `json:"scale"`
+	Metric      string        `json:"metric,omitempty"`
+	FirstYear   *int          `json:"first_year"`
+	Series      []SeriesPoint `json:"series"`
+	Derivations []Derivation  `json:"derivations,omitempty"`
+}
+
+const firstYearSQL = `(
+	SELECT MIN(fy.year)
+	FROM expenditures fe
+	JOIN years fy ON fy.id = fe.year_id
+	WHERE fe.category_id = c.id AND fe.amount IS NOT NULL
+)`
+
+func categorySeries(db *sql.DB, id int) (*CategorySeries, error) {
+	var (
+		cs   = &CategorySeries{ID: id, Series: []SeriesPoint{}}
+		caps = capsOf(db)
+	)
+	err := db.QueryRow(`
+		SELECT
+			c.name,
+			c.parent_id,
+			`+caps.units("c")+`,
+			`+caps.scale("c")+`,
+			`+firstYearSQL+`
+		FROM categories c
+		WHERE c.id = ?
+	`, id).Scan(&cs.Name, &cs.ParentID, &cs.Units, &cs.Scale, &cs.FirstYear)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT y.year, e.amount, COALESCE(`+caps.status("e")+`, 'no_data')
+		FROM years y
+		LEFT JOIN expenditures e
+			ON e.year_id = y.id AND e.category_id = ?
+		ORDER BY y.year
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p SeriesPoint
+		if err := rows.Scan(&p.Year, &p.Amount, &p.Status); err != nil {
+			return nil, err
+		}
+		cs.Series = append(cs.Series, p)
+	}
+	return cs, rows.Err()
+}
+
+func optionSeries(
+	db *sql.DB,
+	id int,
+	opts QueryOptions,
+) (*CategorySeries, error) {
+	cs, err := categorySeries(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Metric != "" && opts.Metric != MetricAmount {
+		var totalID int
+		err := db.QueryRow(
+			"SELECT id FROM categories WHERE name = ?",
+			totalCategory,
+		).Scan(&totalID)
+		if err != nil {
+			return nil, fmt.Errorf("find total: %w", err)
+		}
+
+		total, err := categorySeries(db, totalID)
+		if err != nil {
+			return nil, fmt.Errorf("load total: %w", err)
+		}
+
+		cs.Metric = opts.Metric
+		cs.Derivations = metricDerivations(opts.Metric, "series[].value")
+		for i := range cs.Series {
+			cs.Series[i].Value = metricValue(
+				opts.Metric,
+				cs.Series,
+				total.Series,
+				i,
+			)
+		}
+	}
+
+	f := queryFilter{QueryOptions: opts}
+	cs.Series = slices.DeleteFunc(cs.Series, func(p SeriesPoint) bool {
+		return !f.wantsYear(p.Year)
+	})
+	return cs, nil
+}
+
+func categorySeriesHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := negotiated(w, r, mimeJSON, mimeCSV)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "invalid category id", http.StatusBadRequest)
+			return
+		}
+
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		shape, err := parseSeriesShape(r.URL.Query().Get("shape"))
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		db, done, err := datasetDB(app, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		defer done()
+
+		start := time.Now()
+		series, err := optionSeries(db, id, opts)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(
+				w,
+				fmt.Sprintf("category %d not found", id),
+				http.StatusNotFound,
+			)
+			return
+		}
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		if format == mimeCSV {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			if err := writeSeriesCSV(w, series, shape); err != nil {
+				slog.Error("write series CSV", "id", id, "error", err)
+			}
+			return
+		}
+		if shape == LayoutWide {
+			writeJSON(w, r, series.wide())
+			return
+		}
+		writeJSON(w, r, series)
+	}
+}
+
+const (
+	defaultCategoryLimit = 50
+	maxCategoryLimit     = 500
+)
+
+type CategoryListing struct {
+	CategoryRef
+	IsMajorHeading bool   `json:"is_major_heading"`
+	SortOrder      int    `json:"sort_order"`
+	Units          string `json:"units"`
+	Scale          int64  `json:"scale"`
+	FirstYear      *int   `json:"first_year"`
+}
+
+type CategoryPage struct {
+	Categories []CategoryListing `json:"categories"`
+	Total      int               `json:"total"`
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+	NextOffset *int              `json:"next_offset"`
+}
+
+type CategoryFilter struct {
+	ParentID       *int
+	Roots          bool
+	IsMajorHeading *bool
+	FirstYear      *YearRange
+	Limit          int
+	Offset         int
+}
+
+var defaultCategoryFilter = CategoryFilter{Limit: defaultCategoryLimit}
+
+func parseCategoryFilter(q url.Values) (CategoryFilter, error) {
+	f := defaultCategoryFilter
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxCategoryLimit {
+			return f, fmt.Errorf(
+				"limit must be between 1 and %d",
+				maxCategoryLimit,
+			)
+		}
+		f.Limit = n
+	}
+
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("offset must be a non-negative integer")
+		}
+		f.Offset = n
+	}
+
+	switch v := q.Get("parent_id"); v {
+	case "":
+	case "null":
+		f.Roots = true
+	default:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("parent_id must be an integer or null")
+		}
+		f.ParentID = &n
+	}
+
+	if v := q.Get("is_major_heading"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("is_major_heading must be true or false")
+		}
+		f.IsMajorHeading = &b
+	}
+
+	if v := q.Get("first_year"); v != "" {
+		yr, err := parseYearRange(v)
+		if err != nil {
+			return f, err
+		}
+		f.FirstYear = &yr
+	}
+
+	return f, nil
+}
+
+func cachedCategoryPage(
+	app *App,
+	refs []CategoryRef,
+	f CategoryFilter,
+) (*CategoryPage, error) {
+	if f != defaultCategoryFilter {
+		return listCategories(app.db, refs, f)
+	}
+	return cachedView(app, "categories", func() (*CategoryPage, error) {
+		return listCategories(app.db, refs, f)
+	})
+}
+
+func listCategories(
+	db *sql.DB,
+	refs []CategoryRef,
+	f CategoryFilter,
+) (*CategoryPage, error) {
+	var (
+		where []string
+		args  []any
+	)
+	switch {
+	case f.Roots:
+		where = append(where, "parent_id IS NULL")
+	case f.ParentID != nil:
+		where = append(where, "parent_id = ?")
+		args = append(args, *f.ParentID)
+	}
+	if f.IsMajorHeading != nil {
+		where = append(where, "is_major_heading = ?")
+		args = append(args, *f.IsMajorHeading)
+	}
+	if yr := f.FirstYear; yr != nil {
+		if yr.From != 0 {
+			where = append(where, firstYearSQL+" >= ?")
+			args = append(args, yr.From)
+		}
+		if yr.To != 0 {
+			where = append(where, firstYearSQL+" <= ?")
+			args = append(args, yr.To)
+		}
+	}
+
+	clause := ""
+	if len(where) > 0 {
+		clause = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	page := &CategoryPage{
+		Categories: []CategoryListing{},
+		Limit:      f.Limit,
+		Offset:     f.Offset,
+	}
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM categories c "+clause,
+		args...,
+	).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := capsOf(db)
+	rows, err := db.Query(`
+		SELECT
+			c.id,
+			c.is_major_heading,
+			c.sort_order,
+			`+caps.units("c")+`,
+			`+caps.scale("c")+`,
+			`+firstYearSQL+`
+		FROM categories c
+		`+clause+`
+		ORDER BY sort_order, id
+		LIMIT ? OFFSET ?
+	`, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int]CategoryRef{}
+	for _, ref := range refs {
+		byID[ref.ID] = ref
+	}
+
+	for rows.Next() {
+		var c CategoryListing
+		err := rows.Scan(
+			&c.ID,
+			&c.IsMajorHeading,
+			&c.SortOrder,
+			&c.Units,
+			&c.Scale,
+			&c.FirstYear,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.CategoryRef = byID[c.ID]
+		page.Categories = append(page.Categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if next := f.Offset + len(page.Categories); next < page.Total {
+		page.NextOffset = &next
+	}
+	return page, nil
+}
+
+func categoriesHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseCategoryFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		refs, err := cachedCategoryRefs(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		page, err := cachedCategoryPage(app, refs, f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		writeJSON(w, r, page)
+	}
+}
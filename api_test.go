@@ -0,0 +1,1582 @@
+package nhe
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategorySeries(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var id int
+	err = db.QueryRow(
+		"SELECT id FROM categories WHERE name = 'Medicare' ORDER BY id",
+	).Scan(&id)
+	assert.NoError(t, err)
+
+	series, err := categorySeries(db, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Medicare", series.Name)
+	assert.Len(t, series.Series, 64)
+
+	first := series.Series[0]
+	assert.Equal(t, 1960, first.Year)
+	assert.Nil(t, first.Amount)
+	assert.Equal(t, CellNoData, first.Status)
+
+	last := series.Series[len(series.Series)-1]
+	assert.Equal(t, 2023, last.Year)
+	assert.NotNil(t, last.Amount)
+	assert.Equal(t, CellValue, last.Status)
+
+	_, err = categorySeries(db, -1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestSeriesShape(t *testing.T) {
+	db, err := OpenEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler, err := Handler(db, Options{Context: t.Context()})
+	assert.NoError(t, err)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	w := get("/api/v1/categories/1/series?shape=wide")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var wide WideSeries
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &wide))
+	assert.Equal(t, "Total National Health Expenditures", wide.Name)
+	assert.Len(t, wide.Values, 64)
+	assert.Equal(t, 27122.0, *wide.Values[1960])
+	assert.Equal(t, CellValue, wide.Status[2023])
+
+	w = get("/series/total-national-health-expenditures.csv?shape=wide")
+	assert.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "category,1960,1961,"))
+	assert.True(t, strings.HasPrefix(
+		lines[1],
+		"Total National Health Expenditures,27122,",
+	))
+
+	w = get("/api/v1/categories/1/series?shape=tall")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	routes := apiRoutes(&App{})
+	doc := openAPIDocument(routes)
+
+	paths := doc["paths"].(map[string]any)
+	assert.Len(t, paths, len(routes))
+
+	for _, rt := range routes {
+		item := paths[rt.Path].(map[string]any)
+		op := item[strings.ToLower(rt.Method)].(map[string]any)
+		assert.Equal(t, rt.Summary, op["summary"])
+
+		for _, seg := range strings.Split(rt.Path, "/") {
+			name, ok := strings.CutPrefix(seg, "{")
+			if !ok {
+				continue
+			}
+			name = strings.TrimSuffix(name, "}")
+			assert.True(t, slices.ContainsFunc(rt.Params, func(p RouteParam) bool {
+				return p.Name == name && p.In == "path"
+			}), rt.Path)
+		}
+	}
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	assert.Contains(t, schemas, "TableData")
+	assert.Contains(t, schemas, "TableCategory")
+	assert.Contains(t, schemas, "CategorySeries")
+
+	props := schemas["TableData"].(map[string]any)["properties"]
+	assert.NotContains(t, props, "Views")
+}
+
+func TestRunQuery(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	refs, err := categoryRefs(db)
+	assert.NoError(t, err)
+
+	slugs := map[string]bool{}
+	for _, ref := range refs {
+		assert.False(t, slugs[ref.Slug], ref.Slug)
+		slugs[ref.Slug] = true
+	}
+	assert.True(t, slugs["personal-health-care/health-insurance/medicare"])
+
+	q := QueryRequest{
+		Categories: []string{
+			"total-national-health-expenditures",
+			"personal-health-care/health-insurance/medicare",
+		},
+		Years:   []YearRange{{From: 1964, To: 1967}},
+		Metrics: []string{MetricAmount, MetricShare, MetricGrowth},
+	}
+	assert.NoError(t, q.validate())
+
+	resp, err := runQuery(db, refs, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1964, 1965, 1966, 1967}, resp.Years)
+
+	total := resp.Series[0].Values
+	assert.InDelta(t, 100, *total[MetricShare][0], 0.001)
+
+	medicare := resp.Series[1]
+	assert.Equal(t, CellNoData, medicare.Status[0])
+	assert.Nil(t, medicare.Values[MetricAmount][0])
+	assert.NotNil(t, medicare.Values[MetricAmount][2])
+	assert.Nil(t, medicare.Values[MetricGrowth][2])
+	assert.NotNil(t, medicare.Values[MetricGrowth][3])
+	assert.Len(t, resp.Derivations, 2)
+	assert.Equal(t, "series[].values.growth", resp.Derivations[1].Field)
+
+	_, err = runQuery(db, refs, QueryRequest{Categories: []string{"nope"}})
+	assert.ErrorAs(t, err, &queryError{})
+
+	_, err = runQuery(db, refs, QueryRequest{Categories: []string{"Medicare"}})
+	assert.ErrorContains(t, err, "ambiguous")
+
+	m := QueryRequest{
+		Categories:  []string{"total national health expenditures"},
+		CategoryIDs: []int{refs[1].ID},
+		Years:       []YearRange{{From: 2020, To: 2022}},
+		Shape:       ShapeMatrix,
+	}
+	assert.NoError(t, m.validate())
+
+	resp, err = runQuery(db, refs, m)
+	assert.NoError(t, err)
+	assert.Nil(t, resp.Series)
+	assert.Equal(t, MetricAmount, resp.Matrix.Metric)
+	assert.Equal(t, refs[1].Slug, resp.Matrix.Rows[1].Slug)
+	assert.Len(t, resp.Matrix.Values, 2)
+	assert.Len(t, resp.Matrix.Values[0], 3)
+	assert.Empty(t, resp.Derivations)
+
+	bad := QueryRequest{Categories: []string{"x"}, Metrics: []string{"foo"}}
+	assert.Error(t, bad.validate())
+
+	bad = QueryRequest{
+		CategoryIDs: []int{1},
+		Metrics:     []string{MetricAmount, MetricShare},
+		Shape:       ShapeMatrix,
+	}
+	assert.Error(t, bad.validate())
+}
+
+func TestRegimes(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	periods, err := parseRegimes("")
+	assert.NoError(t, err)
+	assert.Len(t, periods, 3)
+	assert.Equal(t, RegimePeriod{Label: "covid", From: 2020}, periods[2])
+
+	periods, err = parseRegimes("1990-1999,2000-2009")
+	assert.NoError(t, err)
+	assert.Equal(t, "1990-1999", periods[0].Label)
+
+	for _, spec := range []string{
+		"2000-2009",
+		"2009-2000,2010",
+		"x,2010",
+		"=2000,2010",
+		strings.Repeat("x", maxRegimeLabel+1) + "=2000,2010",
+		strings.Repeat("2000,", maxRegimes) + "2010",
+	} {
+		_, err = parseRegimes(spec)
+		assert.ErrorAs(t, err, &queryError{}, spec)
+	}
+
+	refs, err := categoryRefs(db)
+	assert.NoError(t, err)
+	cats, err := regimeCategories(refs, url.Values{
+		"category": {"total-national-health-expenditures"},
+	})
+	assert.NoError(t, err)
+
+	_, err = regimeCategories(refs, url.Values{
+		"category": make([]string, maxQueryCategories+1),
+	})
+	assert.ErrorAs(t, err, &queryError{})
+
+	spelled, err := parseRegimes("1990-1999=1990-1999,2000-2009=2000-2009")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		regimeKey(periods, cats, false),
+		regimeKey(spelled, cats, false),
+	)
+	assert.NotEqual(
+		t,
+		regimeKey(periods, cats, false),
+		regimeKey(periods, cats, true),
+	)
+
+	report, err := regimeReport(db, cats, periods)
+	assert.NoError(t, err)
+	assert.Len(t, report.Categories, 1)
+
+	total := report.Categories[0]
+	assert.Equal(t, 10, total.Periods[0].Years)
+	assert.NotNil(t, total.Periods[1].StdDev)
+	assert.Len(t, total.Changes, 1)
+	assert.NotNil(t, total.Changes[0].Delta)
+	assert.NotNil(t, total.Changes[0].T)
+	assert.Len(t, report.Derivations, 5)
+	assert.Equal(t, "abs(t) >= 2", report.Derivations[4].Formula)
+
+	flat := regimeChange(
+		periods[0],
+		periods[1],
+		regimeStats([]float64{5}),
+		regimeStats([]float64{3, 3}),
+	)
+	assert.InDelta(t, -2, *flat.Delta, 0.001)
+	assert.Nil(t, flat.T)
+	assert.False(t, flat.Significant)
+
+	jump := regimeChange(
+		periods[0],
+		periods[1],
+		regimeStats([]float64{2, 3, 2, 3}),
+		regimeStats([]float64{9, 10, 9, 10}),
+	)
+	assert.True(t, jump.Significant)
+}
+
+func TestGraphQL(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	refs, err := categoryRefs(db)
+	assert.NoError(t, err)
+	graph, err := loadGraph(db, refs)
+	assert.NoError(t, err)
+
+	resp := executeGraphQL(db, graph, GraphQLRequest{
+		Query: `query Insurance($slug: String, $from: Int = 2021) {
+			years
+			insurance: category(slug: $slug) {
+				name
+				children { name parent { slug } }
+				expenditures(from: $from) { year status }
+			}
+		}`,
+		Variables: map[string]any{"slug": "personal-health-care/health-insurance"},
+	})
+	assert.Empty(t, resp.Errors)
+
+	b, err := json.Marshal(resp.Data)
+	assert.NoError(t, err)
+
+	var data struct {
+		Years     []int `json:"years"`
+		Insurance struct {
+			Name     string `json:"name"`
+			Children []struct {
+				Name   string `json:"name"`
+				Parent struct {
+					Slug string `json:"slug"`
+				} `json:"parent"`
+			} `json:"children"`
+			Expenditures []SeriesPoint `json:"expenditures"`
+		} `json:"insurance"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &data))
+	assert.True(t, strings.HasPrefix(string(b), `{"years":`))
+	assert.Len(t, data.Years, 64)
+	assert.Equal(t, "Health Insurance", data.Insurance.Name)
+	assert.NotEmpty(t, data.Insurance.Children)
+	for _, child := range data.Insurance.Children {
+		assert.Equal(
+			t,
+			"personal-health-care/health-insurance",
+			child.Parent.Slug,
+		)
+	}
+	assert.Len(t, data.Insurance.Expenditures, 3)
+
+	resp = executeGraphQL(db, graph, GraphQLRequest{
+		Query: `{ categories { id expenditures { year amount status } } }`,
+	})
+	assert.Empty(t, resp.Errors)
+	b, err = json.Marshal(resp.Data)
+	assert.NoError(t, err)
+
+	var all struct {
+		Categories []struct {
+			ID           int           `json:"id"`
+			Expenditures []SeriesPoint `json:"expenditures"`
+		} `json:"categories"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &all))
+	assert.Len(t, all.Categories, len(refs))
+	for _, c := range all.Categories[:5] {
+		cs, err := categorySeries(db, c.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, cs.Series, c.Expenditures)
+	}
+
+	for _, query := range []string{
+		`{ nope }`,
+		`{ years { x } }`,
+		`{ categories { name expenditures } }`,
+		`{ category(id: "x") { name } }`,
+		`mutation { years }`,
+		`{ ...frag }`,
+		`{ categories(first: 2) { name } }`,
+		`{ years(from: 2020) }`,
+		`{ category(id: 1) { children(limit: 1) { name } } }`,
+		`{ category(id: 1) { expenditures(step: 2) { year } } }`,
+		`{ a: categories { expenditures { year } } ` +
+			`b: categories { expenditures { year } } }`,
+		"{ " + strings.Repeat("x: years ", maxGraphQLAliases+1) + "}",
+	} {
+		resp := executeGraphQL(db, graph, GraphQLRequest{Query: query})
+		assert.NotEmpty(t, resp.Errors, query)
+		assert.Nil(t, resp.Data, query)
+	}
+}
+
+func TestMatchCategories(t *testing.T) {
+	refs := []CategoryRef{
+		{ID: 1, Slug: "medicare", Name: "Medicare"},
+		{ID: 2, Slug: "medicaid", Name: "Medicaid (Title XIX)"},
+		{ID: 3, Slug: "hospital/medicare", Name: "Medicare"},
+		{ID: 4, Slug: "dental", Name: "Dental Services"},
+	}
+
+	matches := matchCategories(refs, "medicar", 5)
+	assert.Len(t, matches, 2)
+	assert.Equal(t, 1, matches[0].ID)
+	assert.Equal(t, 2, matches[1].ID)
+	assert.Greater(t, matches[0].Score, matches[1].Score)
+
+	assert.Len(t, matchCategories(refs, "medicar", 1), 1)
+	assert.Empty(t, matchCategories(refs, "zzz", 5))
+}
+
+func TestListCategories(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	refs, err := categoryRefs(db)
+	assert.NoError(t, err)
+
+	f, err := parseCategoryFilter(url.Values{"limit": {"10"}})
+	assert.NoError(t, err)
+	first, err := listCategories(db, refs, f)
+	assert.NoError(t, err)
+	assert.Len(t, first.Categories, 10)
+	assert.Equal(t, len(refs), first.Total)
+	assert.Equal(t, 10, *first.NextOffset)
+	assert.Equal(t, refs[0].Slug, first.Categories[0].Slug)
+
+	f.Offset = *first.NextOffset
+	second, err := listCategories(db, refs, f)
+	assert.NoError(t, err)
+	assert.Equal(t, refs[10].ID, second.Categories[0].ID)
+	assert.Less(
+		t,
+		first.Categories[9].SortOrder,
+		second.Categories[0].SortOrder,
+	)
+
+	f.Offset = len(refs) - 3
+	last, err := listCategories(db, refs, f)
+	assert.NoError(t, err)
+	assert.Len(t, last.Categories, 3)
+	assert.Nil(t, last.NextOffset)
+
+	f, err = parseCategoryFilter(url.Values{
+		"is_major_heading": {"true"},
+		"limit":            {"500"},
+	})
+	assert.NoError(t, err)
+	headings, err := listCategories(db, refs, f)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, headings.Categories)
+	for _, c := range headings.Categories {
+		assert.True(t, c.IsMajorHeading, c.Name)
+	}
+
+	parent := headings.Categories[0].ID
+	f, err = parseCategoryFilter(url.Values{
+		"parent_id": {strconv.Itoa(parent)},
+	})
+	assert.NoError(t, err)
+	children, err := listCategories(db, refs, f)
+	assert.NoError(t, err)
+	for _, c := range children.Categories {
+		assert.Equal(t, parent, *c.ParentID)
+	}
+
+	f, err = parseCategoryFilter(url.Values{
+		"first_year": {"1966"},
+		"limit":      {"500"},
+	})
+	assert.NoError(t, err)
+	started, err := listCategories(db, refs, f)
+	assert.NoError(t, err)
+	assert.Equal(t, len(started.Categories), started.Total)
+	var names []string
+	for _, c := range started.Categories {
+		assert.Equal(t, 1966, *c.FirstYear, c.Name)
+		names = append(names, c.Name)
+	}
+	assert.Contains(t, names, "Medicare")
+
+	f, err = parseCategoryFilter(url.Values{"first_year": {"1990-"}})
+	assert.NoError(t, err)
+	later, err := listCategories(db, refs, f)
+	assert.NoError(t, err)
+	for _, c := range later.Categories {
+		assert.GreaterOrEqual(t, *c.FirstYear, 1990, c.Name)
+	}
+
+	id := slices.IndexFunc(started.Categories, func(c CategoryListing) bool {
+		return c.Name == "Medicare"
+	})
+	cs, err := categorySeries(db, started.Categories[id].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1966, *cs.FirstYear)
+
+	for _, q := range []url.Values{
+		{"first_year": {"2010-1990"}},
+		{"limit": {"0"}},
+		{"limit": {"501"}},
+		{"offset": {"-1"}},
+		{"parent_id": {"x"}},
+		{"is_major_heading": {"maybe"}},
+	} {
+		_, err := parseCategoryFilter(q)
+		assert.Error(t, err, q.Encode())
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{mimeHTML, mimeJSON, mimeCSV}
+
+	for accept, want := range map[string]string{
+		"":                                      mimeHTML,
+		"*/*":                                   mimeHTML,
+		"application/json":                      mimeJSON,
+		"text/csv, application/json;q=0.5":      mimeCSV,
+		"text/*;q=0.2, application/json;q=0.9":  mimeJSON,
+		"text/html;q=0, text/*":                 mimeCSV,
+		"application/xhtml+xml,text/html;q=0.9": mimeHTML,
+	} {
+		got, ok := negotiate(accept, offers...)
+		assert.True(t, ok, accept)
+		assert.Equal(t, want, got, accept)
+	}
+
+	_, ok := negotiate("image/png", offers...)
+	assert.False(t, ok)
+
+	db, err := OpenEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler, err := Handler(db, Options{Context: t.Context()})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/?years=decades", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	assert.True(t, strings.HasPrefix(
+		w.Body.String(),
+		"category,units,scale,2023,2020,2019,2010,",
+	))
+
+	req = httptest.NewRequest("GET", "/api/v1/table", nil)
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestDerivationsOverHTTP(t *testing.T) {
+	db, err := OpenEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler, err := Handler(db, Options{Context: t.Context()})
+	assert.NoError(t, err)
+
+	get := func(path string) []Derivation {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+
+		var body struct {
+			Derivations []Derivation `json:"derivations"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), path)
+		return body.Derivations
+	}
+
+	for _, path := range []string{
+		"/api/v1/table?basis=fiscal",
+		"/?basis=fiscal",
+	} {
+		derived := get(path)
+		assert.Len(t, derived, 1, path)
+		assert.Equal(t, fiscalDerivation, derived[0], path)
+	}
+	assert.Empty(t, get("/api/v1/table"))
+
+	series := "/api/v1/categories/1/series"
+	assert.Empty(t, get(series))
+	assert.Empty(t, get(series+"?metric=amount"))
+	for _, metric := range []string{MetricShare, MetricGrowth} {
+		for _, shape := range []string{"", "&shape=wide"} {
+			derived := get(series + "?metric=" + metric + shape)
+			assert.Len(t, derived, 1, metric)
+			assert.Equal(
+				t,
+				metricDerivations(metric, derived[0].Field),
+				derived,
+			)
+		}
+	}
+}
+
+func TestDatasetRoutes(t *testing.T) {
+	db, err := OpenEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler, err := Handler(db, Options{Context: t.Context()})
+	assert.NoError(t, err)
+
+	version, err := currentVersion(db)
+	assert.NoError(t, err)
+	pinned := "/api/v1/datasets/" + version + "/table"
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	before := get(pinned)
+	assert.Equal(t, http.StatusOK, before.Code)
+	assert.Equal(t, `"`+version+`"`, before.Header().Get("ETag"))
+	assert.Equal(
+		t,
+		immutableCacheControl,
+		before.Header().Get("Cache-Control"),
+	)
+
+	w := get("/api/v1/datasets/latest/table?years=decades")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, pinned+"?years=decades", w.Header().Get("Location"))
+
+	req := httptest.NewRequest("GET", pinned, nil)
+	req.Header.Set("If-None-Match", `"`+version+`"`)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = get("/api/v1/datasets/not-a-version/table")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "not retained")
+
+	w = get(pinned + "?range=abc")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+
+	assert.NoError(t, saveAnnotation(db, Annotation{
+		Category: "total-national-health-expenditures",
+		Year:     2023,
+		Note:     "Preliminary",
+	}))
+	after := get(pinned)
+	assert.Equal(t, http.StatusOK, after.Code)
+	assert.Equal(t, before.Body.String(), after.Body.String())
+	assert.NotContains(t, after.Body.String(), "Preliminary")
+
+	assert.NoError(t, addUserSeries(t.Context(), db, UserSeries{
+		Name:   "Employer premium survey",
+		Units:  unitsUSD,
+		Scale:  1,
+		Points: map[int]*int{2023: new(int)},
+	}))
+	handler, err = Handler(db, Options{Context: t.Context()})
+	assert.NoError(t, err)
+	assert.Contains(t, get("/api/v1/table").Body.String(), "Employer premium")
+
+	after = get(pinned)
+	assert.Equal(t, http.StatusOK, after.Code)
+	assert.Equal(t, before.Body.String(), after.Body.String())
+}
+
+func TestFields(t *testing.T) {
+	db, err := OpenEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler, err := Handler(db, Options{Context: t.Context()})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/api/v1/table?years=decades&fields=name,slug,values",
+		nil,
+	)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var table map[string][]map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &table))
+	assert.Len(t, table, 1)
+	assert.NotEmpty(t, table["categories"])
+	for _, cat := range table["categories"] {
+		assert.Len(t, cat, 3)
+		assert.Contains(t, cat, "slug")
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/datasets?fields=version", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "loaded_at")
+}
+
+func TestQueryOptions(t *testing.T) {
+	bind := func(raw string) (QueryOptions, error) {
+		q, err := url.ParseQuery(raw)
+		assert.NoError(t, err)
+		return bindQueryOptions(func(name string) []string {
+			return q[name]
+		})
+	}
+
+	opts, err := bind("range=2020-&range=-1961&range=1990&category=medicare")
+	assert.NoError(t, err)
+	assert.Equal(t, MetricAmount, opts.Metric)
+	assert.Equal(t, SortOrder, opts.Sort)
+	assert.Equal(
+		t,
+		[]YearRange{{From: 2020}, {To: 1961}, {From: 1990, To: 1990}},
+		opts.Years,
+	)
+
+	opts, err = bind("from=1990&to=2010")
+	assert.NoError(t, err)
+	assert.Equal(t, []YearRange{{From: 1990, To: 2010}}, opts.Years)
+
+	for _, raw := range []string{
+		"range=2020-2010",
+		"range=abc",
+		"from=2010&to=1990",
+		"to=latest",
+		"metric=ratio",
+		"units=yen",
+		"sort=size",
+		"sort=2010:up",
+		"sort=name:",
+	} {
+		_, err := bind(raw)
+		var qe queryError
+		assert.ErrorAs(t, err, &qe, raw)
+	}
+
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	opts = QueryOptions{
+		Years: []YearRange{{From: 2021}},
+		Categories: []string{
+			"total-national-health-expenditures/health-insurance",
+		},
+		Sort: SortName,
+	}
+	every, err := parseYearStrategy("every")
+	assert.NoError(t, err)
+	data, err := nheData(db, TableView{Years: every}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2023, 2022, 2021}, data.Years)
+
+	every3, err := parseYearStrategy("every:3")
+	assert.NoError(t, err)
+	ranged, err := nheData(
+		db,
+		TableView{Years: every3},
+		QueryOptions{Years: []YearRange{{From: 1990, To: 2010}}},
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]int{2010, 2007, 2004, 2001, 1998, 1995, 1992},
+		ranged.Years,
+	)
+
+	var names []string
+	for _, c := range data.Categories {
+		names = append(names, c.Name)
+	}
+	assert.Contains(t, names, "Medicare")
+	assert.True(t, slices.IsSorted(names))
+
+	var buf strings.Builder
+	_, err = writeExpendituresJSONL(t.Context(), &buf, db, opts)
+	assert.NoError(t, err)
+
+	exported := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var row struct {
+			Category string `json:"category"`
+			Year     int    `json:"year"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(line), &row))
+		assert.GreaterOrEqual(t, row.Year, 2021)
+		exported[row.Category] = true
+	}
+	for _, name := range names {
+		assert.True(t, exported[name], name)
+	}
+
+	opts.Sort = SortName + ":desc"
+	data, err = nheData(db, TableView{Years: every}, opts)
+	assert.NoError(t, err)
+	names = names[:0]
+	for _, c := range data.Categories {
+		names = append(names, c.Name)
+	}
+	assert.True(t, slices.IsSortedFunc(names, func(a, b string) int {
+		return strings.Compare(b, a)
+	}))
+
+	opts.Sort = "2022"
+	data, err = nheData(db, TableView{Years: every}, opts)
+	assert.NoError(t, err)
+	col := slices.Index(data.Years, 2022)
+	var amounts []int
+	for _, c := range data.Categories {
+		if v := c.Values[col]; v != nil {
+			amounts = append(amounts, *v)
+		}
+	}
+	assert.NotEmpty(t, amounts)
+	assert.True(t, slices.IsSortedFunc(amounts, func(a, b int) int {
+		return b - a
+	}))
+
+	next := TableData{Sort: "2022"}
+	assert.Equal(t, "2022:asc", next.NextSort("2022"))
+	assert.Equal(t, "▼", next.SortMark("2022"))
+	assert.Equal(t, SortName, next.NextSort(SortName))
+	assert.Empty(t, next.SortMark(SortName))
+
+	_, err = nheData(db, defaultView(&App{}), QueryOptions{Metric: MetricShare})
+	var qe queryError
+	assert.ErrorAs(t, err, &qe)
+
+	var id int
+	err = db.QueryRow(
+		"SELECT id FROM categories WHERE name = 'Medicare' ORDER BY id",
+	).Scan(&id)
+	assert.NoError(t, err)
+
+	cs, err := optionSeries(db, id, QueryOptions{
+		Years:  []YearRange{{From: 2023, To: 2023}},
+		Metric: MetricShare,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, cs.Series, 1)
+	assert.NotNil(t, cs.Series[0].Value)
+	assert.Greater(t, *cs.Series[0].Value, 0.0)
+	assert.Less(t, *cs.Series[0].Value, 100.0)
+}
+
+func TestAnnotations(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	const slug = "total-national-health-expenditures"
+
+	var qe queryError
+	err = saveAnnotation(db, Annotation{Category: "medicar", Year: 2020})
+	assert.ErrorAs(t, err, &qe)
+	err = saveAnnotation(db, Annotation{Category: slug, Year: 1900})
+	assert.ErrorAs(t, err, &qe)
+
+	assert.NoError(t, saveAnnotation(db, Annotation{
+		Category: slug,
+		Year:     2020,
+		Note:     "  Includes COVID-19 relief  ",
+	}))
+	notes, err := listAnnotations(db)
+	assert.NoError(t, err)
+	assert.Len(t, notes, 1)
+	assert.Equal(t, "Includes COVID-19 relief", notes[0].Note)
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/?years=every", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="#note-1"`)
+	assert.Contains(t, w.Body.String(), "Includes COVID-19 relief")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/?basis=fiscal", nil))
+	assert.NotContains(t, w.Body.String(), `href="#note-1"`)
+
+	var buf strings.Builder
+	_, err = writeExpendituresCSV(t.Context(), &buf, db, QueryOptions{
+		Years: []YearRange{{From: 2020, To: 2020}},
+	}, ',')
+	assert.NoError(t, err)
+	assert.Regexp(
+		t,
+		`Total National Health Expenditures,,2020,\d+,Includes COVID-19 relief\n`,
+		buf.String(),
+	)
+
+	assert.NoError(t, saveAnnotation(db, Annotation{
+		Category: slug,
+		Year:     2020,
+	}))
+	notes, err = listAnnotations(db)
+	assert.NoError(t, err)
+	assert.Empty(t, notes)
+}
+
+func TestChartPNG(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	const chart = "/chart/total-national-health-expenditures.png"
+	for path, code := range map[string]int{
+		chart:                          http.StatusOK,
+		chart + "?from=1960&to=2023":   http.StatusOK,
+		chart + "?metric=growth":       http.StatusOK,
+		chart + "?from=2023&to=1960":   http.StatusBadRequest,
+		chart + "?from=sixty":          http.StatusBadRequest,
+		"/chart/medicar.png":           http.StatusNotFound,
+		"/chart/total-national-health": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, code, w.Code, path)
+		if code != http.StatusOK {
+			continue
+		}
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		img, err := png.Decode(w.Body)
+		assert.NoError(t, err, path)
+		assert.Equal(t, chartWidth, img.Bounds().Dx())
+		assert.Equal(t, chartHeight, img.Bounds().Dy())
+	}
+
+	cs := &CategorySeries{Units: unitsUSD, Scale: 1000000}
+	for year, amount := range map[int]int{1960: 27, 1961: 29} {
+		cs.Series = append(cs.Series, SeriesPoint{Year: year, Amount: &amount})
+	}
+	slices.SortFunc(cs.Series, func(a, b SeriesPoint) int {
+		return a.Year - b.Year
+	})
+	assert.Equal(t, "29.0M", chartLabel(29e6, cs, localeEnglish))
+	assert.Equal(
+		t,
+		"1,2T",
+		chartLabel(1.2e12, cs, parseLocale("de-DE,de;q=0.9,en;q=0.8")),
+	)
+	assert.Equal(t, localeEnglish, parseLocale("ja, *;q=0.5"))
+	assert.Equal(t, "'95", shortYear(1995))
+	assert.Equal(t, "'05", shortYear(2005))
+	img := renderChart(cs, localeEnglish)
+	assert.Equal(t, chartLine, img.RGBAAt(chartWidth-chartRight, chartTop))
+}
+
+func TestTheme(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(
+		"POST",
+		"/theme",
+		strings.NewReader("theme=dark"),
+	)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", "http://example.com/?years=every")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/?years=every", w.Header().Get("Location"))
+
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, "dark", cookies[0].Value)
+
+	req = httptest.NewRequest("GET", "/?heatmap=dollars", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `<html lang="en" class="dark" data-base="">`)
+	assert.Contains(t, body, "bg-gray-800")
+	assert.Contains(t, body, "Light mode")
+
+	req = httptest.NewRequest(
+		"POST",
+		"/theme",
+		strings.NewReader("theme=sepia"),
+	)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTableFragment(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/table?years=every&from=2100&mode=pct&sort=name",
+		nil,
+	))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.NotContains(t, body, "<html")
+	assert.Contains(t, body, `<div id="year-table">`)
+	assert.Contains(t, body, `<div id="view-controls">`)
+	assert.Contains(t, body, `<a data-swap class="hover:underline"`)
+	assert.Contains(t, body, "from=2023&sort=name&mode=pct")
+	assert.Contains(t, body, "cat-1-2023")
+	assert.NotContains(t, body, "-2022\"")
+
+	assert.Equal(
+		t,
+		YearRange{From: 1960, To: 2023},
+		clampYearRange(YearRange{From: 1900, To: 2100}, []int{1960, 2023}),
+	)
+	assert.Equal(
+		t,
+		YearRange{To: 1960},
+		clampYearRange(YearRange{To: 1900}, []int{1960, 2023}),
+	)
+
+	for path, code := range map[string]int{
+		"/table?from=2010&to=1990": http.StatusBadRequest,
+		"/table?mode=ratio":        http.StatusBadRequest,
+		"/static/js/slider.js":     http.StatusOK,
+		"/static/js/swap.js":       http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, code, w.Code, path)
+	}
+}
+
+func TestChildrenFragment(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	const total = "total-national-health-expenditures"
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/children/"+total+"?years=every&heatmap=dollars",
+		nil,
+	))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.NotContains(t, body, "<html")
+	assert.NotContains(t, body, `data-slug="`+total+`"`)
+	assert.Contains(t, body, `data-slug="`+total+`/health-insurance"`)
+	assert.Contains(t, body, `data-expand="`+total+`/health-insurance"`)
+	assert.Contains(t, body, `data-depth="1"`)
+	assert.NotContains(t, body, `data-depth="2"`)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/children/"+total+"/health-insurance?years=every",
+		nil,
+	))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `data-depth="2"`)
+	assert.Contains(t, w.Body.String(), "Medicare")
+
+	for path, code := range map[string]int{
+		"/children/medicar":                  http.StatusNotFound,
+		"/children/" + total + "?heatmap=no": http.StatusBadRequest,
+		"/static/js/table.js":                http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, code, w.Code, path)
+	}
+}
+
+func TestExportLinks(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{rowLimit: 100})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/?from=1990&to=2010", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	links := regexp.MustCompile(
+		`href="(/(?:export\.csv|export\.xlsx|api/v1/table)\?[^"]*)"`,
+	).FindAllStringSubmatch(w.Body.String(), -1)
+	assert.Len(t, links, 3)
+	for _, link := range links {
+		target := html.UnescapeString(link[1])
+		assert.Contains(t, target, "from=1990&to=2010", target)
+		assert.NotContains(t, target, "confirm", target)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if strings.HasPrefix(target, "/api/") {
+			assert.Equal(t, http.StatusOK, w.Code, target)
+			continue
+		}
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, target)
+		assert.Contains(t, w.Body.String(), "add ?confirm=1")
+
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest("GET", target+"&confirm=1", nil)
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, target)
+	}
+}
+
+func TestExportGuard(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(
+		t.Context(),
+		app,
+		exportGuard{rowLimit: 50, apiKey: "secret"},
+	)
+	assert.NoError(t, err)
+
+	client := 0
+	get := func(path, key string) *httptest.ResponseRecorder {
+		client++
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", client)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	small := "?category=personal-health-care/health-insurance/medicare" +
+		"&range=2000-2010"
+	for _, path := range []string{
+		"/export.txt",
+		"/export.csv",
+		"/export.tsv",
+		"/export.xlsx",
+	} {
+		w := get(path, "")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, path)
+		assert.Contains(t, w.Body.String(), "exceeds limit of 50 rows")
+
+		w = get(path+"?confirm=1", "")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+
+		w = get(path, "secret")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+
+		w = get(path, "wrong")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, path)
+
+		w = get(path+small, "")
+		assert.Equal(t, http.StatusOK, w.Code, path+small)
+	}
+
+	w := get("/export.csv?category=no-such-category", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExpandedPermalink(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	const (
+		total     = "total-national-health-expenditures"
+		insurance = total + "/health-insurance"
+	)
+
+	for _, path := range []string{"/", "/table"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(
+			"GET",
+			path+"?mode=pct&expand="+total+","+insurance+",medicar",
+			nil,
+		))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+
+		body := w.Body.String()
+		assert.Contains(t, body, `data-slug="`+insurance+`"`, path)
+		assert.Contains(t, body, `data-depth="2"`, path)
+		assert.Contains(t, body, `data-loaded="true"`, path)
+		assert.Contains(t, body, `aria-expanded="true"`, path)
+		assert.Contains(t, body, "&mode=pct&expand="+total+"%2c", path)
+		assert.NotContains(t, body, "%2cmedicar&", path)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/?expand="+insurance,
+		nil,
+	))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `data-depth="2"`)
+}
+
+func TestAsOf(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("UPDATE loads SET loaded_at = '2024-01-01 09:00:00'")
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO loads (id, version, source, loaded_at)
+		VALUES (0, 'old', 'test', '2023-06-01 12:00:00')
+	`)
+	assert.NoError(t, err)
+
+	current, err := currentVersion(db)
+	assert.NoError(t, err)
+
+	for s, want := range map[string]string{
+		"2023-06-01":                "old",
+		"2023-12-31T23:59:59Z":      "old",
+		"2024-01-01T09:00:00Z":      current,
+		"2024-01-01":                current,
+		"2024-01-01T04:00:00-05:00": current,
+	} {
+		at, err := parseAsOf(s)
+		assert.NoError(t, err, s)
+		version, err := versionAsOf(db, at)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, version, s)
+	}
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	for query, code := range map[string]int{
+		"as_of=2024-06-01":                    http.StatusOK,
+		"as_of=2023-06-01":                    http.StatusNotFound,
+		"as_of=2022-01-01":                    http.StatusNotFound,
+		"as_of=June":                          http.StatusBadRequest,
+		"as_of=2024-06-01&dataset=" + current: http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(
+			"GET",
+			"/api/v1/table?"+query,
+			nil,
+		))
+		assert.Equal(t, code, w.Code, query)
+	}
+}
+
+func TestCategoryDetail(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	refs, err := categoryRefs(db)
+	assert.NoError(t, err)
+
+	total, err := categoryDetail(db, refs, refs[0])
+	assert.NoError(t, err)
+	assert.Nil(t, total.Parent)
+	assert.NotEmpty(t, total.Children)
+	assert.Equal(t, 2023, total.Years[0].Year)
+	assert.InDelta(t, 100, *total.Years[0].Share, 0.001)
+	assert.Nil(t, total.Years[len(total.Years)-1].Growth)
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+	for path, code := range map[string]int{
+		"/category/1":    http.StatusOK,
+		"/category/9999": http.StatusNotFound,
+		"/category/x":    http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, code, w.Code, path)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	years := []int{2018, 2019, 2020, 2021, 2022, 2023}
+
+	from, to, err := compareYears(url.Values{}, years)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2019, 2023}, []int{from, to})
+
+	from, to, err = compareYears(url.Values{"a": {"2022"}, "b": {"2018"}}, years)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2022, 2018}, []int{from, to})
+
+	for _, q := range []url.Values{
+		{"a": {"1999"}},
+		{"a": {"x"}},
+		{"a": {"2020"}, "b": {"2020"}},
+	} {
+		_, _, err := compareYears(q, years)
+		assert.ErrorAs(t, err, &queryError{}, q.Encode())
+	}
+
+	var (
+		lo, hi = 80, 100
+		row    = compareRow(TableCategory{
+			Units:  unitsUSD,
+			Scale:  1000000,
+			Values: []*int{&hi, nil, &lo},
+			Status: []CellStatus{CellValue, CellNoData, CellValue},
+		}, 0, 2)
+	)
+	assert.Equal(t, -20, *row.Delta)
+	assert.Equal(t, "-$20.00M", row.Change())
+	assert.Equal(t, "-20.0%", row.PctChange())
+	assert.Equal(t, "—", compareRow(TableCategory{
+		Values: []*int{&hi, nil},
+		Status: []CellStatus{CellValue, CellNoData},
+	}, 0, 1).Change())
+}
+
+func TestRowPrefs(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	const (
+		dental   = "total-dental-services-expenditures"
+		hospital = "total-hospital-expenditures"
+	)
+
+	post := func(form url.Values, cookies []*http.Cookie) []*http.Cookie {
+		r := httptest.NewRequest(
+			"POST",
+			"/rows",
+			strings.NewReader(form.Encode()),
+		)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+		return w.Result().Cookies()
+	}
+
+	cookies := post(url.Values{"pin": {dental}}, nil)
+	cookies = post(url.Values{"hide": {hospital}}, cookies)
+
+	slugs := regexp.MustCompile(`<tr[^>]* data-slug="([^"]+)"`)
+	get := func(path string) string {
+		r := httptest.NewRequest("GET", path, nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		return w.Body.String()
+	}
+
+	for _, path := range []string{"/", "/table"} {
+		body := get(path)
+		rows := slugs.FindAllStringSubmatch(body, -1)
+		assert.Equal(t, dental, rows[0][1], path)
+		assert.NotContains(t, body, `data-slug="`+hospital+`"`, path)
+		assert.Contains(t, body, `name="unpin" value="`+dental+`"`, path)
+		assert.Contains(t, body, `name="unhide" value="`+hospital+`"`, path)
+	}
+
+	cookies = post(url.Values{"reset": {"1"}}, cookies)
+	body := get("/")
+	assert.Equal(t,
+		"total-national-health-expenditures",
+		slugs.FindStringSubmatch(body)[1],
+	)
+	assert.Contains(t, body, `data-slug="`+hospital+`"`)
+}
+
+func TestCellTooltips(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/?years=every", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	cell := regexp.MustCompile(
+		`id="cat-1-2023"[^>]*>`,
+	).FindString(w.Body.String())
+	assert.Contains(t, cell, `data-exact="$4,866,494 million"`)
+	assert.Contains(t, cell, `data-change="&#43;7.5%"`)
+	assert.Contains(t, cell, `data-share="100.0%"`)
+	assert.NotEqual(
+		t,
+		TableCategory{ID: 1, Slug: "a/b"}.Anchor(2023),
+		TableCategory{ID: 2, Slug: "a-b"}.Anchor(2023),
+	)
+
+	for _, tc := range []struct {
+		n     int
+		units string
+		scale int64
+		want  string
+	}{
+		{4_866_494, unitsUSD, 1_000_000, "$4,866,494 million"},
+		{-1_200, unitsUSD, 1_000_000, "-$1,200 million"},
+		{335, unitsPersons, 1_000_000, "335 million people"},
+		{14_570, unitsUSDPerCapita, 1, "$14,570 per person"},
+	} {
+		assert.Equal(t, tc.want, formatExact(&tc.n, tc.units, tc.scale))
+	}
+
+	var (
+		prev, cur = 100, 110
+		zero      = 0
+	)
+	cat := TableCategory{
+		Values:   []*int{&cur, &cur},
+		Previous: []*int{&prev, &zero},
+	}
+	assert.Equal(t, "+10.0%", cat.Change(0))
+	assert.Equal(t, "", cat.Change(1))
+}
+
+func TestLinesPage(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	const hospital = "total-hospital-expenditures"
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/lines?metric=share&category="+hospital,
+		nil,
+	))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `value="`+hospital+`" checked`)
+	assert.Contains(t, body, `<option value="share" selected>`)
+	assert.Contains(t, body, `data-endpoint="/api/v1/query"`)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/lines", nil))
+	assert.Contains(
+		t,
+		w.Body.String(),
+		`value="total-national-health-expenditures" checked`,
+	)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/lines?metric=x", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPayers(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	refs, err := categoryRefs(db)
+	assert.NoError(t, err)
+	years, layers, err := payerSeries(db, refs)
+	assert.NoError(t, err)
+	assert.Len(t, layers, len(payerLayers))
+	assert.Equal(t, 1960, years[0])
+
+	for _, j := range []int{0, len(years) - 1} {
+		sum := 0.0
+		for _, layer := range layers {
+			sum += layer.Shares[j]
+		}
+		assert.InDelta(t, 100, sum, 0.1, years[j])
+	}
+	assert.Zero(t, layers[2].Values[0])
+	assert.Greater(t, layers[2].ShareChange(), 15.0)
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/payers", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Equal(t, len(payerLayers), strings.Count(body, "<polygon"))
+	assert.Contains(t, body, ">100%</text>")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/payers?mode=dollars", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), ">100%</text>")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/payers?mode=x", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTreemap(t *testing.T) {
+	bounds := treemapRect{0, 0, 600, 400}
+	areas := []float64{96000, 72000, 48000, 24000}
+	rects := squarify(areas, bounds)
+	assert.Len(t, rects, len(areas))
+	for i, r := range rects {
+		assert.InDelta(t, areas[i], r.w*r.h, 0.01)
+		assert.GreaterOrEqual(t, r.x, bounds.x)
+		assert.GreaterOrEqual(t, r.y, bounds.y)
+		assert.LessOrEqual(t, r.x+r.w, bounds.w+0.01)
+		assert.LessOrEqual(t, r.y+r.h, bounds.h+0.01)
+	}
+
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/treemap", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "Total National Health Expenditures, 2023")
+	assert.Contains(t, body, "Health Insurance")
+	assert.Contains(t, body, "100.0% of total")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/treemap?year=2000&depth=1",
+		nil,
+	))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, strings.Count(w.Body.String(), "<rect"))
+
+	for _, q := range []string{
+		"year=1800",
+		"year=x",
+		"depth=0",
+		"category=no-such-category",
+	} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/treemap?"+q, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, q)
+	}
+}
@@ -0,0 +1,395 @@
+package nhe
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	arrowMagic        = "ARROW1"
+	arrowContinuation = 0xffffffff
+	arrowAlign        = 8
+)
+
+const (
+	arrowMetadataV5 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeInt  = 2
+	arrowTypeUtf8 = 5
+)
+
+func le16(v int) []byte {
+	return binary.LittleEndian.AppendUint16(nil, uint16(v))
+}
+
+func le32(v int) []byte {
+	return binary.LittleEndian.AppendUint32(nil, uint32(v))
+}
+
+func le64(v int64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, uint64(v))
+}
+
+type flatBuilder struct {
+	buf  []byte
+	head int
+}
+
+func (b *flatBuilder) offset() int {
+	return len(b.buf) - b.head
+}
+
+func (b *flatBuilder) prepend(p []byte) {
+	if b.head < len(p) {
+		used := b.offset()
+		grown := make([]byte, max(2*len(b.buf), used+len(p), 64))
+		b.head = len(grown) - used
+		copy(grown[b.head:], b.buf[len(b.buf)-used:])
+		b.buf = grown
+	}
+	b.head -= len(p)
+	copy(b.buf[b.head:], p)
+}
+
+func (b *flatBuilder) align(size, extra int) {
+	if n := (b.offset() + extra) % size; n != 0 {
+		b.prepend(make([]byte, size-n))
+	}
+}
+
+func (b *flatBuilder) uoffset(target int) {
+	b.align(4, 0)
+	b.prepend(le32(b.offset() + 4 - target))
+}
+
+func (b *flatBuilder) str(s string) int {
+	b.align(4, len(s)+1)
+	b.prepend(append([]byte(s), 0))
+	b.prepend(le32(len(s)))
+	return b.offset()
+}
+
+func (b *flatBuilder) offsets(elems []int) int {
+	b.align(4, 4*len(elems))
+	for i := len(elems) - 1; i >= 0; i-- {
+		b.uoffset(elems[i])
+	}
+	b.prepend(le32(len(elems)))
+	return b.offset()
+}
+
+func (b *flatBuilder) structs(elems [][]byte, size int) int {
+	b.align(arrowAlign, size*len(elems))
+	for i := len(elems) - 1; i >= 0; i-- {
+		b.prepend(elems[i])
+	}
+	b.prepend(le32(len(elems)))
+	return b.offset()
+}
+
+type flatField struct {
+	id   int
+	data []byte
+	ref  int
+}
+
+func flatScalar(id int, data []byte) flatField {
+	return flatField{id: id, data: data}
+}
+
+func flatRef(id, ref int) flatField {
+	return flatField{id: id, ref: ref}
+}
+
+func (b *flatBuilder) table(fields ...flatField) int {
+	var (
+		end   = b.offset()
+		pos   = map[int]int{}
+		maxID = -1
+	)
+	for i := len(fields) - 1; i >= 0; i-- {
+		f := fields[i]
+		if f.data == nil {
+			b.uoffset(f.ref)
+		} else {
+			b.align(len(f.data), 0)
+			b.prepend(f.data)
+		}
+		pos[f.id] = b.offset()
+		maxID = max(maxID, f.id)
+	}
+
+	vtLen := 4 + 2*(maxID+1)
+	b.align(4, 0)
+	b.prepend(le32(vtLen))
+	table := b.offset()
+
+	vt := append(le16(vtLen), le16(table-end)...)
+	for id := 0; id <= maxID; id++ {
+		at, ok := pos[id]
+		if !ok {
+			vt = append(vt, le16(0)...)
+			continue
+		}
+		vt = append(vt, le16(table-at)...)
+	}
+	b.prepend(vt)
+	return table
+}
+
+func (b *flatBuilder) finish(root int) []byte {
+	b.align(arrowAlign, 4)
+	b.uoffset(root)
+	return b.buf[b.head:]
+}
+
+type arrowColumn struct {
+	name     string
+	utf8     bool
+	bitWidth int
+	nullable bool
+	length   int
+	nulls    int
+	validity []byte
+	offsets  []byte
+	data     bytes.Buffer
+}
+
+func (c *arrowColumn) mark(valid bool) {
+	if c.length%8 == 0 {
+		c.validity = append(c.validity, 0)
+	}
+	if valid {
+		c.validity[c.length/8] |= 1 << (c.length % 8)
+	} else {
+		c.nulls++
+	}
+	c.length++
+}
+
+func (c *arrowColumn) null() {
+	c.mark(false)
+	c.data.Write(make([]byte, c.bitWidth/8))
+}
+
+func (c *arrowColumn) str(s string) {
+	if c.offsets == nil {
+		c.offsets = le32(0)
+	}
+	c.mark(true)
+	c.data.WriteString(strings.ToValidUTF8(s, "\uFFFD"))
+	c.offsets = append(c.offsets, le32(c.data.Len())...)
+}
+
+func (c *arrowColumn) i32(v int32) {
+	c.mark(true)
+	c.data.Write(le32(int(v)))
+}
+
+func (c *arrowColumn) i64(v int64) {
+	c.mark(true)
+	c.data.Write(le64(v))
+}
+
+func (c *arrowColumn) buffers() [][]byte {
+	validity := c.validity
+	if c.nulls == 0 {
+		validity = nil
+	}
+	if c.utf8 {
+		offsets := c.offsets
+		if offsets == nil {
+			offsets = le32(0)
+		}
+		return [][]byte{validity, offsets, c.data.Bytes()}
+	}
+	return [][]byte{validity, c.data.Bytes()}
+}
+
+func arrowSchema(b *flatBuilder, cols []*arrowColumn) int {
+	fields := make([]int, len(cols))
+	for i, c := range cols {
+		name := b.str(c.name)
+
+		typeID, typ := arrowTypeUtf8, 0
+		if c.utf8 {
+			typ = b.table()
+		} else {
+			typeID = arrowTypeInt
+			typ = b.table(
+				flatScalar(0, le32(c.bitWidth)),
+				flatScalar(1, []byte{1}),
+			)
+		}
+
+		children := b.offsets(nil)
+		nullable := byte(0)
+		if c.nullable {
+			nullable = 1
+		}
+		fields[i] = b.table(
+			flatRef(0, name),
+			flatScalar(1, []byte{nullable}),
+			flatScalar(2, []byte{byte(typeID)}),
+			flatRef(3, typ),
+			flatRef(5, children),
+		)
+	}
+
+	return b.table(
+		flatScalar(0, le16(0)),
+		flatRef(1, b.offsets(fields)),
+	)
+}
+
+func arrowMessage(
+	header byte,
+	build func(*flatBuilder) int,
+	body int,
+) []byte {
+	var b flatBuilder
+	h := build(&b)
+	return b.finish(b.table(
+		flatScalar(0, le16(arrowMetadataV5)),
+		flatScalar(1, []byte{header}),
+		flatRef(2, h),
+		flatScalar(3, le64(int64(body))),
+	))
+}
+
+func arrowPadded(n int) int {
+	return (n + arrowAlign - 1) / arrowAlign * arrowAlign
+}
+
+func arrowRecordBatch(cols []*arrowColumn, rows int) ([]byte, []byte) {
+	var (
+		body    bytes.Buffer
+		nodes   [][]byte
+		buffers [][]byte
+	)
+	for _, c := range cols {
+		nodes = append(nodes, slices.Concat(
+			le64(int64(c.length)),
+			le64(int64(c.nulls)),
+		))
+		for _, buf := range c.buffers() {
+			buffers = append(buffers, slices.Concat(
+				le64(int64(body.Len())),
+				le64(int64(len(buf))),
+			))
+			body.Write(buf)
+			body.Write(make([]byte, arrowPadded(len(buf))-len(buf)))
+		}
+	}
+
+	meta := arrowMessage(arrowHeaderRecordBatch, func(b *flatBuilder) int {
+		return b.table(
+			flatScalar(0, le64(int64(rows))),
+			flatRef(1, b.structs(nodes, 16)),
+			flatRef(2, b.structs(buffers, 16)),
+		)
+	}, body.Len())
+	return meta, body.Bytes()
+}
+
+type arrowBlock struct {
+	offset int
+	meta   int
+	body   int
+}
+
+func writeArrowMessage(out *bytes.Buffer, meta, body []byte) arrowBlock {
+	block := arrowBlock{
+		offset: out.Len(),
+		meta:   8 + len(meta),
+		body:   len(body),
+	}
+	out.Write(le32(arrowContinuation))
+	out.Write(le32(len(meta)))
+	out.Write(meta)
+	out.Write(body)
+	return block
+}
+
+func writeArrow(w io.Writer, cols []*arrowColumn, rows int) error {
+	out := bytes.NewBufferString(arrowMagic + "\x00\x00")
+
+	schema := arrowMessage(arrowHeaderSchema, func(b *flatBuilder) int {
+		return arrowSchema(b, cols)
+	}, 0)
+	writeArrowMessage(out, schema, nil)
+
+	meta, body := arrowRecordBatch(cols, rows)
+	batch := writeArrowMessage(out, meta, body)
+
+	out.Write(le32(arrowContinuation))
+	out.Write(le32(0))
+
+	var b flatBuilder
+	s := arrowSchema(&b, cols)
+	blocks := b.structs([][]byte{slices.Concat(
+		le64(int64(batch.offset)),
+		le32(batch.meta),
+		le32(0),
+		le64(int64(batch.body)),
+	)}, 24)
+	footer := b.finish(b.table(
+		flatScalar(0, le16(arrowMetadataV5)),
+		flatRef(1, s),
+		flatRef(2, b.offsets(nil)),
+		flatRef(3, blocks),
+	))
+
+	out.Write(footer)
+	out.Write(le32(len(footer)))
+	out.WriteString(arrowMagic)
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func writeExpendituresArrow(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	opts QueryOptions,
+) (int, error) {
+	var (
+		category = &arrowColumn{name: "category", utf8: true}
+		parent   = &arrowColumn{name: "parent", utf8: true}
+		year     = &arrowColumn{name: "year", bitWidth: 32}
+		amount   = &arrowColumn{
+			name:     "amount",
+			bitWidth: 64,
+			nullable: true,
+		}
+		rows int
+	)
+
+	err := eachExpenditure(ctx, db, opts, func(e expenditureRow) error {
+		category.str(e.Category)
+		parent.str(e.Parent)
+		year.i32(int32(e.Year))
+		if e.Amount == nil {
+			amount.null()
+		} else {
+			amount.i64(int64(*e.Amount))
+		}
+		rows++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	cols := []*arrowColumn{category, parent, year, amount}
+	return rows, writeArrow(w, cols, rows)
+}
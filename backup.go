@@ -0,0 +1,166 @@
+package nhe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type datasetTable struct {
+	name    string
+	columns []string
+}
+
+var datasetTables = []datasetTable{
+	{
+		name:    "sparklines",
+		columns: []string{"hash", "svg"},
+	},
+	{
+		name:    "years",
+		columns: []string{"id", "year"},
+	},
+	{
+		name: "categories",
+		columns: []string{
+			"id",
+			"name",
+			"parent_id",
+			"indent_level",
+			"sort_order",
+			"is_major_heading",
+			"units",
+			"scale",
+			"sparkline",
+			"source",
+		},
+	},
+	{
+		name: "expenditures",
+		columns: []string{
+			"id",
+			"category_id",
+			"year_id",
+			"amount",
+			"status",
+		},
+	},
+}
+
+func backupPath(dbPath string) string {
+	return dbPath + ".bak"
+}
+
+func backupDatabase(app *App) error {
+	if app.dbPath == "" {
+		return nil
+	}
+
+	empty, err := databaseEmpty(app.db)
+	if err != nil {
+		return err
+	}
+	if empty {
+		return nil
+	}
+
+	var (
+		dst = backupPath(app.dbPath)
+		tmp = dst + ".tmp"
+	)
+
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if _, err := app.db.Exec("VACUUM INTO ?", tmp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+
+	slog.Info("database backed up", "file", dst)
+	return nil
+}
+
+func restoreBackup(db *sql.DB, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(
+		ctx,
+		"ATTACH DATABASE ? AS backup",
+		path,
+	); err != nil {
+		return fmt.Errorf("attach: %w", err)
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE backup")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := len(datasetTables) - 1; i >= 0; i-- {
+		name := datasetTables[i].name
+		q := fmt.Sprintf("DELETE FROM main.%s", name)
+		if _, err := tx.Exec(q); err != nil {
+			return fmt.Errorf("clear %s: %w", name, err)
+		}
+	}
+
+	for _, table := range datasetTables {
+		cols := strings.Join(table.columns, ", ")
+		q := fmt.Sprintf(
+			"INSERT INTO main.%s (%s) SELECT %s FROM backup.%s",
+			table.name,
+			cols,
+			cols,
+			table.name,
+		)
+		if _, err := tx.Exec(q); err != nil {
+			return fmt.Errorf("restore %s: %w", table.name, err)
+		}
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO main.loads (version, source)
+		SELECT version, 'rollback'
+		FROM backup.loads
+		ORDER BY id DESC
+		LIMIT 1
+	`); err != nil {
+		return fmt.Errorf("record rollback: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func rollbackCmd(app *App) error {
+	if app.dbPath == "" {
+		return fmt.Errorf("rollback requires a database file")
+	}
+
+	path := backupPath(app.dbPath)
+	if err := restoreBackup(app.db, path); err != nil {
+		return fmt.Errorf("restore %s: %w", path, err)
+	}
+
+	slog.Info("dataset rolled back", "file", path)
+	return nil
+}
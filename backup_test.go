@@ -0,0 +1,192 @@
+package nhe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupAndRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nhe.db")
+	db, err := openDatabase(path, defaultLockTimeout)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, dbPath: path}
+
+	data, err := parse(t.Context(), "NHE2023.csv", parseOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, loadParsed(t.Context(), db, data))
+
+	assert.NoError(t, backupDatabase(app))
+	assert.NoError(t, clearDatabase(db))
+
+	empty, err := databaseEmpty(db)
+	assert.NoError(t, err)
+	assert.True(t, empty)
+
+	assert.NoError(t, rollbackCmd(app))
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data.Categories), count)
+}
+
+func TestDatasetTablesListEveryColumn(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	for _, table := range datasetTables {
+		rows, err := db.Query(
+			"SELECT name FROM pragma_table_info(?) ORDER BY cid",
+			table.name,
+		)
+		assert.NoError(t, err)
+
+		var cols []string
+		for rows.Next() {
+			var col string
+			assert.NoError(t, rows.Scan(&col))
+			cols = append(cols, col)
+		}
+		assert.NoError(t, rows.Close())
+		assert.Equal(t, cols, table.columns, table.name)
+	}
+}
+
+func TestConcurrentLoadAndServe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nhe.db")
+	serve, err := openDatabase(path, 100*time.Millisecond)
+	assert.NoError(t, err)
+	defer serve.Close()
+
+	data, err := parseReader(t.Context(), bytes.NewReader(fixtureCSV))
+	assert.NoError(t, err)
+	assert.NoError(t, loadParsed(t.Context(), serve, data))
+
+	load, err := openDatabase(path, 100*time.Millisecond)
+	assert.NoError(t, err)
+	defer load.Close()
+
+	tx, err := beginWrite(t.Context(), load)
+	assert.NoError(t, err)
+	assert.NoError(t, clearTables(t.Context(), tx))
+
+	var count int
+	err = serve.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data.Categories), count)
+
+	app := &App{db: serve, dbPath: path}
+	err = reloadParsed(t.Context(), app, data)
+	assert.ErrorContains(t, err, "locked by another writer after waiting 100ms")
+	assert.NoFileExists(t, backupPath(path))
+	assert.NoError(t, tx.Rollback())
+
+	assert.NoError(t, reloadParsed(t.Context(), app, data))
+	assert.FileExists(t, backupPath(path))
+	err = load.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data.Categories), count)
+}
+
+func TestCancelledLoadAndExport(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err = parseReader(ctx, bytes.NewReader(fixtureCSV))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	data, err := parseReader(t.Context(), bytes.NewReader(fixtureCSV))
+	assert.NoError(t, err)
+
+	tx, err := db.BeginTx(t.Context(), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, clearTables(t.Context(), tx))
+	assert.ErrorIs(t, loadTx(ctx, tx, data), context.Canceled)
+	assert.NoError(t, tx.Rollback())
+
+	empty, err := databaseEmpty(db)
+	assert.NoError(t, err)
+	assert.False(t, empty)
+
+	_, err = exportFile(
+		ctx,
+		db,
+		dirStore{},
+		"out.csv",
+		"csv",
+		defaultView(&App{}),
+		QueryOptions{},
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoFileExists(t, "out.csv")
+}
+
+func TestPlugins(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"printf '%s\\n' \"$NHE_CONTEXT\"\n" +
+		"stat -c %a \"$NHE_DB\"\n" +
+		"echo \"$@\"\n"
+	assert.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, "echo"), []byte(script), 0755),
+	)
+	assert.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, "README"), []byte("hi"), 0644),
+	)
+
+	names, err := listPlugins(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"echo"}, names)
+
+	app := &App{db: db}
+	var out bytes.Buffer
+	err = runPlugin(
+		t.Context(),
+		app,
+		dir,
+		"echo",
+		[]string{"a", "b"},
+		&out,
+		io.Discard,
+	)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, []string{"444", "a b"}, lines[1:])
+
+	var pctx PluginContext
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &pctx))
+	assert.Equal(t, "echo", pctx.Name)
+	assert.Equal(t, []string{"a", "b"}, pctx.Args)
+	assert.NotEmpty(t, pctx.Version)
+	assert.NoFileExists(t, pctx.DB)
+
+	for _, name := range []string{"README", "missing", "../echo", ".x"} {
+		err := runPlugin(t.Context(), app, dir, name, nil, &out, io.Discard)
+		assert.Error(t, err, name)
+	}
+}
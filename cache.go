@@ -0,0 +1,271 @@
+package nhe
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	reloadPollInterval = 5 * time.Second
+	viewStaleness      = 30 * time.Second
+	warmCategories     = 10
+	viewCacheSize      = 256
+)
+
+type cacheEntry struct {
+	key   string
+	stamp int64
+	value any
+}
+
+type viewCache struct {
+	mu         sync.Mutex
+	stamp      int64
+	changed    time.Time
+	size       int
+	order      *list.List
+	entries    map[string]*list.Element
+	refreshing map[string]bool
+	refreshes  sync.WaitGroup
+}
+
+func newViewCache() *viewCache {
+	return &viewCache{
+		size:       viewCacheSize,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+		refreshing: map[string]bool{},
+	}
+}
+
+func (c *viewCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+func (c *viewCache) lookup(
+	key string,
+	stamp int64,
+	maxStale time.Duration,
+) (v any, fresh bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stamp != c.stamp {
+		for el := c.order.Front(); el != nil; {
+			next := el.Next()
+			if el.Value.(*cacheEntry).stamp != c.stamp {
+				c.remove(el)
+			}
+			el = next
+		}
+		c.stamp = stamp
+		c.changed = time.Now()
+	}
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, false
+	}
+	c.order.MoveToFront(el)
+
+	e := el.Value.(*cacheEntry)
+	switch {
+	case e.stamp == stamp:
+		return e.value, true, true
+	case maxStale > 0 && time.Since(c.changed) <= maxStale:
+		return e.value, false, true
+	}
+	return nil, false, false
+}
+
+func (c *viewCache) store(key string, stamp int64, v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stamp != c.stamp {
+		return
+	}
+
+	e := &cacheEntry{key: key, stamp: stamp, value: v}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *viewCache) refresh(key string, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshing[key] {
+		return
+	}
+	c.refreshing[key] = true
+	c.refreshes.Add(1)
+
+	go func() {
+		defer c.refreshes.Done()
+		fn()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.refreshing, key)
+	}()
+}
+
+type stalenessKey struct{}
+
+func withStaleness(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, stalenessKey{}, d)
+}
+
+func stalenessFrom(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(stalenessKey{}).(time.Duration)
+	return d
+}
+
+func loadStamp(db *sql.DB) (int64, error) {
+	if !capsOf(db).has("loads", "") {
+		return 0, nil
+	}
+
+	var stamp sql.NullInt64
+	err := db.QueryRow("SELECT MAX(id) FROM loads").Scan(&stamp)
+	return stamp.Int64, err
+}
+
+func cachedView[T any](
+	app *App,
+	key string,
+	compute func() (T, error),
+) (T, error) {
+	return staleView(context.Background(), app, key, compute)
+}
+
+func staleView[T any](
+	ctx context.Context,
+	app *App,
+	key string,
+	compute func() (T, error),
+) (T, error) {
+	var zero T
+
+	stamp, err := loadStamp(app.db)
+	if err != nil {
+		return zero, err
+	}
+
+	v, fresh, ok := app.cache.lookup(key, stamp, stalenessFrom(ctx))
+	if ok && !fresh {
+		app.cache.refresh(key, func() {
+			v, err := compute()
+			if err != nil {
+				slog.Error("refresh view", "key", key, "error", err)
+				return
+			}
+			app.cache.store(key, stamp, v)
+		})
+	}
+	if ok {
+		return v.(T), nil
+	}
+
+	v, err = compute()
+	if err != nil {
+		return zero, err
+	}
+
+	app.cache.store(key, stamp, v)
+	return v.(T), nil
+}
+
+func cachedTableData(
+	ctx context.Context,
+	app *App,
+	view TableView,
+	opts QueryOptions,
+) (*TableData, error) {
+	key := "index:" + view.key() + ":" + opts.key()
+	return staleView(ctx, app, key, func() (*TableData, error) {
+		return nheData(app.db, view, opts)
+	})
+}
+
+func warmViews(app *App) {
+	start := time.Now()
+
+	_, err := cachedTableData(
+		context.Background(),
+		app,
+		defaultView(app),
+		QueryOptions{},
+	)
+	if err != nil {
+		slog.Error("warm index view", "error", err)
+		return
+	}
+
+	refs, err := cachedCategoryRefs(app)
+	if err != nil {
+		slog.Error("warm category refs", "error", err)
+		return
+	}
+
+	_, err = cachedCategoryPage(app, refs, defaultCategoryFilter)
+	if err != nil {
+		slog.Error("warm categories", "error", err)
+		return
+	}
+
+	for _, ref := range refs[:min(len(refs), warmCategories)] {
+		if _, err := cachedCategoryDetail(app, refs, ref); err != nil {
+			slog.Error("warm category", "slug", ref.Slug, "error", err)
+			return
+		}
+	}
+
+	slog.Info("views warmed", "duration", time.Since(start))
+}
+
+func watchReloads(ctx context.Context, app *App, interval time.Duration) {
+	last, err := loadStamp(app.db)
+	if err != nil {
+		slog.Error("read load stamp", "error", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stamp, err := loadStamp(app.db)
+		if err != nil {
+			slog.Error("read load stamp", "error", err)
+			continue
+		}
+
+		if stamp == last {
+			continue
+		}
+
+		last = stamp
+		slog.Info("dataset reloaded", "stamp", stamp)
+		warmViews(app)
+	}
+}
@@ -0,0 +1,140 @@
+package nhe
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedViewInvalidatesOnLoad(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var (
+		app   = &App{db: db, cache: newViewCache()}
+		calls = 0
+	)
+
+	compute := func() (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	v, err := cachedView(app, "k", compute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	v, err = cachedView(app, "k", compute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	_, err = db.Exec(
+		"INSERT INTO loads (version, source) VALUES ('x', 'test')",
+	)
+	assert.NoError(t, err)
+
+	v, err = cachedView(app, "k", compute)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+}
+
+func TestStaleViewRefreshesInBackground(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var (
+		app   = &App{db: db, cache: newViewCache()}
+		ctx   = withStaleness(t.Context(), viewStaleness)
+		calls atomic.Int64
+	)
+
+	compute := func() (int64, error) {
+		return calls.Add(1), nil
+	}
+
+	v, err := staleView(ctx, app, "k", compute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+
+	_, err = db.Exec(
+		"INSERT INTO loads (version, source) VALUES ('x', 'test')",
+	)
+	assert.NoError(t, err)
+
+	v, err = staleView(ctx, app, "k", compute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+
+	app.cache.refreshes.Wait()
+	assert.Equal(t, int64(2), calls.Load())
+
+	v, err = staleView(ctx, app, "k", compute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), v)
+
+	_, err = db.Exec(
+		"INSERT INTO loads (version, source) VALUES ('y', 'test')",
+	)
+	assert.NoError(t, err)
+	stamp, err := loadStamp(db)
+	assert.NoError(t, err)
+
+	_, fresh, ok := app.cache.lookup("k", stamp, viewStaleness)
+	assert.True(t, ok)
+	assert.False(t, fresh)
+
+	app.cache.changed = app.cache.changed.Add(-2 * viewStaleness)
+	_, _, ok = app.cache.lookup("k", stamp, viewStaleness)
+	assert.False(t, ok)
+
+	v, err = staleView(t.Context(), app, "k", compute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+}
+
+func TestWarmViews(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	warmViews(app)
+
+	stamp, err := loadStamp(db)
+	assert.NoError(t, err)
+	refs, err := cachedCategoryRefs(app)
+	assert.NoError(t, err)
+
+	keys := []string{"category-refs", "categories"}
+	for _, ref := range refs[:warmCategories] {
+		keys = append(keys, "category:"+strconv.Itoa(ref.ID))
+	}
+	for _, key := range keys {
+		_, fresh, ok := app.cache.lookup(key, stamp, 0)
+		assert.True(t, ok && fresh, key)
+	}
+}
+
+func TestViewCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newViewCache()
+	c.size = 2
+
+	c.store("a", 0, 1)
+	c.store("b", 0, 2)
+	_, _, ok := c.lookup("a", 0, 0)
+	assert.True(t, ok)
+
+	c.store("c", 0, 3)
+	assert.Len(t, c.entries, 2)
+
+	_, _, ok = c.lookup("b", 0, 0)
+	assert.False(t, ok)
+	for _, key := range []string{"a", "c"} {
+		_, _, ok = c.lookup(key, 0, 0)
+		assert.True(t, ok, key)
+	}
+}
@@ -0,0 +1,156 @@
+package nhe
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type storeCaps struct {
+	columns map[string]map[string]bool
+}
+
+var storeFeatures = []struct {
+	feature string
+	table   string
+	column  string
+}{
+	{"units and scale", "categories", "units"},
+	{"units and scale", "categories", "scale"},
+	{"cell status", "expenditures", "status"},
+	{"sparklines", "categories", "sparkline"},
+	{"user series", "categories", "source"},
+	{"annotations", "annotations", ""},
+	{"saved views", "saved_views", ""},
+	{"load history", "loads", ""},
+	{"source notes", "load_notes", ""},
+}
+
+var storeCapsByDB sync.Map
+
+func detectCaps(db *sql.DB) (storeCaps, error) {
+	rows, err := db.Query(`
+		SELECT m.name, p.name
+		FROM sqlite_master m
+		JOIN pragma_table_info(m.name) p
+		WHERE m.type = 'table'
+	`)
+	if err != nil {
+		return storeCaps{}, err
+	}
+	defer rows.Close()
+
+	caps := storeCaps{columns: map[string]map[string]bool{}}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return storeCaps{}, err
+		}
+		if caps.columns[table] == nil {
+			caps.columns[table] = map[string]bool{}
+		}
+		caps.columns[table][column] = true
+	}
+	return caps, rows.Err()
+}
+
+func capsOf(db *sql.DB) storeCaps {
+	if v, ok := storeCapsByDB.Load(db); ok {
+		return v.(storeCaps)
+	}
+
+	caps, err := detectCaps(db)
+	if err != nil {
+		slog.Warn("detect schema capabilities", "error", err)
+		return storeCaps{}
+	}
+	storeCapsByDB.Store(db, caps)
+	return caps
+}
+
+func forgetCaps(db *sql.DB) {
+	storeCapsByDB.Delete(db)
+}
+
+func logDegraded(db *sql.DB) {
+	caps := capsOf(db)
+
+	seen := map[string]bool{}
+	for _, f := range storeFeatures {
+		if seen[f.feature] || caps.has(f.table, f.column) {
+			continue
+		}
+		seen[f.feature] = true
+		slog.Warn(
+			"schema predates feature; degrading",
+			"feature", f.feature,
+			"table", f.table,
+			"column", f.column,
+		)
+	}
+}
+
+func (c storeCaps) has(table, column string) bool {
+	if c.columns == nil {
+		return true
+	}
+	cols, ok := c.columns[table]
+	if column == "" {
+		return ok
+	}
+	return cols[column]
+}
+
+func (c storeCaps) units(alias string) string {
+	if c.has("categories", "units") {
+		return alias + ".units"
+	}
+	return fmt.Sprintf(
+		"CASE WHEN %s.name = 'POPULATION' THEN '%s' ELSE '%s' END",
+		alias,
+		unitsPersons,
+		unitsUSD,
+	)
+}
+
+func (c storeCaps) scale(alias string) string {
+	if c.has("categories", "scale") {
+		return alias + ".scale"
+	}
+	return "1000000"
+}
+
+func (c storeCaps) sparkline(alias string) string {
+	if c.has("categories", "sparkline") {
+		return alias + ".sparkline"
+	}
+	return "''"
+}
+
+func (c storeCaps) source(alias string) string {
+	if c.has("categories", "source") {
+		return alias + ".source"
+	}
+	return "'" + SourceOfficial + "'"
+}
+
+func (c storeCaps) status(alias string) string {
+	if c.has("expenditures", "status") {
+		return alias + ".status"
+	}
+	return fmt.Sprintf(
+		"CASE WHEN %s.amount IS NULL THEN '%s' ELSE '%s' END",
+		alias,
+		CellNoData,
+		CellValue,
+	)
+}
+
+func isReadOnly(err error) bool {
+	var se sqlite3.Error
+	return errors.As(err, &se) && se.Code == sqlite3.ErrReadonly
+}
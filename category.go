@@ -0,0 +1,150 @@
+package nhe
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type CategoryDetail struct {
+	CategoryRef
+	Units    string
+	Scale    int64
+	Parent   *CategoryRef
+	Children []CategoryRef
+	Years    []CategoryYear
+	Theme    Theme
+	Figures  FigureStyle
+}
+
+type CategoryYear struct {
+	Year   int
+	Amount *int
+	Status CellStatus
+	Growth *float64
+	Share  *float64
+}
+
+func (p CategoryDetail) Format(y CategoryYear) string {
+	switch y.Status {
+	case CellNoData:
+		return "—"
+	case CellSuppressed:
+		return formatScaled(new(int), p.Units, p.Scale)
+	}
+	return formatScaled(y.Amount, p.Units, p.Scale)
+}
+
+func (p CategoryDetail) Latest() *CategoryYear {
+	for i, y := range p.Years {
+		if y.Amount != nil && y.Status != CellNoData {
+			return &p.Years[i]
+		}
+	}
+	return nil
+}
+
+func (p CategoryDetail) Headline(y CategoryYear) string {
+	return formatFigure(p.Figures, y.Amount, p.Units, p.Scale)
+}
+
+func categoryDetail(
+	db *sql.DB,
+	refs []CategoryRef,
+	ref CategoryRef,
+) (*CategoryDetail, error) {
+	cs, err := categorySeries(db, ref.ID)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", ref.Slug, err)
+	}
+
+	page := &CategoryDetail{
+		CategoryRef: ref,
+		Units:       cs.Units,
+		Scale:       cs.Scale,
+	}
+
+	var total []SeriesPoint
+	for _, r := range refs {
+		if ref.ParentID != nil && r.ID == *ref.ParentID {
+			page.Parent = &r
+		}
+		if r.ParentID != nil && *r.ParentID == ref.ID {
+			page.Children = append(page.Children, r)
+		}
+		if r.Name == totalCategory && r.ParentID == nil && total == nil {
+			ts, err := categorySeries(db, r.ID)
+			if err != nil {
+				return nil, fmt.Errorf("load total: %w", err)
+			}
+			total = ts.Series
+		}
+	}
+
+	for i, p := range cs.Series {
+		y := CategoryYear{
+			Year:   p.Year,
+			Amount: p.Amount,
+			Status: p.Status,
+			Growth: metricValue(MetricGrowth, cs.Series, total, i),
+		}
+		if cs.Units == unitsUSD && total != nil {
+			y.Share = metricValue(MetricShare, cs.Series, total, i)
+		}
+		page.Years = append(page.Years, y)
+	}
+	slices.Reverse(page.Years)
+
+	return page, nil
+}
+
+func cachedCategoryDetail(
+	app *App,
+	refs []CategoryRef,
+	ref CategoryRef,
+) (*CategoryDetail, error) {
+	key := "category:" + strconv.Itoa(ref.ID)
+	return cachedView(app, key, func() (*CategoryDetail, error) {
+		return categoryDetail(app.db, refs, ref)
+	})
+}
+
+func categoryDetailHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		figures, err := parseFigureStyle(r.URL.Query().Get("figures"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		refs, err := cachedCategoryRefs(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		ref, ok := findCategoryRefByID(refs, id)
+		if err != nil || !ok {
+			renderNotFound(w, r, app, tmpl, r.PathValue("id"))
+			return
+		}
+
+		detail, err := cachedCategoryDetail(app, refs, ref)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		page := *detail
+		page.Theme = requestTheme(r)
+		page.Figures = figures
+		renderPage(w, r, tmpl, "category.html", page)
+	}
+}
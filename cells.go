@@ -0,0 +1,67 @@
+package nhe
+
+import "slices"
+
+type CellStatus string
+
+const (
+	CellValue      CellStatus = "value"
+	CellNoData     CellStatus = "no_data"
+	CellSuppressed CellStatus = "suppressed"
+)
+
+var (
+	noDataMarkers     = []string{"", "-", "--", "—", "\x97"}
+	suppressedMarkers = []string{"*", "(*)", "Z", "(Z)", "(D)", "(S)"}
+)
+
+func classifyCell(val string) (CellStatus, bool) {
+	switch {
+	case slices.Contains(noDataMarkers, val):
+		return CellNoData, true
+	case slices.Contains(suppressedMarkers, val):
+		return CellSuppressed, true
+	}
+	return CellValue, false
+}
+
+func cellStatus(amount *int, suppressed bool) CellStatus {
+	switch {
+	case amount == nil:
+		return CellNoData
+	case suppressed:
+		return CellSuppressed
+	}
+	return CellValue
+}
+
+func toFiscalStatus(years []int, status []CellStatus) []CellStatus {
+	var fy []CellStatus
+	for i := 1; i < len(years); i++ {
+		if years[i-1] != years[i]-1 {
+			continue
+		}
+
+		prev, cur := status[i-1], status[i]
+		switch {
+		case prev == CellNoData || cur == CellNoData:
+			fy = append(fy, CellNoData)
+		case prev == CellSuppressed || cur == CellSuppressed:
+			fy = append(fy, CellSuppressed)
+		default:
+			fy = append(fy, CellValue)
+		}
+	}
+	return fy
+}
+
+func basisStatus(
+	basis YearBasis,
+	years []int,
+	status []CellStatus,
+) []CellStatus {
+	if basis != FiscalYears {
+		return status
+	}
+	return toFiscalStatus(years, status)
+}
@@ -0,0 +1,440 @@
+package nhe
+
+import (
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	chartWidth  = 640
+	chartHeight = 320
+	chartLeft   = 64
+	chartRight  = 16
+	chartTop    = 16
+	chartBottom = 32
+	chartGrid   = 4
+	chartGlyph  = 2
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartAxis       = color.RGBA{0x6b, 0x72, 0x80, 0xff}
+	chartGridLine   = color.RGBA{0xe5, 0xe7, 0xeb, 0xff}
+	chartLine       = color.RGBA{0x25, 0x63, 0xeb, 0xff}
+	chartText       = color.RGBA{0x37, 0x41, 0x51, 0xff}
+)
+
+var chartFont = map[rune][5]string{
+	'0':  {"###", "#.#", "#.#", "#.#", "###"},
+	'1':  {".#.", "##.", ".#.", ".#.", "###"},
+	'2':  {"###", "..#", "###", "#..", "###"},
+	'3':  {"###", "..#", "###", "..#", "###"},
+	'4':  {"#.#", "#.#", "###", "..#", "..#"},
+	'5':  {"###", "#..", "###", "..#", "###"},
+	'6':  {"###", "#..", "###", "#.#", "###"},
+	'7':  {"###", "..#", "..#", "..#", "..#"},
+	'8':  {"###", "#.#", "###", "#.#", "###"},
+	'9':  {"###", "#.#", "###", "..#", "###"},
+	'.':  {"...", "...", "...", "...", ".#."},
+	'-':  {"...", "...", "###", "...", "..."},
+	'%':  {"#.#", "..#", ".#.", "#..", "#.#"},
+	'$':  {".##", "##.", ".#.", ".##", "##."},
+	'K':  {"#.#", "##.", "#..", "##.", "#.#"},
+	'M':  {"#.#", "###", "###", "#.#", "#.#"},
+	'B':  {"##.", "#.#", "##.", "#.#", "##."},
+	'T':  {"###", ".#.", ".#.", ".#.", ".#."},
+	',':  {"...", "...", "...", ".#.", "#.."},
+	'\'': {".#.", ".#.", "...", "...", "..."},
+}
+
+type chartPoint struct {
+	year  int
+	value *float64
+}
+
+func chartPoints(cs *CategorySeries) []chartPoint {
+	points := make([]chartPoint, len(cs.Series))
+	for i, p := range cs.Series {
+		points[i].year = p.Year
+		if cs.Metric != "" {
+			points[i].value = p.Value
+			continue
+		}
+		if p.Amount != nil {
+			v := float64(*p.Amount) * float64(cs.Scale)
+			points[i].value = &v
+		}
+	}
+	return points
+}
+
+func chartLabel(v float64, cs *CategorySeries, loc LabelLocale) string {
+	if cs.Metric != "" {
+		return loc.Number(v, 1) + "%"
+	}
+	return loc.Compact(v, 1)
+}
+
+type chartCanvas struct {
+	*image.RGBA
+}
+
+func (c chartCanvas) rect(x0, y0, x1, y1 int, col color.RGBA) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			c.SetRGBA(x, y, col)
+		}
+	}
+}
+
+func (c chartCanvas) line(x0, y0, x1, y1 int, col color.RGBA) {
+	var (
+		dx  = abs(x1 - x0)
+		dy  = -abs(y1 - y0)
+		sx  = sign(x1 - x0)
+		sy  = sign(y1 - y0)
+		err = dx + dy
+	)
+	for {
+		c.rect(x0, y0, x0+2, y0+2, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			x0 += sx
+		} else {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func (c chartCanvas) text(x, y int, s string, col color.RGBA) {
+	for _, r := range s {
+		glyph := chartFont[r]
+		for row, bits := range glyph {
+			for i, bit := range bits {
+				if bit != '#' {
+					continue
+				}
+				px := x + i*chartGlyph
+				py := y + row*chartGlyph
+				c.rect(px, py, px+chartGlyph, py+chartGlyph, col)
+			}
+		}
+		x += 4 * chartGlyph
+	}
+}
+
+func textWidth(s string) int {
+	return len(s)*4*chartGlyph - chartGlyph
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+type chartLayout struct {
+	points []chartPoint
+	lo     float64
+	hi     float64
+	plotW  int
+	plotH  int
+}
+
+func newChartLayout(cs *CategorySeries) chartLayout {
+	l := chartLayout{
+		points: chartPoints(cs),
+		plotW:  chartWidth - chartLeft - chartRight,
+		plotH:  chartHeight - chartTop - chartBottom,
+	}
+	for _, p := range l.points {
+		if p.value != nil {
+			l.lo = min(l.lo, *p.value)
+			l.hi = max(l.hi, *p.value)
+		}
+	}
+	if l.hi == l.lo {
+		l.hi = l.lo + 1
+	}
+	return l
+}
+
+func (l chartLayout) x(i int) int {
+	return chartLeft + i*l.plotW/max(len(l.points)-1, 1)
+}
+
+func (l chartLayout) y(v float64) int {
+	return chartTop + l.plotH - int((v-l.lo)/(l.hi-l.lo)*float64(l.plotH))
+}
+
+func (l chartLayout) grid() []float64 {
+	values := make([]float64, chartGrid+1)
+	for i := range values {
+		values[i] = l.lo + (l.hi-l.lo)*float64(i)/chartGrid
+	}
+	return values
+}
+
+func (l chartLayout) ticks() []int {
+	var (
+		ticks []int
+		n     = len(l.points)
+		last  = l.x(n - 1)
+	)
+	for i, p := range l.points {
+		label := l.tickLabel(i)
+		if i != 0 && i != n-1 {
+			if p.year%10 != 0 || last-l.x(i) < textWidth(label)+8 {
+				continue
+			}
+		}
+		ticks = append(ticks, i)
+	}
+	return ticks
+}
+
+func (l chartLayout) tickLabel(i int) string {
+	year := l.points[i].year
+	if i == 0 || i == len(l.points)-1 {
+		return strconv.Itoa(year)
+	}
+	return shortYear(year)
+}
+
+func (l chartLayout) segments() [][]int {
+	var (
+		segments [][]int
+		run      []int
+	)
+	for i, p := range l.points {
+		if p.value == nil {
+			if len(run) > 1 {
+				segments = append(segments, run)
+			}
+			run = nil
+			continue
+		}
+		run = append(run, i)
+	}
+	if len(run) > 1 {
+		segments = append(segments, run)
+	}
+	return segments
+}
+
+func renderChart(cs *CategorySeries, loc LabelLocale) *image.RGBA {
+	var (
+		img  = image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+		c    = chartCanvas{img}
+		l    = newChartLayout(cs)
+		base = chartTop + l.plotH
+	)
+	c.rect(0, 0, chartWidth, chartHeight, chartBackground)
+
+	for _, v := range l.grid() {
+		y := l.y(v)
+		c.rect(chartLeft, y, chartWidth-chartRight, y+1, chartGridLine)
+		label := chartLabel(v, cs, loc)
+		c.text(
+			chartLeft-8-textWidth(label),
+			y-5*chartGlyph/2,
+			label,
+			chartText,
+		)
+	}
+
+	c.rect(chartLeft, chartTop, chartLeft+1, base+1, chartAxis)
+	c.rect(chartLeft, base, chartWidth-chartRight, base+1, chartAxis)
+
+	for _, i := range l.ticks() {
+		x := l.x(i)
+		label := l.tickLabel(i)
+		c.rect(x, base, x+1, base+4, chartAxis)
+		c.text(x-textWidth(label)/2, base+8, label, chartText)
+	}
+
+	for _, run := range l.segments() {
+		for k := 1; k < len(run); k++ {
+			a, b := run[k-1], run[k]
+			c.line(
+				l.x(a),
+				l.y(*l.points[a].value),
+				l.x(b),
+				l.y(*l.points[b].value),
+				chartLine,
+			)
+		}
+	}
+	return img
+}
+
+type chartSVG struct {
+	Width  int
+	Height int
+	Title  string
+	Grid   []svgMark
+	Axes   []svgRect
+	Ticks  []svgMark
+	Stroke string
+	Lines  []string
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func chartAxes(plotW, plotH int) []svgRect {
+	axis := hexColor(chartAxis)
+	return []svgRect{
+		{X: chartLeft, Y: chartTop, W: 1, H: plotH + 1, Fill: axis},
+		{X: chartLeft, Y: chartTop + plotH, W: plotW, H: 1, Fill: axis},
+	}
+}
+
+func chartGridLabel(y int, label string) *svgText {
+	return &svgText{
+		X:      chartLeft - 8,
+		Y:      y + 4,
+		Anchor: "end",
+		Fill:   hexColor(chartText),
+		Text:   label,
+	}
+}
+
+func chartTick(x, base int, label string) svgMark {
+	return svgMark{
+		Rect: &svgRect{X: x, Y: base, W: 1, H: 4, Fill: hexColor(chartAxis)},
+		Label: &svgText{
+			X:      x,
+			Y:      base + 18,
+			Anchor: "middle",
+			Fill:   hexColor(chartText),
+			Text:   label,
+		},
+	}
+}
+
+func renderChartSVG(
+	cs *CategorySeries,
+	loc LabelLocale,
+) (string, error) {
+	var (
+		l   = newChartLayout(cs)
+		svg = chartSVG{
+			Width:  chartWidth,
+			Height: chartHeight,
+			Title:  cs.Name,
+			Axes:   chartAxes(l.plotW, l.plotH),
+			Stroke: hexColor(chartLine),
+		}
+	)
+
+	for _, v := range l.grid() {
+		y := l.y(v)
+		svg.Grid = append(svg.Grid, svgMark{
+			Rect: &svgRect{
+				X:    chartLeft,
+				Y:    y,
+				W:    l.plotW,
+				H:    1,
+				Fill: hexColor(chartGridLine),
+			},
+			Label: chartGridLabel(y, chartLabel(v, cs, loc)),
+		})
+	}
+
+	for _, i := range l.ticks() {
+		svg.Ticks = append(
+			svg.Ticks,
+			chartTick(l.x(i), chartTop+l.plotH, l.tickLabel(i)),
+		)
+	}
+
+	for _, run := range l.segments() {
+		points := make([]string, len(run))
+		for k, i := range run {
+			points[k] = fmt.Sprintf(
+				"%d,%d",
+				l.x(i),
+				l.y(*l.points[i].value),
+			)
+		}
+		svg.Lines = append(svg.Lines, strings.Join(points, " "))
+	}
+
+	return renderSVG("chart", svg)
+}
+
+func chartHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug, ok := strings.CutSuffix(r.PathValue("slug"), ".png")
+		if !ok {
+			renderNotFound(w, r, app, tmpl, slug)
+			return
+		}
+
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		start := time.Now()
+		ref, ok, err := cachedCategoryRef(app, slug)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			renderNotFound(w, r, app, tmpl, slug)
+			return
+		}
+
+		db, done, err := datasetDB(app, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		defer done()
+
+		cs, err := optionSeries(db, ref.ID, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set(
+			"Content-Disposition",
+			fmt.Sprintf(`inline; filename="%s.png"`, path.Base(slug)),
+		)
+		if err := png.Encode(w, renderChart(cs, requestLocale(r))); err != nil {
+			slog.Error("write chart", "slug", slug, "error", err)
+		}
+	}
+}
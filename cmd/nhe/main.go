@@ -0,0 +1,7 @@
+package main
+
+import "github.com/tqbf/nhe"
+
+func main() {
+	nhe.Main()
+}
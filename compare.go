@@ -0,0 +1,167 @@
+package nhe
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const compareSpan = 4
+
+type CompareRow struct {
+	TableCategory
+	From  *int
+	To    *int
+	Delta *int
+	Pct   *float64
+}
+
+type ComparePage struct {
+	Basis     YearBasis
+	From      int
+	To        int
+	Available []int
+	Rows      []CompareRow
+	Theme     Theme
+}
+
+func (r CompareRow) Change() string {
+	if r.Delta == nil {
+		return "—"
+	}
+	if *r.Delta < 0 {
+		abs := -*r.Delta
+		return "-" + r.Format(&abs)
+	}
+	return "+" + r.Format(r.Delta)
+}
+
+func (r CompareRow) PctChange() string {
+	if r.Pct == nil {
+		return "—"
+	}
+	return fmt.Sprintf("%+.1f%%", *r.Pct)
+}
+
+func compareYears(q url.Values, years []int) (int, int, error) {
+	if len(years) == 0 {
+		return 0, 0, badQuery("no years loaded")
+	}
+
+	var (
+		to   = years[len(years)-1]
+		from = years[max(0, len(years)-1-compareSpan)]
+		err  error
+	)
+	if v := q.Get("a"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil {
+			return 0, 0, badQuery("invalid year %q", v)
+		}
+	}
+	if v := q.Get("b"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			return 0, 0, badQuery("invalid year %q", v)
+		}
+	}
+
+	for _, year := range []int{from, to} {
+		if !slices.Contains(years, year) {
+			return 0, 0, badQuery("no data for year %d", year)
+		}
+	}
+	if from == to {
+		return 0, 0, badQuery("pick two different years")
+	}
+	return from, to, nil
+}
+
+func compareRow(cat TableCategory, a, b int) CompareRow {
+	cat.Values = []*int{cat.Values[a], cat.Values[b]}
+	cat.Status = []CellStatus{cat.Status[a], cat.Status[b]}
+	if cat.Previous != nil {
+		cat.Previous = []*int{cat.Previous[a], cat.Previous[b]}
+	}
+	row := CompareRow{
+		TableCategory: cat,
+		From:          cat.Values[0],
+		To:            cat.Values[1],
+	}
+	if row.From == nil || row.To == nil {
+		return row
+	}
+
+	delta := *row.To - *row.From
+	row.Delta = &delta
+	if *row.From != 0 {
+		pct := float64(delta) / float64(*row.From) * 100
+		row.Pct = &pct
+	}
+	return row
+}
+
+func compareHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		view, err := tableView(app, q)
+		if err != nil {
+			writeReadError(w, badQuery("%v", err))
+			return
+		}
+
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		start := time.Now()
+		all, err := queryYears(app.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		years := basisYears(view.Basis, all)
+
+		from, to, err := compareYears(q, years)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		view.Years, err = parseYearStrategy(
+			fmt.Sprintf("milestones:%d,%d", from, to),
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data, err := tableData(r.Context(), app, app.db, view, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		page := ComparePage{
+			Basis:     view.Basis,
+			From:      from,
+			To:        to,
+			Available: years,
+			Theme:     requestTheme(r),
+		}
+		var (
+			a = slices.Index(data.Years, from)
+			b = slices.Index(data.Years, to)
+		)
+		for _, cat := range data.Categories {
+			page.Rows = append(page.Rows, compareRow(cat, a, b))
+		}
+
+		renderPage(w, r, tmpl, "compare.html", page)
+	}
+}
@@ -0,0 +1,170 @@
+package nhe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+type configCheck struct {
+	problems []string
+}
+
+func (cc *configCheck) require(ok bool, problem, hint string) {
+	if ok {
+		return
+	}
+	cc.problems = append(cc.problems, fmt.Sprintf("%s: %s", problem, hint))
+}
+
+func (cc *configCheck) err() error {
+	if len(cc.problems) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration (%d problems):", len(cc.problems))
+	for _, p := range cc.problems {
+		fmt.Fprintf(&b, "\n  - %s", p)
+	}
+	return errors.New(b.String())
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func validateGlobal(c *cli.Context) error {
+	var (
+		cc        configCheck
+		ephemeral = c.Bool("ephemeral")
+		command   = c.Args().First()
+	)
+
+	cc.require(
+		!(ephemeral && c.IsSet("db")),
+		"--db is ignored with --ephemeral",
+		"drop --db or --ephemeral",
+	)
+
+	cc.require(
+		!(ephemeral && c.Bool("force-load")),
+		"--force-load has no effect with --ephemeral",
+		"the in-memory database is always freshly loaded",
+	)
+
+	if !ephemeral {
+		dir := filepath.Dir(c.String("db"))
+		cc.require(
+			fileExists(dir),
+			fmt.Sprintf("database directory %q does not exist", dir),
+			"create it or point --db somewhere else",
+		)
+	}
+
+	cc.require(
+		slices.Contains(inputFormats, c.String("input-format")),
+		fmt.Sprintf("unknown --input-format %q", c.String("input-format")),
+		"use auto, csv, or tsv",
+	)
+
+	cc.require(
+		slices.Contains(duplicatePolicies, c.String("duplicates")),
+		fmt.Sprintf("unknown --duplicates %q", c.String("duplicates")),
+		"use first-wins, last-wins, or error",
+	)
+
+	needsCSV := !ephemeral &&
+		(c.Bool("force-load") || (command == "load" && c.Args().Len() == 1))
+	if needsCSV {
+		cc.require(
+			fileExists(csvFilename),
+			fmt.Sprintf("CSV file %q not found", csvFilename),
+			"set NHE_CSV to the path of the CMS NHE CSV",
+		)
+	}
+
+	cc.require(
+		!(ephemeral && command == "rollback"),
+		"rollback needs a database file",
+		"run rollback without --ephemeral",
+	)
+
+	return cc.err()
+}
+
+func validateServe(c *cli.Context) error {
+	var cc configCheck
+
+	cc.require(
+		c.Int("export-row-limit") >= 0,
+		"--export-row-limit must not be negative",
+		"use 0 to disable the limit",
+	)
+
+	cc.require(
+		c.Duration("view-budget") >= 0,
+		"--view-budget must not be negative",
+		"use 0 to disable slow-view logging",
+	)
+
+	cc.require(
+		c.Int("log-sample-after") >= 0,
+		"--log-sample-after must not be negative",
+		"use 0 to log every request",
+	)
+
+	rate := c.Float64("log-sample-rate")
+	cc.require(
+		rate >= 0 && rate <= 1,
+		"--log-sample-rate must be between 0 and 1",
+		"use 0.1 to keep one in ten requests past the threshold",
+	)
+
+	cc.require(
+		c.Float64("trend-threshold") > 0,
+		"--trend-threshold must be positive",
+		"use 10 to mark changes of 10% a year or more",
+	)
+
+	cc.require(
+		c.Int("job-workers") >= 1,
+		"--job-workers must be at least 1",
+		"use 1 to run jobs one at a time",
+	)
+
+	_, ok := templateSets[c.String("templates")]
+	cc.require(
+		ok,
+		fmt.Sprintf("--templates: unknown set %q", c.String("templates")),
+		"use default or minimal",
+	)
+
+	_, err := parseBasePath(c.String("base-path"))
+	cc.require(
+		err == nil,
+		fmt.Sprintf("--base-path: %v", err),
+		"use an absolute path like /nhe",
+	)
+
+	_, err = parseYearStrategy(c.String("years"))
+	cc.require(
+		err == nil,
+		fmt.Sprintf("--years: %v", err),
+		"use every[:N], milestones:Y1,Y2,..., or decades",
+	)
+
+	cc.require(
+		!(c.String("export-key") != "" && c.Int("export-row-limit") == 0),
+		"--export-key has no effect when --export-row-limit is 0",
+		"set a row limit or drop the key",
+	)
+
+	return cc.err()
+}
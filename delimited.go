@@ -0,0 +1,95 @@
+package nhe
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	InputAuto = "auto"
+	InputCSV  = "csv"
+	InputTSV  = "tsv"
+)
+
+const sniffBytes = 4096
+
+var inputFormats = []string{InputAuto, InputCSV, InputTSV}
+
+const (
+	DuplicatesFirst = "first-wins"
+	DuplicatesLast  = "last-wins"
+	DuplicatesError = "error"
+)
+
+var duplicatePolicies = []string{
+	DuplicatesFirst,
+	DuplicatesLast,
+	DuplicatesError,
+}
+
+type parseOptions struct {
+	format     string
+	duplicates string
+}
+
+func (o parseOptions) duplicatePolicy() string {
+	return cmp.Or(o.duplicates, DuplicatesFirst)
+}
+
+func fileInputFormat(format, filename string) string {
+	if format == InputCSV || format == InputTSV {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tsv", ".tab":
+		return InputTSV
+	}
+	return InputAuto
+}
+
+func sniffDelimiter(br *bufio.Reader) rune {
+	head, _ := br.Peek(sniffBytes)
+	lines := bytes.SplitN(head, []byte("\n"), 3)
+	row := lines[min(1, len(lines)-1)]
+	if bytes.Count(row, []byte("\t")) > bytes.Count(row, []byte(",")) {
+		return '\t'
+	}
+	return ','
+}
+
+func inputDelimiter(format string, br *bufio.Reader) rune {
+	switch format {
+	case InputCSV:
+		return ','
+	case InputTSV:
+		return '\t'
+	}
+	return sniffDelimiter(br)
+}
+
+type delimitedFormat struct {
+	comma rune
+	mime  string
+	ext   string
+}
+
+var (
+	csvFormat = delimitedFormat{
+		comma: ',',
+		mime:  "text/csv; charset=utf-8",
+		ext:   "csv",
+	}
+	tsvFormat = delimitedFormat{
+		comma: '\t',
+		mime:  "text/tab-separated-values; charset=utf-8",
+		ext:   "tsv",
+	}
+)
+
+var delimitedFormats = map[string]delimitedFormat{
+	csvFormat.ext: csvFormat,
+	tsvFormat.ext: tsvFormat,
+}
@@ -0,0 +1,89 @@
+package nhe
+
+import "fmt"
+
+const (
+	fiscalPriorWeight   = 0.25
+	fiscalCurrentWeight = 1 - fiscalPriorWeight
+)
+
+type Derivation struct {
+	Field   string   `json:"field"`
+	Formula string   `json:"formula"`
+	Inputs  []string `json:"inputs"`
+}
+
+var fiscalDerivation = Derivation{
+	Field: "categories[].values",
+	Formula: fmt.Sprintf(
+		"round(%g * amount[year-1] + %g * amount[year])",
+		fiscalPriorWeight,
+		fiscalCurrentWeight,
+	),
+	Inputs: []string{
+		"calendar-year amount for year-1",
+		"calendar-year amount for year",
+	},
+}
+
+var regimeDerivations = []Derivation{
+	{
+		Field: "categories[].periods[].avg_growth",
+		Formula: "mean((amount[y] - amount[y-1]) / amount[y-1] * 100) " +
+			"for each year y in the period with y-1 present",
+		Inputs: []string{"calendar-year amounts from the category series"},
+	},
+	{
+		Field: "categories[].periods[].std_dev",
+		Formula: "sqrt(sum((growth - avg_growth)^2) / (years - 1)) " +
+			"over the same annual growth rates",
+		Inputs: []string{"annual growth rates", "avg_growth", "years"},
+	},
+	{
+		Field:   "categories[].changes[].delta",
+		Formula: "avg_growth[to] - avg_growth[from]",
+		Inputs:  []string{"avg_growth of both periods"},
+	},
+	{
+		Field: "categories[].changes[].t",
+		Formula: "delta / sqrt(std_dev[from]^2 / years[from] + " +
+			"std_dev[to]^2 / years[to])",
+		Inputs: []string{"delta", "std_dev and years of both periods"},
+	},
+	{
+		Field:   "categories[].changes[].significant",
+		Formula: fmt.Sprintf("abs(t) >= %g", regimeSignificanceT),
+		Inputs:  []string{"t"},
+	},
+}
+
+func metricDerivations(metric, field string) []Derivation {
+	switch metric {
+	case MetricShare:
+		return []Derivation{{
+			Field:   field,
+			Formula: "amount[year] / total[year] * 100",
+			Inputs: []string{
+				"category amount for year",
+				totalCategory + " amount for year",
+			},
+		}}
+	case MetricGrowth:
+		return []Derivation{{
+			Field:   field,
+			Formula: "(amount[year] - amount[year-1]) / amount[year-1] * 100",
+			Inputs: []string{
+				"category amount for year-1",
+				"category amount for year",
+			},
+		}}
+	}
+	return nil
+}
+
+func tableDerivations(basis YearBasis) []Derivation {
+	if basis != FiscalYears {
+		return nil
+	}
+	return []Derivation{fiscalDerivation}
+}
@@ -0,0 +1,159 @@
+package nhe
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	DiffRevised = "revised"
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffRenamed = "renamed"
+)
+
+type DiffCell struct {
+	Kind    string
+	Old     *int
+	New     *int
+	Problem string
+}
+
+type DiffRow struct {
+	Category string
+	Cells    []*DiffCell
+}
+
+type DiffReport struct {
+	Base   string
+	Source string
+	Years  []int
+	Rows   []DiffRow
+	Counts map[string]int
+}
+
+func diffKind(m Mismatch) string {
+	switch m.Problem {
+	case "missing":
+		return DiffAdded
+	case "not in CSV":
+		return DiffRemoved
+	case "value differs":
+		return DiffRevised
+	}
+	return DiffRenamed
+}
+
+func buildDiffReport(base, source string, mismatches []Mismatch) DiffReport {
+	report := DiffReport{
+		Base:   base,
+		Source: source,
+		Counts: map[string]int{},
+	}
+
+	for _, m := range mismatches {
+		if !slices.Contains(report.Years, m.Year) {
+			report.Years = append(report.Years, m.Year)
+		}
+	}
+	slices.Sort(report.Years)
+
+	rows := map[string]int{}
+	for _, m := range mismatches {
+		i, ok := rows[m.Category]
+		if !ok {
+			i = len(report.Rows)
+			rows[m.Category] = i
+			report.Rows = append(report.Rows, DiffRow{
+				Category: m.Category,
+				Cells:    make([]*DiffCell, len(report.Years)),
+			})
+		}
+
+		kind := diffKind(m)
+		report.Counts[kind]++
+		report.Rows[i].Cells[slices.Index(report.Years, m.Year)] = &DiffCell{
+			Kind:    kind,
+			Old:     m.Actual,
+			New:     m.Expected,
+			Problem: m.Problem,
+		}
+	}
+	return report
+}
+
+func writeDiffText(w io.Writer, report DiffReport) error {
+	for _, row := range report.Rows {
+		for i, cell := range row.Cells {
+			if cell == nil {
+				continue
+			}
+			_, err := fmt.Fprintf(
+				w,
+				"%s [%d]: %s (%s -> %s)\n",
+				row.Category,
+				report.Years[i],
+				cell.Problem,
+				formatAmount(cell.Old),
+				formatAmount(cell.New),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(
+		w,
+		"%d revised, %d added, %d removed, %d renamed\n",
+		report.Counts[DiffRevised],
+		report.Counts[DiffAdded],
+		report.Counts[DiffRemoved],
+		report.Counts[DiffRenamed],
+	)
+	return err
+}
+
+func diffCmd(app *App, c *cli.Context) error {
+	source := c.String("csv")
+	data, err := parse(c.Context, source, app.parse)
+	if err != nil {
+		return fmt.Errorf("parse CSV: %w", err)
+	}
+
+	mismatches, err := verifyData(app.db, data)
+	if err != nil {
+		return err
+	}
+
+	base, err := currentVersion(app.db)
+	if err != nil {
+		return fmt.Errorf("read loaded version: %w", err)
+	}
+	report := buildDiffReport(base, source, mismatches)
+
+	path := c.String("html")
+	if path == "" {
+		return writeDiffText(os.Stdout, report)
+	}
+
+	tmpl, err := parseTemplates(defaultTemplateSet)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := tmpl.ExecuteTemplate(f, "diff.html", report); err != nil {
+		return fmt.Errorf("render diff: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,36 @@
+package nhe
+
+import "fmt"
+
+type DisplayMode string
+
+const (
+	DisplayDollars DisplayMode = "dollars"
+	DisplayPercent DisplayMode = "pct"
+)
+
+var displayModes = []DisplayMode{
+	DisplayDollars,
+	DisplayPercent,
+}
+
+func parseDisplayMode(s string) (DisplayMode, error) {
+	switch DisplayMode(s) {
+	case "", DisplayDollars:
+		return DisplayDollars, nil
+	case DisplayPercent:
+		return DisplayPercent, nil
+	}
+	return "", fmt.Errorf("unknown display mode %q", s)
+}
+
+func (m DisplayMode) Label() string {
+	if m == DisplayPercent {
+		return "Percent of total"
+	}
+	return "Dollars"
+}
+
+func (m DisplayMode) Percent() bool {
+	return m == DisplayPercent
+}
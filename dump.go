@@ -0,0 +1,323 @@
+package nhe
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tqbf/nhe/texttable"
+	"github.com/urfave/cli/v2"
+)
+
+const defaultDumpYear = 2023
+
+type dumpRow struct {
+	Name    string
+	Indent  int
+	Amounts []*int
+	Status  []CellStatus
+}
+
+func (r dumpRow) Depth() int {
+	return r.Indent / 5
+}
+
+func (r dumpRow) Empty() bool {
+	for i, a := range r.Amounts {
+		if a != nil || r.Status[i] == CellSuppressed {
+			return false
+		}
+	}
+	return true
+}
+
+type dumpTable struct {
+	From  int
+	To    int
+	Years []int
+	Rows  []dumpRow
+}
+
+func (t *dumpTable) Title() string {
+	if t.From == t.To {
+		return fmt.Sprintf("National Health Expenditures - Year %d", t.From)
+	}
+	return fmt.Sprintf(
+		"National Health Expenditures - Years %d-%d",
+		t.From,
+		t.To,
+	)
+}
+
+func parseDumpYears(arg string) (int, int, error) {
+	if arg == "" {
+		return defaultDumpYear, defaultDumpYear, nil
+	}
+
+	lo, hi, isRange := strings.Cut(arg, "-")
+	from, err := strconv.Atoi(lo)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year: %v", err)
+	}
+	if !isRange {
+		return from, from, nil
+	}
+
+	to, err := strconv.Atoi(hi)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year: %v", err)
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("year range %d-%d is reversed", from, to)
+	}
+	return from, to, nil
+}
+
+func queryDump(db *sql.DB, opts QueryOptions) (*dumpTable, error) {
+	if err := opts.amountsOnly(); err != nil {
+		return nil, err
+	}
+
+	f, err := opts.resolve(db)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := queryYears(db)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &dumpTable{}
+	column := map[int]int{}
+	for _, year := range all {
+		if f.wantsYear(year) {
+			column[year] = len(t.Years)
+			t.Years = append(t.Years, year)
+		}
+	}
+	if len(t.Years) == 0 {
+		return nil, fmt.Errorf("no data for years %v", opts.Years)
+	}
+	t.From, t.To = t.Years[0], t.Years[len(t.Years)-1]
+
+	where, args := f.where()
+	rows, err := db.Query(`
+		SELECT
+			c.id,
+			c.name,
+			c.indent_level,
+			y.year,
+			e.amount,
+			`+f.caps.status("e")+`
+		FROM expenditures e
+		JOIN categories c ON c.id = e.category_id
+		JOIN years y ON y.id = e.year_id
+		WHERE `+where+`
+		ORDER BY `+f.orderBy(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lastID := -1
+	for rows.Next() {
+		var (
+			id     int
+			name   string
+			indent int
+			year   int
+			amount *int
+			status CellStatus
+		)
+		err := rows.Scan(&id, &name, &indent, &year, &amount, &status)
+		if err != nil {
+			return nil, err
+		}
+
+		if id != lastID {
+			t.Rows = append(t.Rows, dumpRow{
+				Name:    name,
+				Indent:  indent,
+				Amounts: make([]*int, len(t.Years)),
+				Status:  make([]CellStatus, len(t.Years)),
+			})
+			lastID = id
+		}
+
+		row := t.Rows[len(t.Rows)-1]
+		row.Amounts[column[year]] = amount
+		row.Status[column[year]] = status
+	}
+	return t, rows.Err()
+}
+
+func dumpCell(amount *int, status CellStatus, missing string) string {
+	switch {
+	case status == CellSuppressed:
+		return "0"
+	case amount != nil:
+		return strconv.Itoa(*amount)
+	}
+	return missing
+}
+
+func dumpTextTable(t *dumpTable) texttable.Table {
+	table := texttable.Table{
+		Title: t.Title(),
+		Columns: []texttable.Column{
+			{Header: "CATEGORY", Width: 60, Truncate: true},
+		},
+	}
+
+	for _, year := range t.Years {
+		header := strconv.Itoa(year)
+		if len(t.Years) == 1 {
+			header = "AMOUNT"
+		}
+		table.Columns = append(table.Columns, texttable.Column{
+			Header: header,
+			Width:  10,
+			Align:  texttable.Right,
+		})
+	}
+
+	for _, r := range t.Rows {
+		row := []string{strings.Repeat("  ", r.Depth()) + r.Name}
+		for i, a := range r.Amounts {
+			row = append(row, dumpCell(a, r.Status[i], "—"))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+)
+
+func latexEscape(s string) string {
+	return latexEscaper.Replace(s)
+}
+
+func latexAmount(amount *int, status CellStatus) string {
+	cell := dumpCell(amount, status, "---")
+	n, err := strconv.Atoi(cell)
+	if err != nil {
+		return cell
+	}
+
+	var (
+		digits = strconv.Itoa(max(n, -n))
+		b      strings.Builder
+	)
+	if n < 0 {
+		b.WriteString("$-$")
+	}
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString("{,}")
+		}
+		b.WriteRune(d)
+	}
+	return b.String()
+}
+
+func (r dumpRow) LaTeXCells() []string {
+	cells := make([]string, len(r.Amounts))
+	for i, a := range r.Amounts {
+		cells[i] = latexAmount(a, r.Status[i])
+	}
+	return cells
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`|`, `\|`,
+	"`", "\\`",
+	`*`, `\*`,
+	`_`, `\_`,
+	`[`, `\[`,
+	`]`, `\]`,
+	`<`, `&lt;`,
+	`>`, `&gt;`,
+)
+
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func markdownIndent(depth int) string {
+	return strings.Repeat("&emsp;", depth)
+}
+
+func (r dumpRow) MarkdownCells() []string {
+	cells := make([]string, len(r.Amounts))
+	for i, a := range r.Amounts {
+		cells[i] = dumpCell(a, r.Status[i], "—")
+	}
+	return cells
+}
+
+func renderMarkdown(w io.Writer, t *dumpTable) error {
+	if err := textTemplates.ExecuteTemplate(w, "table.md", t); err != nil {
+		return fmt.Errorf("render Markdown table: %w", err)
+	}
+	return nil
+}
+
+func renderLaTeX(w io.Writer, t *dumpTable) error {
+	if err := textTemplates.ExecuteTemplate(w, "table.tex", t); err != nil {
+		return fmt.Errorf("render LaTeX table: %w", err)
+	}
+	return nil
+}
+
+func dumpCmd(app *App, c *cli.Context) error {
+	opts, err := cliQueryOptions(c)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.Years) == 0 {
+		from, to, err := parseDumpYears(c.Args().First())
+		if err != nil {
+			return err
+		}
+		opts.Years = []YearRange{{From: from, To: to}}
+	}
+
+	db, done, err := datasetDB(app, opts)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	t, err := queryDump(db, opts)
+	if err != nil {
+		return err
+	}
+
+	switch format := c.String("format"); format {
+	case "text":
+		return renderText(os.Stdout, dumpTextTable(t))
+	case "latex":
+		return renderLaTeX(os.Stdout, t)
+	case "markdown":
+		return renderMarkdown(os.Stdout, t)
+	default:
+		return fmt.Errorf("unknown dump format %q", format)
+	}
+}
@@ -0,0 +1,103 @@
+package nhe
+
+import (
+	"net/http"
+	"strings"
+)
+
+func parseExpanded(s string) []string {
+	var (
+		slugs []string
+		seen  = map[string]bool{}
+	)
+	for slug := range strings.SplitSeq(s, ",") {
+		slug = strings.TrimSpace(slug)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		slugs = append(slugs, slug)
+	}
+	return slugs
+}
+
+func expandTable(
+	app *App,
+	r *http.Request,
+	data *TableData,
+) (*TableData, error) {
+	requested := parseExpanded(r.URL.Query().Get("expand"))
+	if len(requested) == 0 {
+		return data, nil
+	}
+
+	refs, err := cachedCategoryRefs(app)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		slugs  = make(map[int]string, len(refs))
+		known  = make(map[string]bool, len(refs))
+		parent = map[string]string{}
+		open   = map[string]bool{}
+	)
+	for _, ref := range refs {
+		slugs[ref.ID] = ref.Slug
+		known[ref.Slug] = true
+	}
+	for _, ref := range refs {
+		if ref.ParentID != nil {
+			parent[ref.Slug] = slugs[*ref.ParentID]
+		}
+	}
+
+	q := r.URL.Query()
+	q.Del("category")
+	for _, slug := range requested {
+		if known[slug] {
+			open[slug] = true
+			q.Add("category", slug)
+		}
+	}
+	if len(open) == 0 {
+		return data, nil
+	}
+
+	sub := r.Clone(r.Context())
+	sub.URL.RawQuery = q.Encode()
+	subtree, _, err := readTable(app, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	children := map[string][]TableCategory{}
+	for _, cat := range subtree.Categories {
+		if p := parent[cat.Slug]; open[p] {
+			children[p] = append(children[p], cat)
+		}
+	}
+
+	var (
+		expanded = *data
+		shown    []string
+		walk     func(cat TableCategory)
+	)
+	walk = func(cat TableCategory) {
+		cat.Expanded = cat.Expandable && open[cat.Slug]
+		expanded.Categories = append(expanded.Categories, cat)
+		if !cat.Expanded {
+			return
+		}
+		shown = append(shown, cat.Slug)
+		for _, child := range children[cat.Slug] {
+			walk(child)
+		}
+	}
+	expanded.Categories = nil
+	for _, cat := range data.Categories {
+		walk(cat)
+	}
+	expanded.Expand = strings.Join(shown, ",")
+	return &expanded, nil
+}
@@ -0,0 +1,528 @@
+package nhe
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const estimatedBytesPerRow = 48
+
+type exportGuard struct {
+	rowLimit int
+	apiKey   string
+}
+
+func (g exportGuard) allow(
+	w http.ResponseWriter,
+	r *http.Request,
+	rows int,
+) bool {
+	if g.rowLimit <= 0 || rows <= g.rowLimit {
+		return true
+	}
+
+	if r.URL.Query().Get("confirm") == "1" {
+		return true
+	}
+
+	if g.apiKey != "" && keyMatches(r.Header.Get("X-API-Key"), g.apiKey) {
+		return true
+	}
+
+	http.Error(
+		w,
+		fmt.Sprintf(
+			"export of ~%d rows (~%d KB) exceeds limit of %d rows; "+
+				"add ?confirm=1 or an X-API-Key header",
+			rows,
+			rows*estimatedBytesPerRow/1024,
+			g.rowLimit,
+		),
+		http.StatusRequestEntityTooLarge,
+	)
+	return false
+}
+
+func (g exportGuard) check(
+	w http.ResponseWriter,
+	r *http.Request,
+	db *sql.DB,
+	opts QueryOptions,
+) bool {
+	start := time.Now()
+	rows, err := countExpenditures(db, opts)
+	if err != nil {
+		writeReadError(w, err)
+		return false
+	}
+	timingFrom(r.Context()).track("db", start)
+	return g.allow(w, r, rows)
+}
+
+func countExpenditures(db *sql.DB, opts QueryOptions) (int, error) {
+	f, err := opts.resolve(db)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		count       int
+		where, args = f.where()
+	)
+	err = db.QueryRow(`
+		SELECT COUNT(*)
+		FROM expenditures e
+		JOIN categories c ON c.id = e.category_id
+		JOIN years y ON y.id = e.year_id
+		WHERE `+where, args...).Scan(&count)
+	return count, err
+}
+
+type expenditureRow struct {
+	Category string
+	Parent   string
+	Year     int
+	Amount   *int
+	Note     string
+}
+
+func eachExpenditure(
+	ctx context.Context,
+	db *sql.DB,
+	opts QueryOptions,
+	fn func(expenditureRow) error,
+) error {
+	if err := opts.amountsOnly(); err != nil {
+		return err
+	}
+
+	f, err := opts.resolve(db)
+	if err != nil {
+		return err
+	}
+
+	refs, err := categoryRefs(db)
+	if err != nil {
+		return err
+	}
+	slugs := make(map[int]string, len(refs))
+	for _, ref := range refs {
+		slugs[ref.ID] = ref.Slug
+	}
+
+	notes, err := annotationIndex(db)
+	if err != nil {
+		return err
+	}
+
+	where, args := f.where()
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			c.id,
+			c.name,
+			COALESCE(p.name, ''),
+			y.year,
+			e.amount
+		FROM expenditures e
+		JOIN categories c ON c.id = e.category_id
+		LEFT JOIN categories p ON p.id = c.parent_id
+		JOIN years y ON y.id = e.year_id
+		WHERE `+where+`
+		ORDER BY `+f.orderBy(), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id int
+			e  expenditureRow
+		)
+		err := rows.Scan(&id, &e.Category, &e.Parent, &e.Year, &e.Amount)
+		if err != nil {
+			return err
+		}
+		e.Note = notes[annotationKey{slugs[id], e.Year}]
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func writeExpendituresCSV(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	opts QueryOptions,
+	comma rune,
+) (int, error) {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write([]string{
+		"category",
+		"parent",
+		"year",
+		"amount",
+		"note",
+	}); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	err := eachExpenditure(ctx, db, opts, func(e expenditureRow) error {
+		rows++
+		amountStr := ""
+		if e.Amount != nil {
+			amountStr = strconv.Itoa(*e.Amount)
+		}
+		return cw.Write([]string{
+			e.Category,
+			e.Parent,
+			strconv.Itoa(e.Year),
+			amountStr,
+			e.Note,
+		})
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	cw.Flush()
+	return rows, cw.Error()
+}
+
+func writeExpendituresJSONL(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	opts QueryOptions,
+) (int, error) {
+	var (
+		bw   = bufio.NewWriter(w)
+		enc  = json.NewEncoder(bw)
+		rows int
+	)
+	err := eachExpenditure(ctx, db, opts, func(e expenditureRow) error {
+		rows++
+		return enc.Encode(struct {
+			Category string `json:"category"`
+			Parent   string `json:"parent,omitempty"`
+			Year     int    `json:"year"`
+			Amount   *int   `json:"amount"`
+			Note     string `json:"note,omitempty"`
+		}{e.Category, e.Parent, e.Year, e.Amount, e.Note})
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, bw.Flush()
+}
+
+func writeSeriesCSV(w io.Writer, cs *CategorySeries, shape string) error {
+	if shape == LayoutWide {
+		return writeWideSeriesCSV(w, cs)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"year", cs.Name}); err != nil {
+		return err
+	}
+
+	for _, p := range cs.Series {
+		err := cw.Write([]string{strconv.Itoa(p.Year), cs.cell(p)})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func seriesCSVHandler(
+	app *App,
+	tmpl *template.Template,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug, ok := strings.CutSuffix(r.PathValue("slug"), ".csv")
+		if !ok {
+			renderNotFound(w, r, app, tmpl, slug)
+			return
+		}
+
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		shape, err := parseSeriesShape(r.URL.Query().Get("shape"))
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		start := time.Now()
+		ref, ok, err := cachedCategoryRef(app, slug)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			renderNotFound(w, r, app, tmpl, slug)
+			return
+		}
+
+		db, done, err := datasetDB(app, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		defer done()
+
+		cs, err := optionSeries(db, ref.ID, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set(
+			"Content-Disposition",
+			fmt.Sprintf(`inline; filename="%s.csv"`, path.Base(slug)),
+		)
+		if err := writeSeriesCSV(w, cs, shape); err != nil {
+			slog.Error("write series CSV", "slug", slug, "error", err)
+		}
+	}
+}
+
+type exporter interface {
+	export(
+		ctx context.Context,
+		w io.Writer,
+		db *sql.DB,
+		view TableView,
+		opts QueryOptions,
+	) (int, error)
+}
+
+type rowExporter func(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	opts QueryOptions,
+) (int, error)
+
+func (fn rowExporter) export(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	_ TableView,
+	opts QueryOptions,
+) (int, error) {
+	return fn(ctx, w, db, opts)
+}
+
+type tableExporter func(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	data *TableData,
+	opts QueryOptions,
+) error
+
+func (fn tableExporter) export(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	view TableView,
+	opts QueryOptions,
+) (int, error) {
+	data, err := nheData(db, view, opts)
+	if err != nil {
+		return 0, err
+	}
+	if data, err = annotatedTable(db, data); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return len(data.Categories), fn(ctx, w, db, data, opts)
+}
+
+func delimitedExporter(comma rune) rowExporter {
+	return func(
+		ctx context.Context,
+		w io.Writer,
+		db *sql.DB,
+		opts QueryOptions,
+	) (int, error) {
+		return writeExpendituresCSV(ctx, w, db, opts, comma)
+	}
+}
+
+var exporters = map[string]exporter{
+	"arrow":   rowExporter(writeExpendituresArrow),
+	"csv":     delimitedExporter(csvFormat.comma),
+	"jsonl":   rowExporter(writeExpendituresJSONL),
+	"parquet": rowExporter(writeExpendituresParquet),
+	"sql": rowExporter(func(
+		ctx context.Context,
+		w io.Writer,
+		db *sql.DB,
+		opts QueryOptions,
+	) (int, error) {
+		if err := opts.unfiltered("sql"); err != nil {
+			return 0, err
+		}
+		return writeSQLDump(ctx, w, db)
+	}),
+	"tsv": delimitedExporter(tsvFormat.comma),
+	"txt": tableExporter(func(
+		_ context.Context,
+		w io.Writer,
+		_ *sql.DB,
+		data *TableData,
+		_ QueryOptions,
+	) error {
+		return renderTable(w, data, 0)
+	}),
+	"xlsx": tableExporter(writeNHEXLSX),
+}
+
+func writeExport(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	format string,
+	view TableView,
+	opts QueryOptions,
+) (int, error) {
+	e, ok := exporters[format]
+	if !ok {
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+	return e.export(ctx, w, db, view, opts)
+}
+
+func exportCmd(app *App, c *cli.Context) error {
+	if manifest := c.String("verify"); manifest != "" {
+		return verifyExportCmd(manifest)
+	}
+
+	view, err := tableView(app, url.Values{"years": {c.String("years")}})
+	if err != nil {
+		return err
+	}
+
+	opts, err := cliQueryOptions(c)
+	if err != nil {
+		return err
+	}
+
+	db, done, err := datasetDB(app, opts)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	format, output := c.String("format"), c.String("output")
+	if output == "-" {
+		_, err := writeExport(c.Context, os.Stdout, db, format, view, opts)
+		return err
+	}
+
+	store, err := openStore(c.String("dest"))
+	if err != nil {
+		return err
+	}
+
+	mf, err := exportFile(c.Context, db, store, output, format, view, opts)
+	if err != nil {
+		store.close()
+		return err
+	}
+	err = writeManifest(
+		c.Context,
+		store,
+		output+manifestSuffix,
+		db,
+		[]ManifestFile{mf},
+	)
+	if err != nil {
+		store.close()
+		return err
+	}
+	return store.close()
+}
+
+func verifyExportCmd(manifest string) error {
+	problems, err := verifyManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d files do not match the manifest", len(problems))
+	}
+
+	fmt.Println("export matches manifest")
+	return nil
+}
+
+func writeTableCSV(w io.Writer, data *TableData) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"category", "units", "scale"}
+	for _, year := range data.Years {
+		header = append(header, strconv.Itoa(year))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, cat := range data.Categories {
+		row := []string{
+			cat.Name,
+			cat.Units,
+			strconv.FormatInt(cat.Scale, 10),
+		}
+		for _, v := range cat.Values {
+			amountStr := ""
+			if v != nil {
+				amountStr = strconv.Itoa(*v)
+			}
+			row = append(row, amountStr)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
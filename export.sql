@@ -0,0 +1,25 @@
+CREATE TABLE years (
+    id INTEGER PRIMARY KEY,
+    year INTEGER NOT NULL UNIQUE
+);
+
+CREATE TABLE categories (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    parent_id INTEGER REFERENCES categories(id),
+    indent_level INTEGER NOT NULL,
+    sort_order INTEGER NOT NULL,
+    is_major_heading SMALLINT NOT NULL DEFAULT 0,
+    units VARCHAR(32) NOT NULL,
+    scale BIGINT NOT NULL,
+    source VARCHAR(16) NOT NULL DEFAULT 'official'
+);
+
+CREATE TABLE expenditures (
+    id INTEGER PRIMARY KEY,
+    category_id INTEGER NOT NULL REFERENCES categories(id),
+    year_id INTEGER NOT NULL REFERENCES years(id),
+    amount BIGINT,
+    status VARCHAR(16) NOT NULL,
+    UNIQUE (category_id, year_id)
+);
@@ -0,0 +1,71 @@
+package nhe
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+var fieldsParam = RouteParam{
+	Name:        "fields",
+	In:          "query",
+	Type:        "string",
+	Description: "Comma-separated keys to keep, e.g. name,slug,values",
+}
+
+func parseFields(s string) map[string]bool {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	fields := map[string]bool{}
+	for f := range strings.SplitSeq(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields[f] = true
+		}
+	}
+	return fields
+}
+
+func selectFields(v any, fields map[string]bool) (any, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		kept := map[string]any{}
+		for k, child := range v {
+			if fields[k] {
+				kept[k] = child
+				continue
+			}
+			if sub, ok := selectFields(child, fields); ok {
+				kept[k] = sub
+			}
+		}
+		return kept, len(kept) > 0
+	case []any:
+		kept := make([]any, 0, len(v))
+		found := false
+		for _, child := range v {
+			sub, ok := selectFields(child, fields)
+			found = found || ok
+			kept = append(kept, sub)
+		}
+		return kept, found
+	}
+	return nil, false
+}
+
+func projectFields(v any, fields map[string]bool) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	projected, _ := selectFields(generic, fields)
+	return projected, nil
+}
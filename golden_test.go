@@ -0,0 +1,159 @@
+package nhe
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files")
+
+var timestampPattern = regexp.MustCompile(
+	`\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}Z?`,
+)
+
+var goldenPages = []struct {
+	name string
+	path string
+	code int
+}{
+	{"index", "/", http.StatusOK},
+	{"index_fiscal", "/?basis=fiscal", http.StatusOK},
+	{"index_every_page2", "/?years=every&page=2", http.StatusOK},
+	{"index_dollars", "/?heatmap=dollars", http.StatusOK},
+	{"index_range", "/?from=1990&to=2010", http.StatusOK},
+	{"index_pct", "/?mode=pct", http.StatusOK},
+	{"category", "/category/2", http.StatusOK},
+	{"compare", "/compare?a=2019&b=2023", http.StatusOK},
+	{"print", "/print?years=decades", http.StatusOK},
+	{"lines", "/lines", http.StatusOK},
+	{"payers", "/payers", http.StatusOK},
+	{"treemap", "/treemap", http.StatusOK},
+	{"quality", "/admin/quality", http.StatusOK},
+	{"routes", "/admin/routes", http.StatusOK},
+	{"docs", "/api/docs", http.StatusOK},
+	{"export_txt", "/export.txt?width=120", http.StatusOK},
+	{"not_found", "/series/medicar.csv", http.StatusNotFound},
+	{
+		"series_csv",
+		"/series/personal-health-care/health-insurance/medicare.csv",
+		http.StatusOK,
+	},
+}
+
+func normalizeHTML(body string) string {
+	body = timestampPattern.ReplaceAllString(body, "<timestamp>")
+
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestGoldenPages(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache(), adminKey: "secret"}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	for _, page := range goldenPages {
+		t.Run(page.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", page.path, nil)
+			r.Header.Set("X-Admin-Key", "secret")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, page.code, w.Code)
+
+			var (
+				got  = normalizeHTML(w.Body.String())
+				path = filepath.Join("testdata", "golden", page.name+".golden")
+			)
+
+			if *updateGolden {
+				assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				assert.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			assert.NoError(t, err, "run go test -run TestGoldenPages -update")
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
+
+func TestTemplateSets(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = Handler(db, Options{Templates: "bogus"})
+	assert.Error(t, err)
+
+	for set := range templateSets {
+		handler, err := Handler(db, Options{
+			Context:   t.Context(),
+			Templates: set,
+			AdminKey:  "secret",
+		})
+		assert.NoError(t, err)
+
+		for _, page := range goldenPages {
+			r := httptest.NewRequest("GET", page.path, nil)
+			r.Header.Set("X-Admin-Key", "secret")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, page.code, w.Code, set+" "+page.path)
+		}
+	}
+
+	handler, err := Handler(db, Options{
+		Context:   t.Context(),
+		Templates: "minimal",
+		AdminKey:  "secret",
+	})
+	assert.NoError(t, err)
+
+	for path, tailwind := range map[string]bool{
+		"/":              false,
+		"/nope":          false,
+		"/admin/quality": true,
+	} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("X-Admin-Key", "secret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(
+			t,
+			tailwind,
+			strings.Contains(w.Body.String(), "output.css"),
+			path,
+		)
+	}
+}
+
+func TestMissingOverrides(t *testing.T) {
+	missing, err := missingOverrides(templateSets["default"])
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+
+	missing, err = missingOverrides(templateSets["minimal"])
+	assert.NoError(t, err)
+	assert.Contains(t, missing, "category.html")
+	assert.NotContains(t, missing, "index.html")
+	assert.NotContains(t, missing, "notfound.html")
+}
@@ -0,0 +1,347 @@
+package nhe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type gqlToken struct {
+	kind byte
+	val  string
+}
+
+const (
+	gqlEOF    byte = 0
+	gqlName   byte = 'n'
+	gqlInt    byte = 'i'
+	gqlString byte = 's'
+	gqlPunct  byte = 'p'
+)
+
+func gqlLex(src string) ([]gqlToken, error) {
+	var (
+		tokens []gqlToken
+		rs     = []rune(src)
+	)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r) || r == ',' || r == '\ufeff':
+			i++
+		case r == '#':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case strings.ContainsRune("{}()[]:$!=@", r):
+			tokens = append(tokens, gqlToken{gqlPunct, string(r)})
+			i++
+		case r == '.' && i+2 < len(rs) && rs[i+1] == '.' && rs[i+2] == '.':
+			tokens = append(tokens, gqlToken{gqlPunct, "..."})
+			i += 3
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(rs) && (rs[i] == '_' ||
+				unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i])) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{gqlName, string(rs[start:i])})
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(rs) && unicode.IsDigit(rs[i]) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{gqlInt, string(rs[start:i])})
+		case r == '"':
+			var b strings.Builder
+			i++
+			for i < len(rs) && rs[i] != '"' {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				b.WriteRune(rs[i])
+				i++
+			}
+			if i >= len(rs) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			i++
+			tokens = append(tokens, gqlToken{gqlString, b.String()})
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+
+	return append(tokens, gqlToken{kind: gqlEOF}), nil
+}
+
+type gqlVar string
+
+type gqlField struct {
+	Alias     string
+	Name      string
+	Args      map[string]any
+	Selection []gqlField
+}
+
+func (f gqlField) key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+type gqlParser struct {
+	tokens   []gqlToken
+	pos      int
+	defaults map[string]any
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != gqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) is(val string) bool {
+	t := p.peek()
+	return (t.kind == gqlPunct || t.kind == gqlName) && t.val == val
+}
+
+func (p *gqlParser) expect(val string) error {
+	if t := p.next(); t.val != val {
+		return fmt.Errorf("expected %q, got %q", val, t.val)
+	}
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	t := p.next()
+	if t.kind != gqlName {
+		return "", fmt.Errorf("expected name, got %q", t.val)
+	}
+	return t.val, nil
+}
+
+func gqlParse(src string) ([]gqlField, map[string]any, error) {
+	tokens, err := gqlLex(src)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &gqlParser{tokens: tokens, defaults: map[string]any{}}
+	if p.is("mutation") || p.is("subscription") {
+		return nil, nil, fmt.Errorf("only queries are supported")
+	}
+
+	if p.is("query") {
+		p.next()
+		if p.peek().kind == gqlName {
+			p.next()
+		}
+		if p.is("(") {
+			if err := p.variableDefinitions(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	fields, err := p.selectionSet()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if t := p.peek(); t.kind != gqlEOF {
+		return nil, nil, fmt.Errorf(
+			"unexpected %q after query; only one operation is supported",
+			t.val,
+		)
+	}
+	return fields, p.defaults, nil
+}
+
+func (p *gqlParser) variableDefinitions() error {
+	p.next()
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+
+		for p.is("[") || p.is("]") || p.is("!") ||
+			p.peek().kind == gqlName {
+			p.next()
+		}
+
+		if p.is("=") {
+			p.next()
+			v, err := p.value()
+			if err != nil {
+				return err
+			}
+			p.defaults[name] = v
+		}
+
+		if p.peek().kind == gqlEOF {
+			return fmt.Errorf("unterminated variable definitions")
+		}
+	}
+	p.next()
+	return nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlField, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var fields []gqlField
+	for !p.is("}") {
+		if p.is("...") {
+			return nil, fmt.Errorf("fragments are not supported")
+		}
+		if p.is("@") {
+			return nil, fmt.Errorf("directives are not supported")
+		}
+
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	p.next()
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty selection set")
+	}
+	return fields, nil
+}
+
+func (p *gqlParser) field() (gqlField, error) {
+	var f gqlField
+
+	name, err := p.name()
+	if err != nil {
+		return f, err
+	}
+	f.Name = name
+
+	if p.is(":") {
+		p.next()
+		if f.Name, err = p.name(); err != nil {
+			return f, err
+		}
+		f.Alias = name
+	}
+
+	if p.is("(") {
+		p.next()
+		f.Args = map[string]any{}
+		for !p.is(")") {
+			arg, err := p.name()
+			if err != nil {
+				return f, err
+			}
+			if err := p.expect(":"); err != nil {
+				return f, err
+			}
+			if f.Args[arg], err = p.value(); err != nil {
+				return f, err
+			}
+		}
+		p.next()
+	}
+
+	if p.is("{") {
+		if f.Selection, err = p.selectionSet(); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+func (p *gqlParser) value() (any, error) {
+	t := p.next()
+	switch {
+	case t.kind == gqlPunct && t.val == "$":
+		name, err := p.name()
+		return gqlVar(name), err
+	case t.kind == gqlInt:
+		return strconv.Atoi(t.val)
+	case t.kind == gqlString:
+		return t.val, nil
+	case t.kind == gqlName && t.val == "true":
+		return true, nil
+	case t.kind == gqlName && t.val == "false":
+		return false, nil
+	case t.kind == gqlName && t.val == "null":
+		return nil, nil
+	case t.kind == gqlName:
+		return t.val, nil
+	case t.kind == gqlPunct && t.val == "[":
+		list := []any{}
+		for !p.is("]") {
+			if p.peek().kind == gqlEOF {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+	}
+	return nil, fmt.Errorf("unexpected %q in argument", t.val)
+}
+
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key string
+	val any
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		k, err := json.Marshal(e.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(e.val)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,582 @@
+package nhe
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	maxGraphQLDepth   = 8
+	maxGraphQLAliases = 16
+	maxGraphQLNodes   = 50000
+)
+
+type gqlCategory struct {
+	CategoryRef
+	Units    string
+	Scale    int64
+	Children []int
+}
+
+type gqlGraph struct {
+	order []int
+	byID  map[int]*gqlCategory
+	years []int
+}
+
+func loadGraph(db *sql.DB, refs []CategoryRef) (*gqlGraph, error) {
+	g := &gqlGraph{byID: map[int]*gqlCategory{}}
+	for _, ref := range refs {
+		g.order = append(g.order, ref.ID)
+		g.byID[ref.ID] = &gqlCategory{CategoryRef: ref}
+	}
+
+	for _, id := range g.order {
+		c := g.byID[id]
+		if c.ParentID == nil {
+			continue
+		}
+		if parent, ok := g.byID[*c.ParentID]; ok {
+			parent.Children = append(parent.Children, id)
+		}
+	}
+
+	caps := capsOf(db)
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT c.id, %s, %s FROM categories c",
+		caps.units("c"),
+		caps.scale("c"),
+	))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id    int
+			units string
+			scale int64
+		)
+		if err := rows.Scan(&id, &units, &scale); err != nil {
+			return nil, err
+		}
+		if c, ok := g.byID[id]; ok {
+			c.Units, c.Scale = units, scale
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if g.years, err = queryYears(db); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func cachedGraph(app *App) (*gqlGraph, error) {
+	return cachedView(app, "graphql", func() (*gqlGraph, error) {
+		refs, err := categoryRefs(app.db)
+		if err != nil {
+			return nil, err
+		}
+		return loadGraph(app.db, refs)
+	})
+}
+
+type gqlSeries struct {
+	id     int
+	field  gqlField
+	from   *int
+	to     *int
+	points []any
+}
+
+func (s *gqlSeries) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.points)
+}
+
+type gqlExec struct {
+	db      *sql.DB
+	graph   *gqlGraph
+	vars    map[string]any
+	nodes   int
+	pending []*gqlSeries
+}
+
+func (e *gqlExec) node() error {
+	e.nodes++
+	if e.nodes > maxGraphQLNodes {
+		return fmt.Errorf("query returns more than %d nodes", maxGraphQLNodes)
+	}
+	return nil
+}
+
+func gqlAliases(fields []gqlField) int {
+	n := 0
+	for _, f := range fields {
+		if f.Alias != "" {
+			n++
+		}
+		n += gqlAliases(f.Selection)
+	}
+	return n
+}
+
+func knownArgs(f gqlField, names ...string) error {
+	for _, name := range slices.Sorted(maps.Keys(f.Args)) {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("unknown argument %q on field %s", name, f.Name)
+		}
+	}
+	return nil
+}
+
+func (e *gqlExec) arg(f gqlField, name string) any {
+	v := f.Args[name]
+	if ref, ok := v.(gqlVar); ok {
+		return e.vars[string(ref)]
+	}
+	return v
+}
+
+func (e *gqlExec) intArg(f gqlField, name string) (*int, error) {
+	switch v := e.arg(f, name).(type) {
+	case nil:
+		return nil, nil
+	case int:
+		return &v, nil
+	case float64:
+		n := int(v)
+		if float64(n) == v {
+			return &n, nil
+		}
+	}
+	return nil, fmt.Errorf("argument %s of %s must be an Int", name, f.Name)
+}
+
+func (e *gqlExec) stringArg(f gqlField, name string) (*string, error) {
+	switch v := e.arg(f, name).(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &v, nil
+	}
+	return nil, fmt.Errorf("argument %s of %s must be a String", name, f.Name)
+}
+
+func (e *gqlExec) boolArg(f gqlField, name string) (*bool, error) {
+	switch v := e.arg(f, name).(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return &v, nil
+	}
+	return nil, fmt.Errorf("argument %s of %s must be a Boolean", name, f.Name)
+}
+
+func leaf(f gqlField, typ string) error {
+	if f.Selection != nil {
+		return fmt.Errorf("field %s on %s has no subfields", f.Name, typ)
+	}
+	return knownArgs(f)
+}
+
+func branch(f gqlField, typ string) error {
+	if f.Selection == nil {
+		return fmt.Errorf("field %s on %s needs a selection set", f.Name, typ)
+	}
+	return nil
+}
+
+func (e *gqlExec) query(fields []gqlField) (gqlObject, error) {
+	var out gqlObject
+	for _, f := range fields {
+		var (
+			v   any
+			err error
+		)
+
+		switch f.Name {
+		case "__typename":
+			v = "Query"
+		case "years":
+			if err = leaf(f, "Query"); err == nil {
+				v = e.graph.years
+			}
+		case "category":
+			v, err = e.category(f)
+		case "categories":
+			v, err = e.categories(f)
+		default:
+			err = fmt.Errorf("cannot query field %q on type Query", f.Name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, gqlEntry{f.key(), v})
+	}
+	return out, nil
+}
+
+func (e *gqlExec) category(f gqlField) (any, error) {
+	if err := branch(f, "Query"); err != nil {
+		return nil, err
+	}
+	if err := knownArgs(f, "id", "slug"); err != nil {
+		return nil, err
+	}
+
+	id, err := e.intArg(f, "id")
+	if err != nil {
+		return nil, err
+	}
+	slug, err := e.stringArg(f, "slug")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cid := range e.graph.order {
+		c := e.graph.byID[cid]
+		if (id != nil && c.ID == *id) || (slug != nil && c.Slug == *slug) {
+			return e.resolveCategory(c, f.Selection, 1)
+		}
+	}
+	return nil, nil
+}
+
+func (e *gqlExec) categories(f gqlField) (any, error) {
+	if err := branch(f, "Query"); err != nil {
+		return nil, err
+	}
+	if err := knownArgs(f, "parent", "root", "name"); err != nil {
+		return nil, err
+	}
+
+	parent, err := e.intArg(f, "parent")
+	if err != nil {
+		return nil, err
+	}
+	root, err := e.boolArg(f, "root")
+	if err != nil {
+		return nil, err
+	}
+	name, err := e.stringArg(f, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	out := []any{}
+	for _, id := range e.graph.order {
+		c := e.graph.byID[id]
+		switch {
+		case parent != nil && (c.ParentID == nil || *c.ParentID != *parent):
+			continue
+		case root != nil && *root != (c.ParentID == nil):
+			continue
+		case name != nil && c.Name != *name:
+			continue
+		}
+
+		v, err := e.resolveCategory(c, f.Selection, 1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (e *gqlExec) resolveCategory(
+	c *gqlCategory,
+	fields []gqlField,
+	depth int,
+) (any, error) {
+	if depth > maxGraphQLDepth {
+		return nil, fmt.Errorf("query nests deeper than %d", maxGraphQLDepth)
+	}
+	if err := e.node(); err != nil {
+		return nil, err
+	}
+
+	var out gqlObject
+	for _, f := range fields {
+		var (
+			v   any
+			err error
+		)
+
+		switch f.Name {
+		case "__typename":
+			v = "Category"
+		case "id":
+			v, err = c.ID, leaf(f, "Category")
+		case "name":
+			v, err = c.Name, leaf(f, "Category")
+		case "slug":
+			v, err = c.Slug, leaf(f, "Category")
+		case "parentId":
+			v, err = c.ParentID, leaf(f, "Category")
+		case "units":
+			v, err = c.Units, leaf(f, "Category")
+		case "scale":
+			v, err = c.Scale, leaf(f, "Category")
+		case "parent":
+			if err = branch(f, "Category"); err != nil {
+				break
+			}
+			if err = knownArgs(f); err != nil || c.ParentID == nil {
+				break
+			}
+			if p, ok := e.graph.byID[*c.ParentID]; ok {
+				v, err = e.resolveCategory(p, f.Selection, depth+1)
+			}
+		case "children":
+			if err = branch(f, "Category"); err != nil {
+				break
+			}
+			if err = knownArgs(f); err != nil {
+				break
+			}
+			children := []any{}
+			for _, id := range c.Children {
+				child, err := e.resolveCategory(
+					e.graph.byID[id],
+					f.Selection,
+					depth+1,
+				)
+				if err != nil {
+					return nil, err
+				}
+				children = append(children, child)
+			}
+			v = children
+		case "expenditures":
+			v, err = e.expenditures(c, f)
+		default:
+			err = fmt.Errorf("cannot query field %q on type Category", f.Name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, gqlEntry{f.key(), v})
+	}
+	return out, nil
+}
+
+func (e *gqlExec) expenditures(c *gqlCategory, f gqlField) (any, error) {
+	if err := branch(f, "Category"); err != nil {
+		return nil, err
+	}
+	if err := knownArgs(f, "from", "to"); err != nil {
+		return nil, err
+	}
+
+	from, err := e.intArg(f, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := e.intArg(f, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sf := range f.Selection {
+		switch sf.Name {
+		case "__typename", "year", "amount", "status":
+		default:
+			return nil, fmt.Errorf(
+				"cannot query field %q on type Expenditure",
+				sf.Name,
+			)
+		}
+		if err := leaf(sf, "Expenditure"); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &gqlSeries{id: c.ID, field: f, from: from, to: to}
+	e.pending = append(e.pending, s)
+	return s, nil
+}
+
+func (e *gqlExec) loadSeries() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+
+	var (
+		ids  []int
+		args []any
+		caps = capsOf(e.db)
+	)
+	for _, s := range e.pending {
+		if !slices.Contains(ids, s.id) {
+			ids = append(ids, s.id)
+			args = append(args, s.id)
+		}
+	}
+
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	rows, err := e.db.Query(`
+		SELECT
+			c.id,
+			y.year,
+			e.amount,
+			COALESCE(`+caps.status("e")+`, 'no_data')
+		FROM categories c
+		CROSS JOIN years y
+		LEFT JOIN expenditures e
+			ON e.year_id = y.id AND e.category_id = c.id
+		WHERE c.id IN (`+marks+`)
+		ORDER BY c.id, y.year
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	series := make(map[int][]SeriesPoint, len(ids))
+	for rows.Next() {
+		var (
+			id int
+			p  SeriesPoint
+		)
+		if err := rows.Scan(&id, &p.Year, &p.Amount, &p.Status); err != nil {
+			return err
+		}
+		series[id] = append(series[id], p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range e.pending {
+		s.points = []any{}
+		for _, p := range series[s.id] {
+			if (s.from != nil && p.Year < *s.from) ||
+				(s.to != nil && p.Year > *s.to) {
+				continue
+			}
+			if err := e.node(); err != nil {
+				return err
+			}
+
+			var obj gqlObject
+			for _, sf := range s.field.Selection {
+				var v any
+				switch sf.Name {
+				case "__typename":
+					v = "Expenditure"
+				case "year":
+					v = p.Year
+				case "amount":
+					v = p.Amount
+				case "status":
+					v = p.Status
+				}
+				obj = append(obj, gqlEntry{sf.key(), v})
+			}
+			s.points = append(s.points, obj)
+		}
+	}
+	return nil
+}
+
+type GraphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+type GraphQLError struct {
+	Message string `json:"message"`
+}
+
+type GraphQLResponse struct {
+	Data   any            `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+func gqlFailure(msg string) GraphQLResponse {
+	return GraphQLResponse{Errors: []GraphQLError{{Message: msg}}}
+}
+
+func executeGraphQL(
+	db *sql.DB,
+	graph *gqlGraph,
+	req GraphQLRequest,
+) GraphQLResponse {
+	fields, defaults, err := gqlParse(req.Query)
+	if err != nil {
+		return gqlFailure("parse: " + err.Error())
+	}
+
+	vars := defaults
+	for k, v := range req.Variables {
+		vars[k] = v
+	}
+
+	if n := gqlAliases(fields); n > maxGraphQLAliases {
+		return gqlFailure(fmt.Sprintf(
+			"query uses %d aliases; the limit is %d",
+			n,
+			maxGraphQLAliases,
+		))
+	}
+
+	e := &gqlExec{db: db, graph: graph, vars: vars}
+	data, err := e.query(fields)
+	if err != nil {
+		return gqlFailure(err.Error())
+	}
+	if err := e.loadSeries(); err != nil {
+		return gqlFailure(err.Error())
+	}
+	return GraphQLResponse{Data: data}
+}
+
+func graphQLHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if r.Method == http.MethodGet {
+			req.Query = r.URL.Query().Get("query")
+			if v := r.URL.Query().Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					http.Error(w, "invalid variables", http.StatusBadRequest)
+					return
+				}
+			}
+		} else {
+			r.Body = http.MaxBytesReader(w, r.Body, maxQueryBodyBytes)
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(
+					w,
+					fmt.Sprintf("invalid request: %v", err),
+					http.StatusBadRequest,
+				)
+				return
+			}
+		}
+
+		start := time.Now()
+		graph, err := cachedGraph(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := executeGraphQL(app.db, graph, req)
+		timingFrom(r.Context()).track("db", start)
+
+		writeJSON(w, r, resp)
+	}
+}
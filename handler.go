@@ -0,0 +1,78 @@
+package nhe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Options struct {
+	Context        context.Context
+	AdminKey       string
+	ExportKey      string
+	ExportRowLimit int
+	Years          string
+	DebugSQL       bool
+	ViewBudget     time.Duration
+	Templates      string
+	JobWorkers     int
+	ExportDir      string
+	BasePath       string
+}
+
+func Open(path string) (*sql.DB, error) {
+	return openDatabase(path, defaultLockTimeout)
+}
+
+func OpenEphemeral() (*sql.DB, error) {
+	return openEphemeral()
+}
+
+func parseBasePath(s string) (string, error) {
+	s = strings.TrimSuffix(s, "/")
+	if s != "" && !strings.HasPrefix(s, "/") {
+		return "", fmt.Errorf("base path %q must start with /", s)
+	}
+	return s, nil
+}
+
+func Handler(store *sql.DB, opts Options) (http.Handler, error) {
+	years, err := parseYearStrategy(opts.Years)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := parseBasePath(opts.BasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{
+		db:        store,
+		cache:     newViewCache(),
+		debugSQL:  opts.DebugSQL,
+		adminKey:  opts.AdminKey,
+		years:     years,
+		templates: opts.Templates,
+		workers:   opts.JobWorkers,
+		exportDir: opts.ExportDir,
+		base:      base,
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	handler, err := newHandler(ctx, app, exportGuard{
+		rowLimit: opts.ExportRowLimit,
+		apiKey:   opts.ExportKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withTiming(handler, opts.ViewBudget), nil
+}
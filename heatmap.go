@@ -0,0 +1,199 @@
+package nhe
+
+import (
+	"fmt"
+	"math"
+)
+
+type HeatmapScale string
+
+const (
+	HeatmapShare   HeatmapScale = "share"
+	HeatmapDollars HeatmapScale = "dollars"
+	HeatmapRow     HeatmapScale = "row"
+)
+
+var heatmapScales = []HeatmapScale{
+	HeatmapShare,
+	HeatmapDollars,
+	HeatmapRow,
+}
+
+type HeatmapCurve string
+
+const (
+	HeatmapLinear HeatmapCurve = "linear"
+	HeatmapLog    HeatmapCurve = "log"
+)
+
+var heatmapCurves = []HeatmapCurve{
+	HeatmapLinear,
+	HeatmapLog,
+}
+
+var heatmapPalette = []string{
+	"bg-blue-200",
+	"bg-sky-200",
+	"bg-cyan-200",
+	"bg-teal-200",
+	"bg-green-200",
+	"bg-lime-200",
+	"bg-yellow-200",
+	"bg-amber-200",
+	"bg-orange-200",
+	"bg-red-200",
+}
+
+var heatmapDarkPalette = []string{
+	"bg-blue-900",
+	"bg-sky-900",
+	"bg-cyan-900",
+	"bg-teal-900",
+	"bg-green-900",
+	"bg-lime-900",
+	"bg-yellow-900",
+	"bg-amber-900",
+	"bg-orange-900",
+	"bg-red-900",
+}
+
+const (
+	heatmapBlank     = "bg-gray-100"
+	heatmapDarkBlank = "bg-gray-800"
+)
+
+func parseHeatmapScale(s string) (HeatmapScale, error) {
+	switch HeatmapScale(s) {
+	case "", HeatmapShare:
+		return HeatmapShare, nil
+	case HeatmapDollars, HeatmapRow:
+		return HeatmapScale(s), nil
+	}
+	return "", fmt.Errorf("unknown heatmap scale %q", s)
+}
+
+func (s HeatmapScale) Label() string {
+	switch s {
+	case HeatmapDollars:
+		return "Color by dollars"
+	case HeatmapRow:
+		return "Color within each row"
+	}
+	return "Color by share"
+}
+
+func (s HeatmapScale) curve(c HeatmapCurve) HeatmapCurve {
+	if c != "" {
+		return c
+	}
+	if s == HeatmapDollars {
+		return HeatmapLog
+	}
+	return HeatmapLinear
+}
+
+func parseHeatmapCurve(s string) (HeatmapCurve, error) {
+	switch HeatmapCurve(s) {
+	case "", HeatmapLinear, HeatmapLog:
+		return HeatmapCurve(s), nil
+	}
+	return "", fmt.Errorf("unknown heatmap curve %q", s)
+}
+
+func (c HeatmapCurve) Label() string {
+	if c == HeatmapLog {
+		return "Log scale"
+	}
+	return "Linear scale"
+}
+
+func heatmapColor(
+	t *TableData,
+	cat TableCategory,
+	amount *int,
+	year int,
+	catIdx int,
+) string {
+	palette, blank := heatmapPalette, heatmapBlank
+	if t.Theme.Dark() {
+		palette, blank = heatmapDarkPalette, heatmapDarkBlank
+	}
+	if amount == nil {
+		return blank
+	}
+
+	curve := t.Heatmap.curve(t.Curve)
+	if t.Heatmap == HeatmapRow {
+		pos, ok := heatmapRowPosition(cat.Values, *amount, curve)
+		if !ok {
+			return blank
+		}
+		return heatmapBand(palette, pos, 0, 1/float64(len(palette)))
+	}
+
+	if catIdx < 3 && cat.Depth == 0 {
+		return blank
+	}
+
+	if t.Heatmap == HeatmapDollars {
+		if cat.Units != unitsUSD || *amount <= 0 {
+			return blank
+		}
+		dollars := float64(*amount) * float64(cat.Scale)
+		if curve == HeatmapLinear {
+			return heatmapBand(palette, dollars, 0, 5e10)
+		}
+		return heatmapBand(palette, math.Log10(dollars), 8, 0.5)
+	}
+
+	total, ok := t.Totals[year]
+	if !ok || total == nil || *total == 0 {
+		return blank
+	}
+	pct := float64(*amount) / float64(*total) * 100
+	if curve == HeatmapLog {
+		if pct <= 0 {
+			return blank
+		}
+		return heatmapBand(palette, math.Log10(pct), -1, 0.25)
+	}
+	return heatmapBand(palette, pct, 1.5, 1.5)
+}
+
+func heatmapRowPosition(
+	values []*int,
+	amount int,
+	curve HeatmapCurve,
+) (float64, bool) {
+	scaled := func(n int) (float64, bool) {
+		if curve != HeatmapLog {
+			return float64(n), true
+		}
+		return math.Log10(float64(n)), n > 0
+	}
+
+	v, ok := scaled(amount)
+	if !ok {
+		return 0, false
+	}
+
+	lo, hi := v, v
+	for _, p := range values {
+		if p == nil {
+			continue
+		}
+		if x, ok := scaled(*p); ok {
+			lo, hi = min(lo, x), max(hi, x)
+		}
+	}
+	if hi == lo {
+		return 0, true
+	}
+	return (v - lo) / (hi - lo), true
+}
+
+func heatmapBand(palette []string, v, start, step float64) string {
+	idx := int(math.Floor((v - start) / step))
+	idx = min(max(idx, 0), len(palette)-1)
+	return palette[idx]
+}
@@ -0,0 +1,522 @@
+package nhe
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+const (
+	jobPollInterval  = time.Second
+	jobHeartbeat     = 10 * time.Second
+	jobStaleAfter    = 3 * jobHeartbeat
+	defaultExportDir = "exports"
+)
+
+type Job struct {
+	ID         int64             `json:"id"`
+	Kind       string            `json:"kind"`
+	Args       map[string]string `json:"args"`
+	State      string            `json:"state"`
+	Progress   float64           `json:"progress"`
+	Message    string            `json:"message"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  string            `json:"created_at"`
+	StartedAt  string            `json:"started_at,omitempty"`
+	FinishedAt string            `json:"finished_at,omitempty"`
+}
+
+func (j Job) Percent() string {
+	return fmt.Sprintf("%.0f%%", j.Progress*100)
+}
+
+type jobProgress func(fraction float64, message string)
+
+type jobFunc func(
+	ctx context.Context,
+	app *App,
+	args map[string]string,
+	progress jobProgress,
+) error
+
+var jobKinds = map[string]jobFunc{
+	"load":   loadJob,
+	"export": exportJob,
+}
+
+func localPath(
+	args map[string]string,
+	key string,
+	fallback string,
+) (string, error) {
+	path := args[key]
+	if path == "" {
+		path = fallback
+	}
+	if path == "" || !filepath.IsLocal(path) {
+		return "", fmt.Errorf("%s must be a relative path: %q", key, path)
+	}
+	return path, nil
+}
+
+func loadJob(
+	ctx context.Context,
+	app *App,
+	args map[string]string,
+	progress jobProgress,
+) error {
+	path, err := localPath(args, "csv", csvFilename)
+	if err != nil {
+		return err
+	}
+
+	progress(0.1, "loading "+path)
+	if err := reloadCSV(ctx, app, path); err != nil {
+		return err
+	}
+	progress(1, "loaded "+path)
+	return nil
+}
+
+func exportJob(
+	ctx context.Context,
+	app *App,
+	args map[string]string,
+	progress jobProgress,
+) error {
+	format := args["format"]
+	if format == "" {
+		format = "csv"
+	}
+	output, err := localPath(args, "output", "")
+	if err != nil {
+		return err
+	}
+
+	opts, err := argsQueryOptions(args)
+	if err != nil {
+		return err
+	}
+
+	db, done, err := datasetDB(app, opts)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	store, err := openRootStore(cmp.Or(app.exportDir, defaultExportDir))
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	progress(0.1, "exporting "+output)
+	view := defaultView(app)
+	mf, err := exportFile(ctx, db, store, output, format, view, opts)
+	if err != nil {
+		return err
+	}
+	progress(0.9, fmt.Sprintf("wrote %d rows", mf.Rows))
+
+	err = writeManifest(
+		ctx,
+		store,
+		output+manifestSuffix,
+		db,
+		[]ManifestFile{mf},
+	)
+	if err != nil {
+		return err
+	}
+	progress(1, fmt.Sprintf("wrote %d rows to %s", mf.Rows, output))
+	return nil
+}
+
+type jobQueue struct {
+	app     *App
+	owner   string
+	workers int
+	wake    chan struct{}
+	ctx     context.Context
+	stop    context.CancelFunc
+	done    sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[int64]context.CancelFunc
+}
+
+func jobOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+func newJobQueue(
+	parent context.Context,
+	app *App,
+	workers int,
+) *jobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	stale := fmt.Sprintf("-%d seconds", int(jobStaleAfter.Seconds()))
+	_, err := app.db.Exec(`
+		UPDATE jobs
+		SET
+			state = ?,
+			error = 'interrupted',
+			finished_at = CURRENT_TIMESTAMP
+		WHERE state = ?
+		AND (heartbeat_at IS NULL OR heartbeat_at < datetime('now', ?))
+	`, JobFailed, JobRunning, stale)
+	if err != nil {
+		slog.Error("mark interrupted jobs", "error", err)
+	}
+
+	ctx, stop := context.WithCancel(parent)
+	q := &jobQueue{
+		app:     app,
+		owner:   jobOwner(),
+		workers: workers,
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		stop:    stop,
+		running: map[int64]context.CancelFunc{},
+	}
+
+	q.done.Add(workers)
+	for range workers {
+		go q.work()
+	}
+	return q
+}
+
+func (q *jobQueue) close() {
+	q.stop()
+	q.done.Wait()
+}
+
+func (q *jobQueue) enqueue(kind string, args map[string]string) (int64, error) {
+	if _, ok := jobKinds[kind]; !ok {
+		return 0, fmt.Errorf("unknown job kind %q", kind)
+	}
+
+	b, err := json.Marshal(args)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := q.app.db.Exec(
+		"INSERT INTO jobs (kind, args) VALUES (?, ?)",
+		kind,
+		string(b),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return res.LastInsertId()
+}
+
+func (q *jobQueue) claim() (*Job, error) {
+	var (
+		job  Job
+		args string
+	)
+	err := q.app.db.QueryRow(`
+		UPDATE jobs
+		SET
+			state = ?,
+			owner = ?,
+			started_at = CURRENT_TIMESTAMP,
+			heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs WHERE state = ? ORDER BY id LIMIT 1
+		)
+		RETURNING id, kind, args
+	`, JobRunning, q.owner, JobQueued).Scan(&job.ID, &job.Kind, &args)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(args), &job.Args); err != nil {
+		return nil, fmt.Errorf("decode args of job %d: %w", job.ID, err)
+	}
+	return &job, nil
+}
+
+func (q *jobQueue) work() {
+	defer q.done.Done()
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for q.ctx.Err() == nil {
+		job, err := q.claim()
+		if err != nil {
+			slog.Error("claim job", "error", err)
+		}
+		if job != nil {
+			q.run(job)
+			continue
+		}
+
+		select {
+		case <-q.ctx.Done():
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *jobQueue) heartbeat(ctx context.Context, id int64) {
+	ticker := time.NewTicker(jobHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := q.app.db.Exec(
+			"UPDATE jobs SET heartbeat_at = CURRENT_TIMESTAMP WHERE id = ?",
+			id,
+		)
+		if err != nil {
+			slog.Error("job heartbeat", "id", id, "error", err)
+		}
+	}
+}
+
+func (q *jobQueue) run(job *Job) {
+	ctx, cancel := context.WithCancel(q.ctx)
+	defer cancel()
+	go q.heartbeat(ctx, job.ID)
+
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+	}()
+
+	slog.Info("job started", "id", job.ID, "kind", job.Kind)
+	progress := func(fraction float64, message string) {
+		_, err := q.app.db.Exec(
+			"UPDATE jobs SET progress = ?, message = ? WHERE id = ?",
+			fraction,
+			message,
+			job.ID,
+		)
+		if err != nil {
+			slog.Error("update job progress", "id", job.ID, "error", err)
+		}
+	}
+
+	err := jobKinds[job.Kind](ctx, q.app, job.Args, progress)
+
+	state, msg := JobDone, ""
+	switch {
+	case q.ctx.Err() != nil:
+		state, msg = JobFailed, "interrupted by shutdown"
+	case ctx.Err() != nil:
+		state = JobCancelled
+	case err != nil:
+		state, msg = JobFailed, err.Error()
+	}
+
+	_, dbErr := q.app.db.Exec(`
+		UPDATE jobs
+		SET state = ?, error = ?, finished_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, state, msg, job.ID)
+	if dbErr != nil {
+		slog.Error("finish job", "id", job.ID, "error", dbErr)
+	}
+	slog.Info("job finished", "id", job.ID, "state", state, "error", msg)
+}
+
+func (q *jobQueue) cancel(id int64) (bool, error) {
+	res, err := q.app.db.Exec(`
+		UPDATE jobs
+		SET state = ?, finished_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND state = ?
+	`, JobCancelled, id, JobQueued)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cancel, ok := q.running[id]
+	if ok {
+		cancel()
+	}
+	return ok, nil
+}
+
+func listJobs(db *sql.DB, limit int) ([]Job, error) {
+	rows, err := db.Query(`
+		SELECT
+			id,
+			kind,
+			args,
+			state,
+			progress,
+			message,
+			error,
+			created_at,
+			COALESCE(started_at, ''),
+			COALESCE(finished_at, '')
+		FROM jobs
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var (
+			job  Job
+			args string
+		)
+		err := rows.Scan(
+			&job.ID,
+			&job.Kind,
+			&args,
+			&job.State,
+			&job.Progress,
+			&job.Message,
+			&job.Error,
+			&job.CreatedAt,
+			&job.StartedAt,
+			&job.FinishedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(args), &job.Args); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func jobsHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := negotiated(w, r, mimeHTML, mimeJSON)
+		if !ok {
+			return
+		}
+
+		jobs, err := listJobs(app.db, 100)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if format == mimeJSON {
+			writeJSON(w, r, jobs)
+			return
+		}
+		renderPage(w, r, tmpl, "jobs.html", jobs)
+	}
+}
+
+func enqueueJobHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		args := map[string]string{}
+		for k := range r.PostForm {
+			if k != "kind" && r.PostForm.Get(k) != "" {
+				args[k] = r.PostForm.Get(k)
+			}
+		}
+
+		id, err := app.jobs.enqueue(r.PostForm.Get("kind"), args)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Location", app.url("/admin/jobs"))
+		if format, _ := negotiate(
+			r.Header.Get("Accept"),
+			mimeHTML,
+			mimeJSON,
+		); format == mimeJSON {
+			w.Header().Set("Content-Type", mimeJSON)
+			w.WriteHeader(http.StatusAccepted)
+			writeJSON(w, r, map[string]int64{"id": id})
+			return
+		}
+		w.WriteHeader(http.StatusSeeOther)
+	}
+}
+
+func cancelJobHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		ok, err := app.jobs.cancel(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "job is not queued or running", http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Location", app.url("/admin/jobs"))
+		w.WriteHeader(http.StatusSeeOther)
+	}
+}
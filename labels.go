@@ -0,0 +1,71 @@
+package nhe
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type LabelLocale struct {
+	Tag       string
+	Separator string
+}
+
+var localeEnglish = LabelLocale{Tag: "en", Separator: "."}
+
+var labelLocales = []LabelLocale{
+	localeEnglish,
+	{Tag: "de", Separator: ","},
+	{Tag: "es", Separator: ","},
+	{Tag: "fr", Separator: ","},
+	{Tag: "it", Separator: ","},
+	{Tag: "nl", Separator: ","},
+	{Tag: "pt", Separator: ","},
+}
+
+func parseLocale(accept string) LabelLocale {
+	for _, part := range strings.Split(accept, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		for _, l := range labelLocales {
+			if l.Tag == primary {
+				return l
+			}
+		}
+	}
+	return localeEnglish
+}
+
+func requestLocale(r *http.Request) LabelLocale {
+	return parseLocale(r.Header.Get("Accept-Language"))
+}
+
+func compactScale(v float64) (float64, string) {
+	switch abs := math.Abs(v); {
+	case abs >= 1e12:
+		return v / 1e12, "T"
+	case abs >= 1e9:
+		return v / 1e9, "B"
+	case abs >= 1e6:
+		return v / 1e6, "M"
+	case abs >= 1e3:
+		return v / 1e3, "K"
+	}
+	return v, ""
+}
+
+func (l LabelLocale) Number(v float64, digits int) string {
+	s := strconv.FormatFloat(v, 'f', digits, 64)
+	return strings.Replace(s, ".", l.Separator, 1)
+}
+
+func (l LabelLocale) Compact(v float64, digits int) string {
+	v, suffix := compactScale(v)
+	return l.Number(v, digits) + suffix
+}
+
+func shortYear(year int) string {
+	return fmt.Sprintf("'%02d", year%100)
+}
@@ -0,0 +1,87 @@
+package nhe
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"time"
+)
+
+type LinesOption struct {
+	CategoryRef
+	Depth    int
+	Selected bool
+}
+
+type LinesPage struct {
+	Options  []LinesOption
+	Selected []string
+	Metric   string
+	Metrics  []string
+	Theme    Theme
+}
+
+func linesOptions(refs []CategoryRef, selected []string) []LinesOption {
+	parents := make(map[int]*int, len(refs))
+	for _, ref := range refs {
+		parents[ref.ID] = ref.ParentID
+	}
+
+	options := make([]LinesOption, len(refs))
+	for i, ref := range refs {
+		depth := 0
+		for p := ref.ParentID; p != nil && depth < len(refs); p = parents[*p] {
+			depth++
+		}
+		options[i] = LinesOption{
+			CategoryRef: ref,
+			Depth:       depth,
+			Selected:    slices.Contains(selected, ref.Slug),
+		}
+	}
+	return options
+}
+
+func linesHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		metric := q.Get("metric")
+		if metric == "" {
+			metric = MetricAmount
+		}
+		if !slices.Contains(queryMetrics, metric) {
+			writeReadError(w, badQuery(
+				"unknown metric %q (want one of %v)",
+				metric,
+				queryMetrics,
+			))
+			return
+		}
+
+		start := time.Now()
+		refs, err := cachedCategoryRefs(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		selected := q["category"]
+		if roots := rootSlugs(refs); len(selected) == 0 && len(roots) > 0 {
+			selected = roots[:1]
+		}
+
+		page := LinesPage{
+			Options: linesOptions(refs, selected),
+			Metric:  metric,
+			Metrics: queryMetrics,
+			Theme:   requestTheme(r),
+		}
+		for _, opt := range page.Options {
+			if opt.Selected {
+				page.Selected = append(page.Selected, opt.Slug)
+			}
+		}
+		renderPage(w, r, tmpl, "lines.html", page)
+	}
+}
@@ -0,0 +1,57 @@
+package nhe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const defaultLockTimeout = 10 * time.Second
+
+func databaseDSN(path string, lockTimeout time.Duration) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf(
+		"%s%s_busy_timeout=%d&_txlock=immediate",
+		path,
+		sep,
+		lockTimeout.Milliseconds(),
+	)
+}
+
+func isBusy(err error) bool {
+	var se sqlite3.Error
+	return errors.As(err, &se) &&
+		(se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked)
+}
+
+func beginWrite(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if !isBusy(err) {
+		return tx, err
+	}
+
+	var ms int64
+	_ = db.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&ms)
+	return nil, fmt.Errorf(
+		"database is locked by another writer after waiting %s; "+
+			"retry once the other load finishes: %w",
+		time.Duration(ms)*time.Millisecond,
+		err,
+	)
+}
+
+func checkpoint(ctx context.Context, db *sql.DB) {
+	_, err := db.ExecContext(ctx, "PRAGMA wal_checkpoint(PASSIVE)")
+	if err != nil {
+		slog.Warn("checkpoint database", "error", err)
+	}
+}
@@ -0,0 +1,246 @@
+package nhe
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	LayoutWide = "wide"
+	LayoutLong = "long"
+)
+
+const longPathSeparator = ">"
+
+var longColumns = []string{"category_path", "year", "amount"}
+
+type longCell struct {
+	row    int
+	path   string
+	year   int
+	amount *int
+	marker bool
+}
+
+func loadCmd(app *App, c *cli.Context) error {
+	var (
+		file   = cmp.Or(c.Args().First(), csvFilename)
+		layout = c.String("format")
+	)
+	if layout == LayoutWide {
+		return reloadCSV(c.Context, app, file)
+	}
+	if layout != LayoutLong {
+		return fmt.Errorf("unknown --format %q: use wide or long", layout)
+	}
+
+	slog.Info("loading data from long CSV", "file", file)
+	data, err := parseLongFile(c.Context, file, app.parse)
+	if err != nil {
+		return fmt.Errorf("parse long CSV: %w", err)
+	}
+	return reloadParsed(c.Context, app, data)
+}
+
+func parseLongFile(
+	ctx context.Context,
+	filename string,
+	opts parseOptions,
+) (*ParsedData, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := parseLong(
+		ctx,
+		f,
+		fileInputFormat(opts.format, filename),
+		opts.duplicatePolicy(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Source = filename
+	return data, nil
+}
+
+func parseLong(
+	ctx context.Context,
+	r io.Reader,
+	format string,
+	dups string,
+) (*ParsedData, error) {
+	var (
+		hash = sha256.New()
+		br   = bufio.NewReader(io.TeeReader(ctxReader{ctx, r}, hash))
+	)
+	reader := csv.NewReader(br)
+	reader.Comma = inputDelimiter(format, br)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("long CSV needs a header and at least one row")
+	}
+
+	col := map[string]int{}
+	for i, h := range records[0] {
+		name, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(h)), " ")
+		col[name] = i
+	}
+	for _, name := range longColumns {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("long CSV missing %s column", name)
+		}
+	}
+	scale := headerScale(records[0][col["amount"]])
+
+	data := &ParsedData{
+		Source:       "embedded",
+		Categories:   make([]Category, 0),
+		Expenditures: make(map[int]map[int]*int),
+		Suppressed:   make(map[int]map[int]bool),
+	}
+
+	var (
+		cells []longCell
+		width = max(col["category_path"], col["year"], col["amount"])
+	)
+	for rowIdx, row := range records[1:] {
+		rowIdx++
+		if len(row) <= width {
+			data.warn(rowIdx, "", "%d columns, want %d", len(row), width+1)
+			continue
+		}
+
+		path := strings.TrimSpace(row[col["category_path"]])
+		if path == "" {
+			data.warn(rowIdx, "", "empty category_path")
+			continue
+		}
+
+		year, err := strconv.Atoi(strings.TrimSpace(row[col["year"]]))
+		if err != nil {
+			data.warn(rowIdx, path, "invalid year %q", row[col["year"]])
+			continue
+		}
+
+		cell := longCell{row: rowIdx, path: path, year: year}
+		val := strings.TrimSpace(row[col["amount"]])
+		switch status, marker := classifyCell(val); {
+		case status == CellNoData:
+		case marker:
+			zero := 0
+			cell.amount, cell.marker = &zero, true
+		default:
+			val = strings.ReplaceAll(val, ",", "")
+			amount, err := strconv.Atoi(val)
+			if err != nil {
+				data.warn(rowIdx, path, "invalid amount %q for %d", val, year)
+			}
+			cell.amount = &amount
+		}
+		cells = append(cells, cell)
+	}
+
+	for _, c := range cells {
+		if !slices.Contains(data.Years, c.year) {
+			data.Years = append(data.Years, c.year)
+		}
+	}
+	slices.Sort(data.Years)
+
+	var (
+		ids    = map[string]int{}
+		rowFor = map[[2]int]int{}
+	)
+	for _, c := range cells {
+		id := longCategory(data, ids, c.path, scale)
+		slot := slices.Index(data.Years, c.year) + 1
+		key := [2]int{id, slot}
+
+		if first, ok := rowFor[key]; ok {
+			if dups == DuplicatesError {
+				return nil, fmt.Errorf(
+					"row %d (%s): %d duplicates row %d",
+					c.row+1,
+					c.path,
+					c.year,
+					first+1,
+				)
+			}
+			data.warn(c.row, c.path, "%d duplicates row %d", c.year, first+1)
+			if dups == DuplicatesFirst {
+				continue
+			}
+		}
+		rowFor[key] = c.row
+
+		data.Expenditures[id][slot] = c.amount
+		if c.marker {
+			data.Suppressed[id][slot] = true
+			continue
+		}
+		delete(data.Suppressed[id], slot)
+	}
+
+	data.Version = hex.EncodeToString(hash.Sum(nil))[:12]
+	return data, nil
+}
+
+func longCategory(
+	data *ParsedData,
+	ids map[string]int,
+	path string,
+	scale int64,
+) int {
+	var (
+		parentID = 0
+		prefix   []string
+	)
+	for depth, part := range strings.Split(path, longPathSeparator) {
+		name := strings.TrimSpace(part)
+		prefix = append(prefix, name)
+		key := strings.Join(prefix, longPathSeparator)
+
+		if id, ok := ids[key]; ok {
+			parentID = id
+			continue
+		}
+
+		units, catScale := seriesUnits(name, scale)
+		data.Categories = append(data.Categories, Category{
+			Name:           name,
+			ParentID:       parentID,
+			IndentLevel:    depth * 5,
+			SortOrder:      len(data.Categories) + 1,
+			IsMajorHeading: depth == 0,
+			Units:          units,
+			Scale:          catScale,
+		})
+
+		parentID = len(data.Categories)
+		ids[key] = parentID
+		data.Expenditures[parentID] = make(map[int]*int)
+		data.Suppressed[parentID] = make(map[int]bool)
+	}
+	return parentID
+}
@@ -1,20 +1,34 @@
-package main
+package nhe
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"embed"
 	"encoding/csv"
+	"encoding/hex"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/tqbf/nhe/texttable"
 	"github.com/urfave/cli/v2"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/sdk/trace"
@@ -23,17 +37,39 @@ import (
 //go:embed schema.sql
 var schemaSQL string
 
-//go:embed templates/*.html
+//go:embed templates/*.html templates/minimal/*.html
 var templateFS embed.FS
 
-//go:embed static/css/output.css
+//go:embed static/css/output.css static/js/*.js
 var staticFS embed.FS
 
+//go:embed NHE2023.csv
+var fixtureCSV []byte
+
 var csvFilename = "NHE2023.csv"
 
+var ephemeralSeq atomic.Int64
+
 type App struct {
-	db     *sql.DB
-	server *http.Server
+	db          *sql.DB
+	dbPath      string
+	server      *http.Server
+	cache       *viewCache
+	debugSQL    bool
+	adminKey    string
+	years       YearStrategy
+	templates   string
+	workers     int
+	jobs        *jobQueue
+	threshold   float64
+	base        string
+	exportDir   string
+	parse       parseOptions
+	lockTimeout time.Duration
+}
+
+func (a *App) url(path string) string {
+	return a.base + path
 }
 
 type Category struct {
@@ -42,28 +78,188 @@ type Category struct {
 	IndentLevel    int
 	SortOrder      int
 	IsMajorHeading bool
+	Units          string
+	Scale          int64
 }
 
 type ParsedData struct {
+	Version      string
+	Source       string
 	Years        []int
 	Categories   []Category
 	Expenditures map[int]map[int]*int
+	Suppressed   map[int]map[int]bool
+	Warnings     []string
+	Notes        SourceNotes
+}
+
+func (d *ParsedData) warn(row int, name, format string, args ...any) {
+	d.Warnings = append(d.Warnings, fmt.Sprintf(
+		"row %d (%s): %s",
+		row+1,
+		name,
+		fmt.Sprintf(format, args...),
+	))
 }
 
 type TableData struct {
-	Years      []int
-	Categories []TableCategory
-	Totals     map[int]*int
+	Years       []int           `json:"years"`
+	Categories  []TableCategory `json:"categories"`
+	Totals      map[int]*int    `json:"totals"`
+	Decades     []Decade        `json:"decades,omitempty"`
+	Page        int             `json:"page,omitempty"`
+	Pages       int             `json:"pages,omitempty"`
+	Basis       YearBasis       `json:"basis"`
+	Strategy    string          `json:"strategy"`
+	SQL         []SQLStatement  `json:"sql,omitempty"`
+	Notes       []TableNote     `json:"notes,omitempty"`
+	Derivations []Derivation    `json:"derivations,omitempty"`
+	About       *SourceNotes    `json:"about,omitempty"`
+	Views       []SavedView     `json:"-"`
+	Heatmap     HeatmapScale    `json:"-"`
+	Curve       HeatmapCurve    `json:"-"`
+	Mode        DisplayMode     `json:"-"`
+	Theme       Theme           `json:"-"`
+	Available   []int           `json:"-"`
+	Range       YearRange       `json:"-"`
+	Sort        string          `json:"-"`
+	Expand      string          `json:"-"`
+	HiddenRows  []TableCategory `json:"-"`
+	Order       []int           `json:"-"`
+	Shortcuts   []ShortcutGroup `json:"-"`
+	PriorYears  []int           `json:"-"`
+	Threshold   float64         `json:"-"`
+}
+
+func (t TableData) NextSort(key string) string {
+	cur, desc, err := parseSort(t.Sort)
+	if err != nil || cur != key {
+		return key
+	}
+	if desc {
+		return key + ":asc"
+	}
+	return key + ":desc"
+}
+
+func (t TableData) HeatmapCurve() HeatmapCurve {
+	return t.Heatmap.curve(t.Curve)
+}
+
+func (t TableData) FirstYear() int {
+	if len(t.Available) == 0 {
+		return 0
+	}
+	return slices.Min(t.Available)
+}
+
+func (t TableData) LastYear() int {
+	if len(t.Available) == 0 {
+		return 0
+	}
+	return slices.Max(t.Available)
+}
+
+func (t TableData) LatestIndex() int {
+	if len(t.Years) == 0 {
+		return -1
+	}
+	return slices.Index(t.Years, slices.Max(t.Years))
+}
+
+func (t TableData) RangeFrom() int {
+	return cmp.Or(t.Range.From, t.FirstYear())
+}
+
+func (t TableData) RangeTo() int {
+	return cmp.Or(t.Range.To, t.LastYear())
+}
+
+func clampYearRange(yr YearRange, years []int) YearRange {
+	if len(years) == 0 {
+		return yr
+	}
+	lo, hi := slices.Min(years), slices.Max(years)
+	if yr.From != 0 {
+		yr.From = min(max(yr.From, lo), hi)
+	}
+	if yr.To != 0 {
+		yr.To = min(max(yr.To, lo), hi)
+	}
+	return yr
+}
+
+func (t TableData) SortMark(key string) string {
+	cur, desc, err := parseSort(t.Sort)
+	switch {
+	case err != nil || t.Sort == "" || cur != key:
+		return ""
+	case desc:
+		return "▼"
+	}
+	return "▲"
+}
+
+type Decade struct {
+	Label string `json:"label"`
+	Span  int    `json:"span"`
 }
 
 type TableCategory struct {
-	Name   string
-	Values []*int
+	ID         int                `json:"-"`
+	Name       string             `json:"name"`
+	Slug       string             `json:"slug"`
+	Units      string             `json:"units"`
+	Scale      int64              `json:"scale"`
+	Sparkline  string             `json:"-"`
+	Values     []*int             `json:"values"`
+	Status     []CellStatus       `json:"status"`
+	Notes      map[int]*TableNote `json:"-"`
+	Depth      int                `json:"-"`
+	Expandable bool               `json:"-"`
+	Expanded   bool               `json:"-"`
+	Major      bool               `json:"-"`
+	Pinned     bool               `json:"-"`
+	Previous   []*int             `json:"-"`
+	Prior      []*int             `json:"-"`
+	User       bool               `json:"user,omitempty"`
+}
+
+type TableRow struct {
+	Table    *TableData
+	Category TableCategory
+	Index    int
+}
+
+func tableRow(data *TableData, idx int) TableRow {
+	return TableRow{
+		Table:    data,
+		Category: data.Categories[idx],
+		Index:    data.rowIndex(idx),
+	}
+}
+
+func (c TableCategory) Format(n *int) string {
+	return formatScaled(n, c.Units, c.Scale)
+}
+
+func (c TableCategory) Anchor(year int) string {
+	return fmt.Sprintf("cat-%d-%d", c.ID, year)
+}
+
+func (c TableCategory) Display(i int) string {
+	switch c.Status[i] {
+	case CellNoData:
+		return "—"
+	case CellSuppressed:
+		return c.Format(new(int))
+	}
+	return c.Format(c.Values[i])
 }
 
 var debugFile *os.File
 
-func init() {
+func loadEnv() {
 	if os.Getenv("DEBUG") == "1" {
 		var err error
 		debugFile, err = os.OpenFile(
@@ -86,7 +282,9 @@ func fatal(msg string, args ...any) {
 	os.Exit(1)
 }
 
-func main() {
+func Main() {
+	loadEnv()
+
 	logWriter := os.Stdout
 	if debugFile != nil {
 		logWriter = debugFile
@@ -104,7 +302,7 @@ func main() {
 	}()
 
 	var (
-		app    = &App{}
+		app    = &App{cache: newViewCache()}
 		dbPath string
 	)
 
@@ -118,34 +316,65 @@ func main() {
 				Usage:       "path to SQLite database file",
 				Destination: &dbPath,
 			},
+			&cli.StringFlag{
+				Name:    "plugins-dir",
+				Value:   defaultPluginsDir,
+				EnvVars: []string{"NHE_PLUGINS"},
+				Usage:   "directory of executables run by the x command",
+			},
+			&cli.DurationFlag{
+				Name:  "lock-timeout",
+				Value: defaultLockTimeout,
+				Usage: "how long a write waits for another writer's lock",
+			},
 			&cli.BoolFlag{
 				Name:  "force-load",
 				Usage: "force reload data from CSV",
 			},
+			&cli.BoolFlag{
+				Name:  "ephemeral",
+				Usage: "use an in-memory database seeded from built-in data",
+			},
+			&cli.StringFlag{
+				Name:  "input-format",
+				Value: InputAuto,
+				Usage: "delimiter of source files: auto, csv, or tsv",
+			},
+			&cli.StringFlag{
+				Name:  "duplicates",
+				Value: DuplicatesFirst,
+				Usage: "repeated category/year cells: first-wins, last-wins, or error",
+			},
 		},
 		Before: func(c *cli.Context) error {
-			db, err := sql.Open("sqlite3", dbPath)
-			if err != nil {
+			if err := validateGlobal(c); err != nil {
 				return err
 			}
+			app.parse = parseOptions{
+				format:     c.String("input-format"),
+				duplicates: c.String("duplicates"),
+			}
+			app.lockTimeout = c.Duration("lock-timeout")
 
-			if err := db.Ping(); err != nil {
-				db.Close()
-				return err
+			if c.Bool("ephemeral") {
+				db, err := openEphemeral()
+				if err != nil {
+					return fmt.Errorf("open ephemeral database: %w", err)
+				}
+				app.db = db
+				return nil
 			}
 
-			if _, err := db.Exec(schemaSQL); err != nil {
-				db.Close()
+			db, err := openDatabase(dbPath, app.lockTimeout)
+			if err != nil {
 				return err
 			}
 
 			app.db = db
+			app.dbPath = dbPath
 
-			forceLoad := c.Bool("force-load")
-			if forceLoad {
-				if err := clearDatabase(db); err != nil {
-					return fmt.Errorf("clear database: %w", err)
-				}
+			if c.Bool("force-load") {
+				return reloadCSV(c.Context, app, csvFilename)
 			}
 
 			needsLoad, err := databaseEmpty(db)
@@ -153,26 +382,21 @@ func main() {
 				return fmt.Errorf("check database: %w", err)
 			}
 
-			if needsLoad || forceLoad {
-				slog.Info("loading data from CSV", "file", csvFilename)
-				data, err := parse(csvFilename)
-				if err != nil {
-					return fmt.Errorf("parse CSV: %w", err)
-				}
-
-				if err := loadParsed(db, data); err != nil {
-					return fmt.Errorf("load data: %w", err)
-				}
+			if needsLoad && c.Args().First() != "load" {
+				return loadCSV(c.Context, db, csvFilename, app.parse)
+			}
 
-				slog.Info(
-					"data loaded",
-					"categories",
-					len(data.Categories),
-					"years",
-					len(data.Years),
+			err = backfillSparklines(c.Context, db)
+			if isReadOnly(err) {
+				slog.Warn(
+					"database is read-only; skipping sparklines",
+					"error", err,
 				)
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("render sparklines: %w", err)
 			}
-
 			return nil
 		},
 		After: func(c *cli.Context) error {
@@ -185,44 +409,253 @@ func main() {
 			{
 				Name:  "serve",
 				Usage: "start web server",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "export-row-limit",
+						Value: 20000,
+						Usage: "rows an export may return without ?confirm=1",
+					},
+					&cli.DurationFlag{
+						Name:  "view-budget",
+						Value: 250 * time.Millisecond,
+						Usage: "log views slower than this (0 disables)",
+					},
+					&cli.StringFlag{
+						Name:  "templates",
+						Value: defaultTemplateSet,
+						Usage: "front-end template set: default or minimal",
+					},
+					&cli.StringFlag{
+						Name:  "base-path",
+						Usage: "URL path prefix to serve under, like /nhe",
+					},
+					&cli.Float64Flag{
+						Name:  "trend-threshold",
+						Value: defaultTrendThreshold,
+						Usage: "annualized percent change that marks a " +
+							"trend arrow as significant",
+					},
+					&cli.IntFlag{
+						Name:  "job-workers",
+						Value: 1,
+						Usage: "background job worker goroutines",
+					},
+					&cli.StringFlag{
+						Name:  "export-dir",
+						Value: defaultExportDir,
+						Usage: "directory export jobs write into",
+					},
+					&cli.BoolFlag{
+						Name:  "access-log",
+						Value: true,
+						Usage: "log each request",
+					},
+					&cli.IntFlag{
+						Name:  "log-sample-after",
+						Value: 100,
+						Usage: "requests per second logged in full before " +
+							"sampling (0 logs everything)",
+					},
+					&cli.Float64Flag{
+						Name:  "log-sample-rate",
+						Value: 0.1,
+						Usage: "fraction of requests logged past " +
+							"--log-sample-after (server errors are " +
+							"always logged)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "log-scrub",
+						Value: cli.NewStringSlice(defaultScrubParams...),
+						Usage: "query parameters whose names contain any of " +
+							"these are redacted in the access log",
+					},
+					&cli.BoolFlag{
+						Name:  "debug-sql",
+						Usage: "allow ?debug=sql to include queries in responses",
+					},
+					&cli.StringFlag{
+						Name:  "years",
+						Value: defaultYearStrategy,
+						Usage: "default display-year strategy " +
+							"(every[:N], milestones:Y1,Y2,..., decades)",
+					},
+					&cli.StringFlag{
+						Name:    "export-key",
+						Usage:   "API key that bypasses the export row limit",
+						EnvVars: []string{"NHE_EXPORT_KEY"},
+					},
+					&cli.StringFlag{
+						Name:    "admin-key",
+						Usage:   "key for /admin pages; they are disabled without it",
+						EnvVars: []string{"NHE_ADMIN_KEY"},
+					},
+				},
 				Action: func(c *cli.Context) error {
 					return serveCmd(app, c)
 				},
 			},
 			{
 				Name:      "dump",
-				Usage:     "dump database contents as text table",
-				ArgsUsage: "[year]",
+				Usage:     "dump one year or a range of years as a table",
+				ArgsUsage: "[year | from-to]",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "text",
+						Usage: "text, latex, or markdown",
+					},
+				}, queryOptionFlags()...),
 				Action: func(c *cli.Context) error {
 					return dumpCmd(app, c)
 				},
 			},
 			{
-				Name:  "load",
-				Usage: "load data from CSV into database",
+				Name:  "export",
+				Usage: "write the data set as a file in one of several formats",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "csv",
+						Usage: "arrow, csv, jsonl, parquet, sql, tsv, txt, or xlsx",
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "-",
+						Usage:   "file to write under --dest, or - for stdout",
+					},
+					&cli.StringFlag{
+						Name:  "years",
+						Value: defaultYearStrategy,
+						Usage: "display-year strategy for the summary table",
+					},
+					&cli.StringFlag{
+						Name:  "dest",
+						Usage: "directory, .zip archive, or s3://bucket/prefix",
+					},
+					&cli.StringFlag{
+						Name:  "verify",
+						Usage: "re-check the files listed in a manifest",
+					},
+				}, queryOptionFlags()...),
+				Action: func(c *cli.Context) error {
+					return exportCmd(app, c)
+				},
+			},
+			{
+				Name:  "tree",
+				Usage: "print the category hierarchy as a tree",
+				Flags: append([]cli.Flag{
+					&cli.IntFlag{
+						Name:  "depth",
+						Usage: "levels to print (0 for all)",
+					},
+					&cli.IntFlag{
+						Name:  "year",
+						Usage: "show amounts for this year",
+					},
+				}, queryOptionFlags()...),
+				Action: func(c *cli.Context) error {
+					return treeCmd(app, c)
+				},
+			},
+			{
+				Name:      "report",
+				Usage:     "write a single-file HTML report with charts",
+				ArgsUsage: "[out.html]",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "dest",
+						Usage: "directory, .zip archive, or s3://bucket/prefix",
+					},
+					&cli.BoolFlag{
+						Name:  "self-contained",
+						Usage: "inline the stylesheet and charts",
+					},
+					&cli.StringFlag{
+						Name:  "base-url",
+						Usage: "server linked assets load from when not inlined",
+					},
+					&cli.StringFlag{
+						Name:  "years",
+						Value: defaultYearStrategy,
+						Usage: "display-year strategy for the summary table",
+					},
+				}, queryOptionFlags()...),
+				Action: func(c *cli.Context) error {
+					return reportCmd(app, c)
+				},
+			},
+			{
+				Name:      "load",
+				Usage:     "load data from CSV into database",
+				ArgsUsage: "[file.csv]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: LayoutWide,
+						Usage: "wide (CMS layout) or long " +
+							"(category_path, year, amount)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return loadCmd(app, c)
+				},
+			},
+			{
+				Name:  "verify",
+				Usage: "cross-check database contents against a CSV file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "csv",
+						Value: csvFilename,
+						Usage: "CSV file to compare against",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return verifyCmd(app, c)
+				},
+			},
+			{
+				Name:  "diff",
+				Usage: "compare the loaded dataset with a new release CSV",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "csv",
+						Value: csvFilename,
+						Usage: "release CSV to compare against",
+					},
+					&cli.StringFlag{
+						Name:  "html",
+						Usage: "write an HTML report to this file",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return diffCmd(app, c)
+				},
+			},
+			viewsCommand(app),
+			annotationsCommand(app),
+			seriesCommand(app),
+			pluginsCommand(app),
+			{
+				Name:  "validate",
+				Usage: "check cross-table consistency rules",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "rules",
+						Usage: "JSON rules file (defaults to the built-in rules)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return validateCmd(app, c)
+				},
+			},
+			{
+				Name:  "rollback",
+				Usage: "restore the dataset from before the last load",
 				Action: func(c *cli.Context) error {
-					if err := clearDatabase(app.db); err != nil {
-						return fmt.Errorf("clear database: %w", err)
-					}
-
-					slog.Info("loading data from CSV", "file", csvFilename)
-					data, err := parse(csvFilename)
-					if err != nil {
-						return fmt.Errorf("parse CSV: %w", err)
-					}
-
-					if err := loadParsed(app.db, data); err != nil {
-						return fmt.Errorf("load data: %w", err)
-					}
-
-					slog.Info(
-						"data loaded",
-						"categories",
-						len(data.Categories),
-						"years",
-						len(data.Years),
-					)
-					return nil
+					return rollbackCmd(app)
 				},
 			},
 		},
@@ -233,14 +666,200 @@ func main() {
 	}
 }
 
-func parse(filename string) (*ParsedData, error) {
+func openDatabase(
+	path string,
+	lockTimeout time.Duration,
+) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", databaseDSN(path, lockTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	_, err = db.Exec("PRAGMA journal_mode = WAL")
+	if err != nil && !isReadOnly(err) {
+		db.Close()
+		return nil, fmt.Errorf("enable WAL: %w", err)
+	}
+
+	err = upgradeSchema(db)
+	if isReadOnly(err) {
+		slog.Warn("database is read-only; skipping schema upgrade", "error", err)
+		err = nil
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	logDegraded(db)
+	return db, nil
+}
+
+func upgradeSchema(db *sql.DB) error {
+	if _, err := db.Exec(schemaSQL); err != nil {
+		return err
+	}
+
+	return migrate(db)
+}
+
+func openEphemeral() (*sql.DB, error) {
+	db, err := openDatabase(
+		fmt.Sprintf(
+			"file:nhe-ephemeral-%d?mode=memory&cache=shared",
+			ephemeralSeq.Add(1),
+		),
+		defaultLockTimeout,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	data, err := parseReader(ctx, bytes.NewReader(fixtureCSV))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("parse fixture: %w", err)
+	}
+
+	if err := loadParsed(ctx, db, data); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load fixture: %w", err)
+	}
+
+	return db, nil
+}
+
+func logLoaded(data *ParsedData) {
+	slog.Info(
+		"data loaded",
+		"categories",
+		len(data.Categories),
+		"years",
+		len(data.Years),
+	)
+}
+
+func loadCSV(
+	ctx context.Context,
+	db *sql.DB,
+	filename string,
+	opts parseOptions,
+) error {
+	slog.Info("loading data from CSV", "file", filename)
+	data, err := parse(ctx, filename, opts)
+	if err != nil {
+		return fmt.Errorf("parse CSV: %w", err)
+	}
+
+	if err := loadParsed(ctx, db, data); err != nil {
+		return fmt.Errorf("load data: %w", err)
+	}
+
+	logLoaded(data)
+	return nil
+}
+
+func reloadCSV(ctx context.Context, app *App, filename string) error {
+	slog.Info("loading data from CSV", "file", filename)
+	data, err := parse(ctx, filename, app.parse)
+	if err != nil {
+		return fmt.Errorf("parse CSV: %w", err)
+	}
+
+	return reloadParsed(ctx, app, data)
+}
+
+func reloadParsed(ctx context.Context, app *App, data *ParsedData) error {
+	tx, err := beginWrite(ctx, app.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := backupDatabase(app); err != nil {
+		return fmt.Errorf("backup database: %w", err)
+	}
+
+	if err := clearTables(ctx, tx); err != nil {
+		return fmt.Errorf("clear database: %w", err)
+	}
+	if err := loadTx(ctx, tx, data); err != nil {
+		return fmt.Errorf("load data: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	checkpoint(ctx, app.db)
+
+	logLoaded(data)
+	return nil
+}
+
+func parse(
+	ctx context.Context,
+	filename string,
+	opts parseOptions,
+) (*ParsedData, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	reader := csv.NewReader(f)
+	data, err := parseDelimited(
+		ctx,
+		f,
+		fileInputFormat(opts.format, filename),
+		opts.duplicatePolicy(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Source = filename
+	return data, nil
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+type categoryKey struct {
+	section int
+	parent  int
+	name    string
+}
+
+func parseReader(ctx context.Context, r io.Reader) (*ParsedData, error) {
+	return parseDelimited(ctx, r, InputAuto, DuplicatesFirst)
+}
+
+func parseDelimited(
+	ctx context.Context,
+	r io.Reader,
+	format string,
+	dups string,
+) (*ParsedData, error) {
+	var (
+		hash = sha256.New()
+		br   = bufio.NewReader(io.TeeReader(ctxReader{ctx, r}, hash))
+	)
+	reader := csv.NewReader(br)
+	reader.Comma = inputDelimiter(format, br)
 	records, err := reader.ReadAll()
 	if err != nil {
 		return nil, err
@@ -250,26 +869,55 @@ func parse(filename string) (*ParsedData, error) {
 		return nil, fmt.Errorf("CSV too short")
 	}
 
-	yearRow := records[1]
-	years := make([]int, 0, len(yearRow)-1)
+	var (
+		yearRow = records[1]
+		scale   = headerScale(yearRow[0])
+	)
+	data := &ParsedData{
+		Version:      hex.EncodeToString(hash.Sum(nil))[:12],
+		Source:       "embedded",
+		Categories:   make([]Category, 0),
+		Expenditures: make(map[int]map[int]*int),
+		Suppressed:   make(map[int]map[int]bool),
+		Notes:        SourceNotes{Title: strings.TrimSpace(records[0][0])},
+	}
+
+	var (
+		columns = len(yearRow) - 1
+		slots   = make([]int, len(yearRow))
+		seen    = map[int]int{}
+	)
 	for i := 1; i < len(yearRow); i++ {
 		year, err := strconv.Atoi(yearRow[i])
 		if err != nil {
 			return nil, fmt.Errorf("invalid year at column %d: %v", i, err)
 		}
-		years = append(years, year)
-	}
-
-	data := &ParsedData{
-		Years:        years,
-		Categories:   make([]Category, 0),
-		Expenditures: make(map[int]map[int]*int),
+		if col, ok := seen[year]; ok {
+			if dups == DuplicatesError {
+				return nil, fmt.Errorf(
+					"year %d repeated in columns %d and %d",
+					year,
+					col,
+					i,
+				)
+			}
+			data.warn(1, yearRow[0], "year %d repeated in column %d", year, i)
+			slots[i] = slots[col]
+			continue
+		}
+		data.Years = append(data.Years, year)
+		seen[year] = i
+		slots[i] = len(data.Years)
 	}
+	years := data.Years
 
 	var (
 		parentStack = []int{}
 		last        = -1
 		categoryID  = 0
+		prevID      = 0
+		section     = 0
+		seenRows    = map[categoryKey][2]int{}
 	)
 
 	for rowIdx := 2; rowIdx < len(records); rowIdx++ {
@@ -287,13 +935,16 @@ func parse(filename string) (*ParsedData, error) {
 		if name == "" {
 			continue
 		}
+		if footnoteRow(name, row[1:]) {
+			data.Notes.Footnotes = append(data.Notes.Footnotes, name)
+			continue
+		}
 
-		categoryID++
 		parentID := 0
 
 		if indent > last {
-			if categoryID > 1 {
-				parentID = categoryID - 1
+			if prevID > 0 {
+				parentID = prevID
 				parentStack = append(parentStack, parentID)
 			}
 		} else if indent < last {
@@ -314,20 +965,74 @@ func parse(filename string) (*ParsedData, error) {
 			name != "POPULATION" &&
 			!strings.HasPrefix(name, "Total CMS Programs")
 
-		cat := Category{
-			Name:           name,
-			ParentID:       parentID,
-			IndentLevel:    indent,
-			SortOrder:      rowIdx - 1,
-			IsMajorHeading: isMajorHeading,
+		key := categoryKey{
+			section: section,
+			parent:  parentID,
+			name:    name,
+		}
+		if isMajorHeading {
+			key = categoryKey{name: name}
+		}
+		seen, dup := seenRows[key]
+		id := seen[0]
+		if dup && dups == DuplicatesError {
+			return nil, fmt.Errorf(
+				"row %d (%s): duplicates row %d",
+				rowIdx+1,
+				name,
+				seen[1]+1,
+			)
+		}
+		if dup {
+			data.warn(rowIdx, name, "duplicates row %d", seen[1]+1)
+		} else {
+			categoryID++
+			id = categoryID
+			seenRows[key] = [2]int{id, rowIdx}
+
+			units, catScale := seriesUnits(name, scale)
+			data.Categories = append(data.Categories, Category{
+				Name:           name,
+				ParentID:       parentID,
+				IndentLevel:    indent,
+				SortOrder:      rowIdx - 1,
+				IsMajorHeading: isMajorHeading,
+				Units:          units,
+				Scale:          catScale,
+			})
+			data.Expenditures[id] = make(map[int]*int)
+			data.Suppressed[id] = make(map[int]bool)
+		}
+		prevID = id
+		if isMajorHeading {
+			section = id
 		}
-		data.Categories = append(data.Categories, cat)
 
-		data.Expenditures[categoryID] = make(map[int]*int)
-		for i := 1; i < len(row) && i <= len(years); i++ {
+		var (
+			values     = data.Expenditures[id]
+			suppressed = data.Suppressed[id]
+			present    = 0
+		)
+		for i := 1; i < len(row) && i <= columns; i++ {
 			val := strings.TrimSpace(row[i])
-			if val == "" || val == "-" {
-				data.Expenditures[categoryID][i] = nil
+			if val != "" {
+				present++
+			}
+
+			slot := slots[i]
+			if _, ok := values[slot]; ok && dups == DuplicatesFirst {
+				continue
+			}
+			delete(suppressed, slot)
+
+			switch status, marker := classifyCell(val); {
+			case status == CellNoData:
+				values[slot] = nil
+				continue
+			case marker:
+				zero := 0
+				values[slot] = &zero
+				suppressed[slot] = true
 				continue
 			}
 
@@ -335,9 +1040,31 @@ func parse(filename string) (*ParsedData, error) {
 			val = strings.Trim(val, "\"")
 
 			// simple static data set
-			amount, _ := strconv.Atoi(val)
+			amount, err := strconv.Atoi(val)
+			if err != nil {
+				data.warn(
+					rowIdx,
+					name,
+					"invalid amount %q for %d",
+					val,
+					years[slot-1],
+				)
+			}
+
+			values[slot] = &amount
+		}
 
-			data.Expenditures[categoryID][i] = &amount
+		if len(row)-1 < columns {
+			data.warn(
+				rowIdx,
+				name,
+				"%d of %d year cells missing",
+				columns-(len(row)-1),
+				columns,
+			)
+		}
+		if present == 0 {
+			data.warn(rowIdx, name, "no values")
 		}
 
 		last = indent
@@ -358,15 +1085,27 @@ func ldSpc(s string) int {
 	return count
 }
 
-func loadParsed(db *sql.DB, data *ParsedData) error {
-	tx, err := db.Begin()
+func loadParsed(ctx context.Context, db *sql.DB, data *ParsedData) error {
+	tx, err := beginWrite(ctx, db)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	if err := loadTx(ctx, tx, data); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	checkpoint(ctx, db)
+	return nil
+}
+
+func loadTx(ctx context.Context, tx *sql.Tx, data *ParsedData) error {
 	for _, year := range data.Years {
-		_, err := tx.Exec(
+		_, err := tx.ExecContext(
+			ctx,
 			"INSERT OR IGNORE INTO years (year) VALUES (?)",
 			year,
 		)
@@ -376,7 +1115,7 @@ func loadParsed(db *sql.DB, data *ParsedData) error {
 	}
 
 	yearIDMap := make(map[int]int)
-	rows, err := tx.Query("SELECT id, year FROM years")
+	rows, err := tx.QueryContext(ctx, "SELECT id, year FROM years")
 	if err != nil {
 		return err
 	}
@@ -407,15 +1146,19 @@ func loadParsed(db *sql.DB, data *ParsedData) error {
 			isMajorHeading = 1
 		}
 
-		result, err := tx.Exec(
+		result, err := tx.ExecContext(
+			ctx,
 			`INSERT INTO categories
-			(name, parent_id, indent_level, sort_order, is_major_heading)
-			VALUES (?, ?, ?, ?, ?)`,
+			(name, parent_id, indent_level, sort_order, is_major_heading,
+			units, scale)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
 			cat.Name,
 			parentID,
 			cat.IndentLevel,
 			cat.SortOrder,
 			isMajorHeading,
+			cat.Units,
+			cat.Scale,
 		)
 		if err != nil {
 			return fmt.Errorf("insert category %s: %w", cat.Name, err)
@@ -428,13 +1171,15 @@ func loadParsed(db *sql.DB, data *ParsedData) error {
 		categoryIDMap[categoryNum] = int(lastID)
 	}
 
-	for catNum, yearMap := range data.Expenditures {
+	for _, catNum := range slices.Sorted(maps.Keys(data.Expenditures)) {
 		dbCategoryID, ok := categoryIDMap[catNum]
 		if !ok {
 			continue
 		}
 
-		for yearIdx, amount := range yearMap {
+		yearMap := data.Expenditures[catNum]
+		for _, yearIdx := range slices.Sorted(maps.Keys(yearMap)) {
+			amount := yearMap[yearIdx]
 			if yearIdx < 1 || yearIdx > len(data.Years) {
 				continue
 			}
@@ -445,13 +1190,16 @@ func loadParsed(db *sql.DB, data *ParsedData) error {
 				continue
 			}
 
-			_, err := tx.Exec(
+			status := cellStatus(amount, data.Suppressed[catNum][yearIdx])
+			_, err := tx.ExecContext(
+				ctx,
 				`INSERT INTO expenditures
-				(category_id, year_id, amount)
-				VALUES (?, ?, ?)`,
+				(category_id, year_id, amount, status)
+				VALUES (?, ?, ?, ?)`,
 				dbCategoryID,
 				yearID,
 				amount,
+				status,
 			)
 			if err != nil {
 				return fmt.Errorf(
@@ -464,205 +1212,592 @@ func loadParsed(db *sql.DB, data *ParsedData) error {
 		}
 	}
 
-	return tx.Commit()
-}
+	if err := renderSparklines(ctx, tx); err != nil {
+		return fmt.Errorf("render sparklines: %w", err)
+	}
 
-func databaseEmpty(db *sql.DB) (bool, error) {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count)
+	result, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO loads (version, source) VALUES (?, ?)",
+		data.Version,
+		data.Source,
+	)
 	if err != nil {
-		return false, err
+		return fmt.Errorf("record load: %w", err)
 	}
-	return count == 0, nil
-}
 
-func clearDatabase(db *sql.DB) error {
-	tx, err := db.Begin()
+	loadID, err := result.LastInsertId()
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	if _, err := tx.Exec("DELETE FROM expenditures"); err != nil {
-		return err
-	}
-	if _, err := tx.Exec("DELETE FROM categories"); err != nil {
-		return err
+	for _, warning := range data.Warnings {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO load_warnings (load_id, message) VALUES (?, ?)",
+			loadID,
+			warning,
+		)
+		if err != nil {
+			return fmt.Errorf("record load warning: %w", err)
+		}
 	}
-	if _, err := tx.Exec("DELETE FROM years"); err != nil {
-		return err
+
+	if err := recordSourceNotes(ctx, tx, loadID, data.Notes); err != nil {
+		return fmt.Errorf("record source notes: %w", err)
 	}
 
-	return tx.Commit()
+	return nil
 }
 
-// this is really just sanity check code
-func dumpCmd(app *App, c *cli.Context) error {
-	year := 2023
-	if c.Args().Len() > 0 {
-		y, err := strconv.Atoi(c.Args().First())
-		if err != nil {
-			return fmt.Errorf("invalid year: %v", err)
-		}
-		year = y
-	}
-
-	rows, err := app.db.Query(`
-		SELECT
-			c.name,
-			c.indent_level,
-			e.amount
-		FROM expenditures e
-		JOIN categories c ON c.id = e.category_id
-		JOIN years y ON y.id = e.year_id
-		WHERE y.year = ?
-		ORDER BY c.sort_order
-	`, year)
+func databaseEmpty(db *sql.DB) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+func clearTables(ctx context.Context, tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`DELETE FROM expenditures WHERE category_id IN
+			(SELECT id FROM categories WHERE source != 'user')`,
+		"DELETE FROM categories WHERE source != 'user'",
+		`DELETE FROM years WHERE id NOT IN
+			(SELECT year_id FROM expenditures)`,
+		"DELETE FROM sparklines",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clearDatabase(db *sql.DB) error {
+	ctx := context.Background()
+	tx, err := beginWrite(ctx, db)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	fmt.Printf("National Health Expenditures - Year %d\n", year)
-	fmt.Printf("%s\n", strings.Repeat("=", 70))
-	fmt.Printf("%-60s  %10s\n", "CATEGORY", "AMOUNT")
-	fmt.Printf("%s\n", strings.Repeat("-", 70))
+	if err := clearTables(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	for rows.Next() {
-		var (
-			name   string
-			indent int
-			amount *int
-		)
+// this is really just sanity check code
+func nheTextTable(data *TableData, width int) texttable.Table {
+	table := texttable.Table{
+		Title: "National Health Expenditures",
+		Width: width,
+		Columns: []texttable.Column{
+			{Header: "CATEGORY", Truncate: true},
+		},
+	}
 
-		if err := rows.Scan(&name, &indent, &amount); err != nil {
-			return err
+	for _, year := range data.Years {
+		table.Columns = append(table.Columns, texttable.Column{
+			Header: data.Basis.Label(year),
+			Width:  9,
+			Align:  texttable.Right,
+		})
+	}
+
+	for _, cat := range data.Categories {
+		row := []string{cat.Name}
+		for i := range cat.Values {
+			row = append(row, cat.Display(i))
 		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table
+}
+
+const totalCategory = "Total National Health Expenditures"
+
+const yearsQuery = "SELECT year FROM years ORDER BY year"
+
+const seriesQuery = `
+	SELECT
+		c.id,
+		c.name,
+		%s,
+		%s,
+		%s,
+		c.is_major_heading,
+		%s,
+		y.year,
+		e.amount,
+		%s
+	FROM expenditures e
+	JOIN categories c ON c.id = e.category_id
+	JOIN years y ON y.id = e.year_id
+	WHERE c.name = ? OR (%s)
+	ORDER BY %s
+`
+
+type SQLStatement struct {
+	Query string `json:"query"`
+	Args  []any  `json:"args,omitempty"`
+}
+
+func seriesSQL(f queryFilter) SQLStatement {
+	cond := fmt.Sprintf(
+		"c.is_major_heading = 1 OR %s = '%s'",
+		f.caps.source("c"),
+		SourceUser,
+	)
+	args := []any(nil)
+	if f.ids != nil {
+		cond, args = f.categoryWhere()
+	}
+	return SQLStatement{
+		Query: fmt.Sprintf(
+			seriesQuery,
+			f.caps.units("c"),
+			f.caps.scale("c"),
+			f.caps.sparkline("c"),
+			f.caps.source("c"),
+			f.caps.status("e"),
+			cond,
+			f.orderBy(),
+		),
+		Args: append([]any{totalCategory}, args...),
+	}
+}
+
+func tableSQL(db *sql.DB, opts QueryOptions) ([]SQLStatement, error) {
+	f, err := opts.resolve(db)
+	if err != nil {
+		return nil, err
+	}
+	return []SQLStatement{
+		{Query: yearsQuery},
+		seriesSQL(f),
+	}, nil
+}
+
+type seriesRow struct {
+	TableCategory
+	id    int
+	major bool
+}
+
+func loadSeries(
+	db *sql.DB,
+	years []int,
+	f queryFilter,
+) ([]seriesRow, error) {
+	index := make(map[int]int, len(years))
+	for i, year := range years {
+		index[year] = i
+	}
+
+	stmt := seriesSQL(f)
+	rows, err := db.Query(stmt.Query, stmt.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var (
+		series []seriesRow
+		lastID = -1
+	)
+	for rows.Next() {
 		var (
-			indentStr = strings.Repeat("  ", indent/5)
-			fullName  = indentStr + name
+			id     int
+			row    seriesRow
+			source string
+			year   int
+			amount *int
+			status CellStatus
+		)
+		err := rows.Scan(
+			&id,
+			&row.Name,
+			&row.Units,
+			&row.Scale,
+			&row.Sparkline,
+			&row.major,
+			&source,
+			&year,
+			&amount,
+			&status,
 		)
+		if err != nil {
+			return nil, err
+		}
 
-		amountStr := "N/A"
-		if amount != nil {
-			amountStr = fmt.Sprintf("%d", *amount)
+		if id != lastID {
+			row.id = id
+			row.User = source == SourceUser
+			row.Values = make([]*int, len(years))
+			row.Status = make([]CellStatus, len(years))
+			for i := range row.Status {
+				row.Status[i] = CellNoData
+			}
+			series = append(series, row)
+			lastID = id
 		}
 
-		fmt.Printf("%-60s  %10s\n", fullName, amountStr)
+		if i, ok := index[year]; ok {
+			series[len(series)-1].Values[i] = amount
+			series[len(series)-1].Status[i] = status
+		}
 	}
 
-	return rows.Err()
+	return series, rows.Err()
 }
 
-func nheData(db *sql.DB) (*TableData, error) {
-	allYears := []int{}
-
-	rows, err := db.Query("SELECT year FROM years ORDER BY year")
+func queryYears(db *sql.DB) ([]int, error) {
+	rows, err := db.Query(yearsQuery)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	years := []int{}
 	for rows.Next() {
 		var year int
 		if err := rows.Scan(&year); err != nil {
-			rows.Close()
 			return nil, err
 		}
-		allYears = append(allYears, year)
+		years = append(years, year)
 	}
-	rows.Close()
+	return years, rows.Err()
+}
 
-	// we only display every 3rd year
-	displayYears := []int{}
-	for i := len(allYears) - 1; i >= 0; i -= 3 {
-		displayYears = append(displayYears, allYears[i])
-	}
-
-	totals := map[int]*int{}
-	for _, year := range displayYears {
-		var total *int
-		err := db.QueryRow(`
-			SELECT e.amount
-			FROM expenditures e
-			JOIN years y ON y.id = e.year_id
-			JOIN categories c ON c.id = e.category_id
-			WHERE y.year = ? AND c.name = 'Total National Health Expenditures'
-		`, year).Scan(&total)
-		if err == nil {
-			totals[year] = total
-		}
-	}
-
-	rows, err = db.Query(`
-		SELECT id, name
-		FROM categories
-		WHERE is_major_heading = 1
-		ORDER BY sort_order
-	`)
+func nheData(
+	db *sql.DB,
+	view TableView,
+	opts QueryOptions,
+) (*TableData, error) {
+	if err := opts.amountsOnly(); err != nil {
+		return nil, err
+	}
+
+	f, err := opts.resolve(db)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var categories []TableCategory
-	for rows.Next() {
+	allYears, err := queryYears(db)
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := loadSeries(db, allYears, f)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := categoryRefs(db)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		slugs    = make(map[int]string, len(refs))
+		parents  = make(map[int]*int, len(refs))
+		children = map[int]int{}
+	)
+	for _, ref := range refs {
+		slugs[ref.ID] = ref.Slug
+		parents[ref.ID] = ref.ParentID
+		if ref.ParentID != nil {
+			children[*ref.ParentID]++
+		}
+	}
+	depth := func(id int) int {
+		n := 0
+		for p := parents[id]; p != nil && n < len(refs); p = parents[*p] {
+			n++
+		}
+		return n
+	}
+
+	years := basisYears(view.Basis, allYears)
+	for i := range series {
+		series[i].Values = basisValues(view.Basis, allYears, series[i].Values)
+		series[i].Status = basisStatus(view.Basis, allYears, series[i].Status)
+	}
+
+	var inRange, rangeYears []int
+	for i, year := range years {
+		if f.wantsYear(year) {
+			inRange = append(inRange, i)
+			rangeYears = append(rangeYears, year)
+		}
+	}
+
+	displayIdx := view.Years.Select(rangeYears)
+	for i, idx := range displayIdx {
+		displayIdx[i] = inRange[idx]
+	}
+
+	displayYears := make([]int, len(displayIdx))
+	for i, idx := range displayIdx {
+		displayYears[i] = years[idx]
+	}
+
+	var (
+		totals     = map[int]*int{}
+		categories []TableCategory
+	)
+	for _, s := range series {
 		var (
-			id   int
-			name string
+			values   = make([]*int, len(displayIdx))
+			status   = make([]CellStatus, len(displayIdx))
+			previous = make([]*int, len(displayIdx))
+			hasData  = false
 		)
-		if err := rows.Scan(&id, &name); err != nil {
-			return nil, err
+		for i, idx := range displayIdx {
+			values[i] = s.Values[idx]
+			status[i] = s.Status[idx]
+			if idx > 0 {
+				previous[i] = s.Values[idx-1]
+			}
+			if values[i] != nil {
+				hasData = true
+			}
 		}
 
-		values := make([]*int, len(displayYears))
-		hasData := false
-		for i, year := range displayYears {
-			var amount *int
-			err := db.QueryRow(`
-				SELECT e.amount
-				FROM expenditures e
-				JOIN years y ON y.id = e.year_id
-				WHERE e.category_id = ? AND y.year = ?
-			`, id, year).Scan(&amount)
-			if err == nil {
-				values[i] = amount
-				if amount != nil {
-					hasData = true
-				}
+		if s.Name == totalCategory {
+			for i, year := range displayYears {
+				totals[year] = values[i]
 			}
 		}
 
-		if hasData {
-			categories = append(categories, TableCategory{
-				Name:   name,
-				Values: values,
-			})
+		keep := s.major || s.User
+		if f.filtersCategories() {
+			keep = f.wantsCategory(s.id, s.Units) &&
+				(keep || f.ids != nil)
 		}
+		if keep && hasData {
+			s.TableCategory.ID = s.id
+			s.TableCategory.Slug = slugs[s.id]
+			s.TableCategory.Depth = depth(s.id)
+			s.TableCategory.Expandable = children[s.id] > 0
+			s.TableCategory.Major = s.major
+			s.TableCategory.Values = values
+			s.TableCategory.Status = status
+			s.TableCategory.Previous = previous
+			categories = append(categories, s.TableCategory)
+		}
+	}
+
+	about, err := sourceNotes(db)
+	if err != nil {
+		return nil, err
 	}
 
 	return &TableData{
-		Years:      displayYears,
-		Categories: categories,
-		Totals:     totals,
+		Years:       displayYears,
+		Categories:  categories,
+		Totals:      totals,
+		Basis:       view.Basis,
+		Strategy:    view.Years.String(),
+		Available:   years,
+		Derivations: tableDerivations(view.Basis),
+		About:       about,
 	}, nil
 }
 
+func formatNumber(n *int) string {
+	return formatScaled(n, unitsUSD, 1_000_000)
+}
+
+const yearsPerPage = 24
+
+func pageYears(data *TableData, page, perPage int) *TableData {
+	pages := max(1, (len(data.Years)+perPage-1)/perPage)
+	page = min(max(page, 1), pages)
+
+	var (
+		lo = (page - 1) * perPage
+		hi = min(lo+perPage, len(data.Years))
+	)
+
+	paged := &TableData{
+		Years:       data.Years[lo:hi],
+		Totals:      data.Totals,
+		Decades:     decades(data.Years[lo:hi]),
+		Page:        page,
+		Pages:       pages,
+		Basis:       data.Basis,
+		Strategy:    data.Strategy,
+		Views:       data.Views,
+		Available:   data.Available,
+		Derivations: data.Derivations,
+		About:       data.About,
+		Expand:      data.Expand,
+	}
+	prior := priorColumns(data.Years[lo:hi], data.Years)
+	for _, j := range prior {
+		paged.PriorYears = append(paged.PriorYears, yearAt(data.Years, j))
+	}
+
+	for _, cat := range data.Categories {
+		cat.Prior = make([]*int, len(prior))
+		for i, j := range prior {
+			if j >= 0 {
+				cat.Prior[i] = cat.Values[j]
+			}
+		}
+		cat.Values = cat.Values[lo:hi]
+		cat.Status = cat.Status[lo:hi]
+		if cat.Previous != nil {
+			cat.Previous = cat.Previous[lo:hi]
+		}
+		paged.Categories = append(paged.Categories, cat)
+	}
+
+	return paged
+}
+
+func decades(years []int) []Decade {
+	var groups []Decade
+	for _, year := range years {
+		label := decadeLabel(year)
+		if n := len(groups); n > 0 && groups[n-1].Label == label {
+			groups[n-1].Span++
+			continue
+		}
+		groups = append(groups, Decade{Label: label, Span: 1})
+	}
+	return groups
+}
+
+func renderPage(
+	w http.ResponseWriter,
+	r *http.Request,
+	tmpl *template.Template,
+	name string,
+	data any,
+) {
+	start := time.Now()
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	timingFrom(r.Context()).track("render", start)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := buf.WriteTo(w); err != nil {
+		slog.Error("write response", "template", name, "error", err)
+	}
+}
+
 func serveCmd(app *App, c *cli.Context) error {
-	mux := http.NewServeMux()
+	if err := validateServe(c); err != nil {
+		return err
+	}
+
+	app.debugSQL = c.Bool("debug-sql")
+
+	years, err := parseYearStrategy(c.String("years"))
+	if err != nil {
+		return err
+	}
+	app.years = years
+	app.adminKey = c.String("admin-key")
+	app.templates = c.String("templates")
+	app.workers = c.Int("job-workers")
+	app.exportDir = c.String("export-dir")
+	if app.base, err = parseBasePath(c.String("base-path")); err != nil {
+		return err
+	}
+	app.threshold = c.Float64("trend-threshold")
+
+	guard := exportGuard{
+		rowLimit: c.Int("export-row-limit"),
+		apiKey:   c.String("export-key"),
+	}
+
+	handler, err := newHandler(c.Context, app, guard)
+	if err != nil {
+		return err
+	}
+
+	handler = withTiming(handler, c.Duration("view-budget"))
+	if app.base != "" {
+		handler = http.StripPrefix(app.base, handler)
+	}
+	if c.Bool("access-log") {
+		handler = withAccessLog(handler, newAccessLog(accessLogConfig{
+			sampleAfter: c.Int("log-sample-after"),
+			sampleRate:  c.Float64("log-sample-rate"),
+			scrub:       c.StringSlice("log-scrub"),
+		}))
+	}
+
+	app.server = &http.Server{
+		Addr:    ":8080",
+		Handler: handler,
+	}
+
+	ctx, stop := signal.NotifyContext(
+		c.Context,
+		os.Interrupt,
+		syscall.SIGTERM,
+	)
+	defer stop()
+
+	go warmViews(app)
+	go watchReloads(ctx, app, reloadPollInterval)
+
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "addr", app.server.Addr)
+		errc <- app.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		app.jobs.close()
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(),
+		shutdownTimeout,
+	)
+	defer cancel()
+	err = app.server.Shutdown(shutdownCtx)
+	app.jobs.close()
+	return err
+}
+
+const defaultTemplateSet = "default"
+
+const shutdownTimeout = 10 * time.Second
+
+var templateSets = map[string][]string{
+	"default": {"templates/*.html"},
+	"minimal": {"templates/*.html", "templates/minimal/*.html"},
+}
+
+func parseTemplates(set string) (*template.Template, error) {
+	if set == "" {
+		set = defaultTemplateSet
+	}
+	patterns, ok := templateSets[set]
+	if !ok {
+		return nil, fmt.Errorf("unknown template set %q", set)
+	}
 
 	funcMap := template.FuncMap{
-		"formatNumber": func(n *int) string {
-			if n == nil {
-				return "N/A"
-			}
-			val := float64(*n)
-			if val >= 1000000 {
-				return fmt.Sprintf("$%.2fT", val/1000000)
-			} else if val >= 1000 {
-				return fmt.Sprintf("$%.2fB", val/1000)
-			}
-			return fmt.Sprintf("$%.2fM", val)
-		},
+		"formatNumber": formatNumber,
+		"formatAmount": formatAmount,
 		"formatPercent": func(amount *int, year int, totals map[int]*int) string {
 			if amount == nil {
 				return ""
@@ -674,80 +1809,835 @@ func serveCmd(app *App, c *cli.Context) error {
 			pct := float64(*amount) / float64(*total) * 100
 			return fmt.Sprintf("%.1f%%", pct)
 		},
+		"yearStrategyPresets": func() []YearStrategyPreset {
+			return yearStrategyPresets
+		},
+		"qualityColor": qualityColor,
+		"formatPct": func(pct *float64) string {
+			if pct == nil {
+				return ""
+			}
+			return fmt.Sprintf("%.1f%%", *pct)
+		},
+		"add": func(a, b int) int {
+			return a + b
+		},
 		"trimPrefix": func(s, prefix string) string {
 			return strings.TrimPrefix(s, prefix)
 		},
-		"heatmapColor": func(amount *int, year int, totals map[int]*int, catIdx int) string {
-			if catIdx < 3 {
-				return "bg-gray-100"
-			}
-			if amount == nil {
-				return "bg-gray-100"
-			}
-			total, ok := totals[year]
-			if !ok || total == nil || *total == 0 {
-				return "bg-gray-100"
-			}
-			pct := float64(*amount) / float64(*total) * 100
-
-			if pct >= 15 {
-				return "bg-red-200"
-			} else if pct >= 13.5 {
-				return "bg-orange-200"
-			} else if pct >= 12 {
-				return "bg-amber-200"
-			} else if pct >= 10.5 {
-				return "bg-yellow-200"
-			} else if pct >= 9 {
-				return "bg-lime-200"
-			} else if pct >= 7.5 {
-				return "bg-green-200"
-			} else if pct >= 6 {
-				return "bg-teal-200"
-			} else if pct >= 4.5 {
-				return "bg-cyan-200"
-			} else if pct >= 3 {
-				return "bg-sky-200"
-			} else if pct >= 1.5 {
-				return "bg-blue-200"
-			} else {
-				return "bg-blue-200"
-			}
+		"heatmapColor": heatmapColor,
+		"tableRow":     tableRow,
+		"heatmapScales": func() []HeatmapScale {
+			return heatmapScales
+		},
+		"heatmapCurves": func() []HeatmapCurve {
+			return heatmapCurves
+		},
+		"displayModes": func() []DisplayMode {
+			return displayModes
+		},
+		"shortYear": shortYear,
+		"compactNumber": func(v float64) string {
+			return localeEnglish.Compact(v, 1)
+		},
+		"url": func(path string) string {
+			return path
 		},
 	}
 
 	tmpl, err := template.New("").Funcs(funcMap).ParseFS(
 		templateFS,
-		"templates/*.html",
+		patterns...,
 	)
 	if err != nil {
-		return fmt.Errorf("parse templates: %w", err)
+		return nil, fmt.Errorf("parse templates: %w", err)
+	}
+
+	missing, err := missingOverrides(patterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		slog.Warn(
+			"template set falls back to default templates",
+			"set", set,
+			"templates", missing,
+		)
+	}
+	return tmpl, nil
+}
+
+func missingOverrides(patterns []string) ([]string, error) {
+	if len(patterns) < 2 {
+		return nil, nil
+	}
+
+	overrides := map[string]bool{}
+	for _, pattern := range patterns[1:] {
+		names, err := fs.Glob(templateFS, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("glob templates: %w", err)
+		}
+		for _, name := range names {
+			overrides[path.Base(name)] = true
+		}
+	}
+
+	names, err := fs.Glob(templateFS, patterns[0])
+	if err != nil {
+		return nil, fmt.Errorf("glob templates: %w", err)
 	}
+	var missing []string
+	for _, name := range names {
+		if !overrides[path.Base(name)] {
+			missing = append(missing, path.Base(name))
+		}
+	}
+	return missing, nil
+}
+
+func newHandler(
+	ctx context.Context,
+	app *App,
+	guard exportGuard,
+) (http.Handler, error) {
+	tmpl, err := parseTemplates(app.templates)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Funcs(template.FuncMap{"url": app.url})
 
 	staticSub, err := fs.Sub(staticFS, "static")
 	if err != nil {
-		return fmt.Errorf("sub static: %w", err)
+		return nil, fmt.Errorf("sub static: %w", err)
 	}
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticSub))))
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		data, err := nheData(app.db)
+	app.jobs = newJobQueue(ctx, app, app.workers)
+
+	var routes []Route
+	routes = []Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/static/",
+			Summary: "Embedded stylesheets",
+			Handler: http.StripPrefix(
+				"/static/",
+				http.FileServer(http.FS(staticSub)),
+			),
+			Auth:  AuthPublic,
+			Cache: CacheStatic,
+			Rate:  RateUnlimited,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/{$}",
+			Summary: "Expenditure table",
+			Handler: indexHandler(app, tmpl, &routes),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+			Stale:   viewStaleness,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/theme",
+			Summary: "Choose the light or dark theme; stored in a cookie",
+			Handler: themeHandler(app),
+			Auth:    AuthPublic,
+			Cache:   CacheNoStore,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/rows",
+			Summary: "Pin or hide table rows; stored in cookies",
+			Handler: rowPrefsHandler(app),
+			Auth:    AuthPublic,
+			Cache:   CacheNoStore,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/table",
+			Summary: "Expenditure table and view controls as HTML fragments",
+			Handler: tableFragmentHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+			Stale:   viewStaleness,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/print",
+			Summary: "Full table in black and white, one section per page",
+			Handler: printHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/compare",
+			Summary: "Two years side by side with their change",
+			Handler: compareHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/category/{id}",
+			Summary: "One category's full annual series",
+			Handler: categoryDetailHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/children/{slug...}",
+			Summary: "Table rows for a category's children, as an HTML fragment",
+			Handler: childrenHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/export.txt",
+			Summary: "Plain-text table export",
+			Handler: textExportHandler(app, guard),
+			Auth:    AuthExport,
+			Cache:   CacheRevalidate,
+			Rate:    RateExport,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/export.csv",
+			Summary: "CSV export of every expenditure",
+			Handler: delimitedExportHandler(app, guard, csvFormat),
+			Auth:    AuthExport,
+			Cache:   CacheRevalidate,
+			Rate:    RateExport,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/export.tsv",
+			Summary: "Tab-separated export of every expenditure",
+			Handler: delimitedExportHandler(app, guard, tsvFormat),
+			Auth:    AuthExport,
+			Cache:   CacheRevalidate,
+			Rate:    RateExport,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/export.xlsx",
+			Summary: "Excel workbook with summary and hierarchy sheets",
+			Handler: xlsxExportHandler(app, guard),
+			Auth:    AuthExport,
+			Cache:   CacheRevalidate,
+			Rate:    RateExport,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/sparklines/{file}",
+			Summary: "Pre-rendered category sparkline by content hash",
+			Handler: sparklineHandler(app),
+			Auth:    AuthPublic,
+			Cache:   CacheImmutable,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/series/{slug...}",
+			Summary: "One category's series as two-column CSV",
+			Params:  []RouteParam{shapeParam},
+			Handler: seriesCSVHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/lines",
+			Summary: "Line chart of selected categories across all years",
+			Params: []RouteParam{
+				{
+					Name:        "category",
+					In:          "query",
+					Type:        "string",
+					Description: "Category slug to plot; repeatable",
+				},
+				{
+					Name:        "metric",
+					In:          "query",
+					Type:        "string",
+					Description: "amount (default), share, or growth",
+				},
+			},
+			Handler: linesHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/payers",
+			Summary: "Stacked area chart of spending by source of funds",
+			Params: []RouteParam{
+				{
+					Name:        "mode",
+					In:          "query",
+					Type:        "string",
+					Description: "pct (share of total, default) or dollars",
+				},
+			},
+			Handler: payersHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/treemap",
+			Summary: "Treemap of one year's spending by category",
+			Params: []RouteParam{
+				{
+					Name:        "year",
+					In:          "query",
+					Type:        "integer",
+					Description: "Year to show (defaults to the latest)",
+				},
+				{
+					Name:        "category",
+					In:          "query",
+					Type:        "string",
+					Description: "Category slug at the root of the map",
+				},
+				{
+					Name:        "depth",
+					In:          "query",
+					Type:        "integer",
+					Description: "Levels of the hierarchy to nest (default 3)",
+				},
+			},
+			Handler: treemapHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/chart/{slug...}",
+			Summary: "One category's series as a PNG line chart",
+			Params:  queryOptionParams,
+			Handler: chartHandler(app, tmpl),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/admin/quality",
+			Summary: "Data quality dashboard",
+			Handler: qualityHandler(app, tmpl),
+			Auth:    AuthAdmin,
+			Cache:   CacheNoStore,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/admin/annotations",
+			Summary: "Attach or clear a note on a category/year cell",
+			Handler: saveAnnotationHandler(app),
+			Auth:    AuthAdmin,
+			Cache:   CacheNoStore,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/admin/jobs",
+			Summary: "Background job status",
+			Handler: jobsHandler(app, tmpl),
+			Auth:    AuthAdmin,
+			Cache:   CacheNoStore,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/admin/jobs",
+			Summary: "Queue a load or export job",
+			Handler: enqueueJobHandler(app),
+			Auth:    AuthAdmin,
+			Cache:   CacheNoStore,
+			Rate:    RateStandard,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/admin/jobs/{id}/cancel",
+			Summary: "Cancel a queued or running job",
+			Handler: cancelJobHandler(app),
+			Auth:    AuthAdmin,
+			Cache:   CacheNoStore,
+			Rate:    RateStandard,
+		},
+	}
+	routes = append(routes, apiRoutes(app)...)
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		routes = append(routes, Route{
+			Method:  method,
+			Path:    "/graphql",
+			Summary: "GraphQL over categories, years, and expenditures",
+			Handler: graphQLHandler(app),
+			Auth:    AuthPublic,
+			Cache:   CacheNoStore,
+			Rate:    RateStandard,
+		})
+	}
+	routes = append(routes,
+		Route{
+			Method:  http.MethodGet,
+			Path:    "/api/openapi.json",
+			Summary: "OpenAPI document for the API",
+			Handler: openAPIHandler(&routes),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+		Route{
+			Method:  http.MethodGet,
+			Path:    "/api/docs",
+			Summary: "API documentation",
+			Handler: apiDocsHandler(tmpl, &routes),
+			Auth:    AuthPublic,
+			Cache:   CacheRevalidate,
+			Rate:    RateStandard,
+		},
+	)
+	routes = append(routes, Route{
+		Method:  http.MethodGet,
+		Path:    "/",
+		Summary: "Not found page with category suggestions",
+		Handler: notFoundHandler(app, tmpl),
+		Auth:    AuthPublic,
+		Cache:   CacheNoStore,
+		Rate:    RateStandard,
+	})
+	routes = append(routes, Route{
+		Method:  http.MethodGet,
+		Path:    "/admin/routes",
+		Summary: "Route table",
+		Handler: routesHandler(tmpl, &routes),
+		Auth:    AuthAdmin,
+		Cache:   CacheNoStore,
+		Rate:    RateStandard,
+	})
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, app, routes)
+
+	return mux, nil
+}
+
+func indexHandler(
+	app *App,
+	tmpl *template.Template,
+	routes *[]Route,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := negotiated(w, r, mimeHTML, mimeJSON, mimeCSV)
+		if !ok {
+			return
+		}
+
+		heatmap, err := parseHeatmapScale(r.URL.Query().Get("heatmap"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		curve, err := parseHeatmapCurve(r.URL.Query().Get("curve"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mode, err := parseDisplayMode(r.URL.Query().Get("mode"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		data, stmts, err := readTable(app, r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		saved, err := listSavedViews(app.db)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		notes, err := annotationIndex(app.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
 
-		if err := tmpl.ExecuteTemplate(w, "index.html", data); err != nil {
+		if format != mimeHTML {
+			data = annotateTable(apiPageYears(data, r), notes)
+			data.SQL = stmts
+			writeTable(w, r, format, data)
+			return
+		}
+
+		if data, err = expandTable(app, r, data); err != nil {
+			writeReadError(w, err)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		data = pageYears(data, page, yearsPerPage)
+		data.Views = saved
+		data.Heatmap = heatmap
+		data.Curve = curve
+		data.Mode = mode
+		data.Theme = requestTheme(r)
+		data.Threshold = app.trendThreshold()
+		data.Range, _ = parseYearBounds(
+			r.URL.Query().Get("from"),
+			r.URL.Query().Get("to"),
+		)
+		data.Sort = r.URL.Query().Get("sort")
+		data = arrangeRows(data, requestRowPrefs(r))
+		data.Shortcuts = enabledShortcuts(*routes)
+		data = annotateTable(data, notes)
+		data.SQL = stmts
+		renderPage(w, r, tmpl, "index.html", data)
+	}
+}
+
+func tableFragmentHandler(
+	app *App,
+	tmpl *template.Template,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		heatmap, err := parseHeatmapScale(q.Get("heatmap"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		curve, err := parseHeatmapCurve(q.Get("curve"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mode, err := parseDisplayMode(q.Get("mode"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		data, _, err := readTable(app, r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		requested, _ := parseYearBounds(q.Get("from"), q.Get("to"))
+		clamped := clampYearRange(requested, data.Available)
+		if clamped != requested {
+			q.Del("from")
+			q.Del("to")
+			if clamped.From != 0 {
+				q.Set("from", strconv.Itoa(clamped.From))
+			}
+			if clamped.To != 0 {
+				q.Set("to", strconv.Itoa(clamped.To))
+			}
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = q.Encode()
+			if data, _, err = readTable(app, r); err != nil {
+				writeReadError(w, err)
+				return
+			}
+		}
+
+		if data, err = expandTable(app, r, data); err != nil {
+			writeReadError(w, err)
+			return
+		}
+		saved, err := listSavedViews(app.db)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-	})
+		notes, err := annotationIndex(app.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		page, _ := strconv.Atoi(q.Get("page"))
+		data = pageYears(data, page, yearsPerPage)
+		data.Views = saved
+		data.Heatmap = heatmap
+		data.Curve = curve
+		data.Mode = mode
+		data.Theme = requestTheme(r)
+		data.Threshold = app.trendThreshold()
+		data.Range = clamped
+		data.Sort = q.Get("sort")
+		data = arrangeRows(data, requestRowPrefs(r))
+		data = annotateTable(data, notes)
+
+		renderPage(w, r, tmpl, "table.html", data)
+	}
+}
 
-	app.server = &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+func childrenHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		heatmap, err := parseHeatmapScale(q.Get("heatmap"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		curve, err := parseHeatmapCurve(q.Get("curve"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mode, err := parseDisplayMode(q.Get("mode"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		refs, err := cachedCategoryRefs(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		slug := r.PathValue("slug")
+		parent, ok := findCategoryRef(refs, slug)
+		if !ok {
+			renderNotFound(w, r, app, tmpl, slug)
+			return
+		}
+
+		children := map[string]bool{}
+		for _, ref := range refs {
+			if ref.ParentID != nil && *ref.ParentID == parent.ID {
+				children[ref.Slug] = true
+			}
+		}
+
+		q.Set("category", slug)
+		r = r.Clone(r.Context())
+		r.URL.RawQuery = q.Encode()
+
+		data, _, err := readTable(app, r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		page, _ := strconv.Atoi(q.Get("page"))
+		data = pageYears(data, page, yearsPerPage)
+		data.Heatmap = heatmap
+		data.Curve = curve
+		data.Mode = mode
+		data.Theme = requestTheme(r)
+		data.Threshold = app.trendThreshold()
+		data.Range, _ = parseYearBounds(q.Get("from"), q.Get("to"))
+		data.Sort = q.Get("sort")
+		prefs := requestRowPrefs(r)
+		data.Categories = slices.DeleteFunc(
+			data.Categories,
+			func(cat TableCategory) bool {
+				return !children[cat.Slug] ||
+					slices.Contains(prefs.Hidden, cat.Slug)
+			},
+		)
+		for i := range data.Categories {
+			data.Categories[i].Pinned = slices.Contains(
+				prefs.Pinned,
+				data.Categories[i].Slug,
+			)
+		}
+
+		renderPage(w, r, tmpl, "children.html", data)
 	}
+}
 
-	slog.Info("starting server", "addr", app.server.Addr)
-	return app.server.ListenAndServe()
+func qualityHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		report, err := cachedView(
+			app,
+			"quality",
+			func() (*QualityReport, error) {
+				return qualityReport(app.db)
+			},
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		renderPage(w, r, tmpl, "quality.html", report)
+	}
+}
+
+func textExportHandler(app *App, guard exportGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		width := 0
+		if v := r.URL.Query().Get("width"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid width", http.StatusBadRequest)
+				return
+			}
+			width = n
+		}
+
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		db, done, err := datasetDB(app, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		defer done()
+
+		if !guard.check(w, r, db, opts) {
+			return
+		}
+
+		start := time.Now()
+		data, _, err := readTable(app, r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		data, err = annotatedTable(app.db, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := renderTable(w, data, width); err != nil {
+			slog.Error("render text export", "error", err)
+		}
+	}
+}
+
+func delimitedExportHandler(
+	app *App,
+	guard exportGuard,
+	df delimitedFormat,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		db, done, err := datasetDB(app, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		defer done()
+
+		if !guard.check(w, r, db, opts) {
+			return
+		}
+
+		w.Header().Set("Content-Type", df.mime)
+		w.Header().Set(
+			"Content-Disposition",
+			fmt.Sprintf(`attachment; filename="nhe.%s"`, df.ext),
+		)
+		_, err = writeExpendituresCSV(r.Context(), w, db, opts, df.comma)
+		if err != nil {
+			slog.Error(
+				"write delimited export",
+				"format",
+				df.ext,
+				"error",
+				err,
+			)
+		}
+	}
+}
+
+func xlsxExportHandler(app *App, guard exportGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		view, err := tableView(app, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		db, done, err := datasetDB(app, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		defer done()
+
+		if !guard.check(w, r, db, opts) {
+			return
+		}
+
+		start := time.Now()
+		data, err := tableData(r.Context(), app, db, view, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		data, err = annotatedTable(app.db, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		var buf bytes.Buffer
+		err = writeNHEXLSX(r.Context(), &buf, db, data, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", xlsxContentType)
+		w.Header().Set(
+			"Content-Disposition",
+			`attachment; filename="nhe.xlsx"`,
+		)
+		if _, err := buf.WriteTo(w); err != nil {
+			slog.Error("write XLSX export", "error", err)
+		}
+	}
 }
@@ -0,0 +1,165 @@
+package nhe
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const manifestSuffix = ".manifest.json"
+
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Rows   int    `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	DatasetVersion string         `json:"dataset_version"`
+	GeneratedAt    string         `json:"generated_at"`
+	Files          []ManifestFile `json:"files"`
+}
+
+type checksumWriter struct {
+	h hash.Hash
+	n int64
+}
+
+func newChecksumWriter() *checksumWriter {
+	return &checksumWriter{h: sha256.New()}
+}
+
+func (cw *checksumWriter) Write(b []byte) (int, error) {
+	n, err := cw.h.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (cw *checksumWriter) sum() string {
+	return hex.EncodeToString(cw.h.Sum(nil))
+}
+
+func checksumFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	cw := newChecksumWriter()
+	if _, err := io.Copy(cw, f); err != nil {
+		return "", 0, err
+	}
+	return cw.sum(), cw.n, nil
+}
+
+func exportFile(
+	ctx context.Context,
+	db *sql.DB,
+	store outputStore,
+	name string,
+	format string,
+	view TableView,
+	opts QueryOptions,
+) (ManifestFile, error) {
+	mf := ManifestFile{Name: filepath.Base(name), Format: format}
+
+	f, err := store.create(ctx, name)
+	if err != nil {
+		return mf, err
+	}
+
+	cw := newChecksumWriter()
+	w := io.MultiWriter(f, cw)
+	if mf.Rows, err = writeExport(ctx, w, db, format, view, opts); err != nil {
+		f.abort()
+		return mf, err
+	}
+	if err := f.commit(); err != nil {
+		return mf, fmt.Errorf("write %s: %w", name, err)
+	}
+
+	mf.Bytes, mf.SHA256 = cw.n, cw.sum()
+	return mf, nil
+}
+
+func writeManifest(
+	ctx context.Context,
+	store outputStore,
+	name string,
+	db *sql.DB,
+	files []ManifestFile,
+) error {
+	version, err := currentVersion(db)
+	if err != nil {
+		return fmt.Errorf("read dataset version: %w", err)
+	}
+
+	b, err := json.MarshalIndent(Manifest{
+		DatasetVersion: version,
+		GeneratedAt:    time.Now().UTC().Format(time.RFC3339),
+		Files:          files,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := store.create(ctx, name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+func verifyManifest(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", path, err)
+	}
+
+	var (
+		dir      = filepath.Dir(path)
+		problems []string
+	)
+	for _, mf := range m.Files {
+		sum, n, err := checksumFile(filepath.Join(dir, mf.Name))
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", mf.Name, err))
+		case n != mf.Bytes:
+			problems = append(problems, fmt.Sprintf(
+				"%s: %d bytes, manifest says %d",
+				mf.Name,
+				n,
+				mf.Bytes,
+			))
+		case sum != mf.SHA256:
+			problems = append(problems, fmt.Sprintf(
+				"%s: sha256 %s, manifest says %s",
+				mf.Name,
+				sum,
+				mf.SHA256,
+			))
+		}
+	}
+	return problems, nil
+}
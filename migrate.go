@@ -0,0 +1,71 @@
+package nhe
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+var migrations = []string{
+	`
+	ALTER TABLE categories
+		ADD COLUMN units TEXT NOT NULL DEFAULT 'USD';
+	ALTER TABLE categories
+		ADD COLUMN scale INTEGER NOT NULL DEFAULT 1000000;
+	UPDATE categories SET units = 'persons' WHERE name = 'POPULATION';
+	UPDATE categories SET units = 'USD per capita', scale = 1
+		WHERE name LIKE '%per capita%';
+	`,
+	`
+	ALTER TABLE expenditures
+		ADD COLUMN status TEXT NOT NULL DEFAULT 'value';
+	UPDATE expenditures SET status = 'no_data' WHERE amount IS NULL;
+	`,
+	`
+	ALTER TABLE categories
+		ADD COLUMN sparkline TEXT NOT NULL DEFAULT '';
+	`,
+	`
+	ALTER TABLE categories
+		ADD COLUMN source TEXT NOT NULL DEFAULT 'official';
+	`,
+	`
+	ALTER TABLE jobs
+		ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	ALTER TABLE jobs
+		ADD COLUMN heartbeat_at TEXT;
+	`,
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := applyMigration(db, i+1, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int, stmts string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(stmts); err != nil {
+		return err
+	}
+
+	q := fmt.Sprintf("PRAGMA user_version = %d", version)
+	if _, err := tx.Exec(q); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
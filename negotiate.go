@@ -0,0 +1,102 @@
+package nhe
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	mimeHTML = "text/html"
+	mimeJSON = "application/json"
+	mimeCSV  = "text/csv"
+)
+
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.TrimSpace(fields[0]), "/")
+		if !ok {
+			continue
+		}
+
+		mr := mediaRange{
+			typ:     strings.ToLower(typ),
+			subtype: strings.ToLower(subtype),
+			q:       1,
+		}
+		for _, param := range fields[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(k, "q") {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+func (mr mediaRange) specificity(offer string) int {
+	typ, subtype, _ := strings.Cut(offer, "/")
+	switch {
+	case mr.typ == typ && mr.subtype == subtype:
+		return 3
+	case mr.typ == typ && mr.subtype == "*":
+		return 2
+	case mr.typ == "*" && mr.subtype == "*":
+		return 1
+	}
+	return 0
+}
+
+func negotiate(accept string, offers ...string) (string, bool) {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return offers[0], true
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, offer := range offers {
+		q, spec := 0.0, 0
+		for _, mr := range ranges {
+			if s := mr.specificity(offer); s > spec {
+				q, spec = mr.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+func negotiated(
+	w http.ResponseWriter,
+	r *http.Request,
+	offers ...string,
+) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+
+	format, ok := negotiate(r.Header.Get("Accept"), offers...)
+	if !ok {
+		http.Error(
+			w,
+			fmt.Sprintf("acceptable types: %s", strings.Join(offers, ", ")),
+			http.StatusNotAcceptable,
+		)
+	}
+	return format, ok
+}
@@ -0,0 +1,270 @@
+package nhe
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const openAPIVersion = "3.0.3"
+
+type RouteParam struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+}
+
+var tableViewParams = []RouteParam{
+	{
+		Name:        "basis",
+		In:          "query",
+		Type:        "string",
+		Description: "Year basis: calendar or fiscal",
+	},
+	{
+		Name:        "years",
+		In:          "query",
+		Type:        "string",
+		Description: "Display-year strategy: every[:N], milestones:Y1,Y2,..., decades",
+	},
+	{
+		Name:        "interval",
+		In:          "query",
+		Type:        "integer",
+		Description: "Show every Nth year; shorthand for years=every:N",
+	},
+	{
+		Name:        "view",
+		In:          "query",
+		Type:        "string",
+		Description: "Name of a saved view to start from",
+	},
+	{
+		Name:        "debug",
+		In:          "query",
+		Type:        "string",
+		Description: "Set to sql to include queries (requires --debug-sql)",
+	},
+}
+
+type openAPISchemas map[string]any
+
+func (s openAPISchemas) schema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		inner := s.schema(t.Elem())
+		if ref, ok := inner["$ref"]; ok {
+			return map[string]any{
+				"allOf":    []any{map[string]any{"$ref": ref}},
+				"nullable": true,
+			}
+		}
+		inner["nullable"] = true
+		return inner
+	case reflect.Slice, reflect.Array:
+		return map[string]any{
+			"type":  "array",
+			"items": s.schema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": s.schema(t.Elem()),
+		}
+	case reflect.Struct:
+		if _, ok := s[t.Name()]; !ok {
+			s[t.Name()] = nil
+			s[t.Name()] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+func (s openAPISchemas) object(t reflect.Type) map[string]any {
+	var (
+		props    = map[string]any{}
+		required []string
+	)
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			embedded := s.object(f.Type)
+			for k, v := range embedded["properties"].(map[string]any) {
+				props[k] = v
+			}
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = s.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	obj := map[string]any{
+		"type":       "object",
+		"properties": props,
+	}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+func openAPIParams(rt Route) []any {
+	var params []any
+	for _, p := range rt.Params {
+		params = append(params, map[string]any{
+			"name":        p.Name,
+			"in":          p.In,
+			"required":    p.In == "path",
+			"description": p.Description,
+			"schema":      map[string]any{"type": p.Type},
+		})
+	}
+	return params
+}
+
+func openAPIDocument(routes []Route) map[string]any {
+	var (
+		paths   = map[string]any{}
+		schemas = openAPISchemas{}
+	)
+
+	for _, rt := range routes {
+		if !strings.HasPrefix(rt.Path, "/api/") {
+			continue
+		}
+
+		response := map[string]any{"description": "OK"}
+		if rt.Response != nil {
+			response["content"] = map[string]any{
+				"application/json": map[string]any{
+					"schema": schemas.schema(reflect.TypeOf(rt.Response)),
+				},
+			}
+		}
+
+		op := map[string]any{
+			"summary":   rt.Summary,
+			"responses": map[string]any{"200": response},
+		}
+		if rt.Deprecated {
+			op["deprecated"] = true
+		}
+		if params := openAPIParams(rt); len(params) > 0 {
+			op["parameters"] = params
+		}
+		if rt.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": schemas.schema(reflect.TypeOf(rt.Request)),
+					},
+				},
+			}
+		}
+
+		item, _ := paths[rt.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "National Health Expenditures API",
+			"version": "1",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": map[string]any(schemas)},
+	}
+}
+
+func openAPIHandler(routes *[]Route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, openAPIDocument(*routes))
+	}
+}
+
+type apiDocsRoute struct {
+	Route
+	RequestSchema string
+	Schema        string
+}
+
+type apiDocs struct {
+	Routes  []apiDocsRoute
+	Schemas string
+}
+
+func apiDocsHandler(tmpl *template.Template, routes *[]Route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			docs    apiDocs
+			schemas = openAPISchemas{}
+		)
+
+		for _, rt := range *routes {
+			if !strings.HasPrefix(rt.Path, "/api/") {
+				continue
+			}
+
+			entry := apiDocsRoute{Route: rt}
+			if rt.Request != nil {
+				b, _ := json.MarshalIndent(
+					schemas.schema(reflect.TypeOf(rt.Request)),
+					"",
+					"  ",
+				)
+				entry.RequestSchema = string(b)
+			}
+			if rt.Response != nil {
+				b, _ := json.MarshalIndent(
+					schemas.schema(reflect.TypeOf(rt.Response)),
+					"",
+					"  ",
+				)
+				entry.Schema = string(b)
+			}
+			docs.Routes = append(docs.Routes, entry)
+		}
+
+		b, _ := json.MarshalIndent(schemas, "", "  ")
+		docs.Schemas = string(b)
+
+		renderPage(w, r, tmpl, "docs.html", docs)
+	}
+}
@@ -0,0 +1,532 @@
+package nhe
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	SortOrder  = "order"
+	SortName   = "name"
+	SortAmount = "amount"
+)
+
+var (
+	querySorts = []string{SortOrder, SortName, SortAmount}
+	queryUnits = []string{unitsUSD, unitsPersons, unitsUSDPerCapita}
+)
+
+type QueryOptions struct {
+	Years      []YearRange
+	Categories []string
+	Metric     string
+	Units      string
+	Dataset    string
+	AsOf       time.Time
+	Sort       string
+}
+
+var queryOptionParams = []RouteParam{
+	{
+		Name:        "range",
+		In:          "query",
+		Type:        "string",
+		Description: "Years to include as FROM-TO, FROM-, or YEAR; repeatable",
+	},
+	{
+		Name:        "from",
+		In:          "query",
+		Type:        "integer",
+		Description: "First year to include",
+	},
+	{
+		Name:        "to",
+		In:          "query",
+		Type:        "integer",
+		Description: "Last year to include",
+	},
+	{
+		Name:        "category",
+		In:          "query",
+		Type:        "string",
+		Description: "Category slug or name and its subtree; repeatable",
+	},
+	{
+		Name:        "metric",
+		In:          "query",
+		Type:        "string",
+		Description: "amount, share, or growth (series reads only)",
+	},
+	{
+		Name:        "units",
+		In:          "query",
+		Type:        "string",
+		Description: "Only categories in these units",
+	},
+	{
+		Name:        "dataset",
+		In:          "query",
+		Type:        "string",
+		Description: "Retained dataset version to read",
+	},
+	{
+		Name:        "as_of",
+		In:          "query",
+		Type:        "string",
+		Description: "Read the dataset served on this date or RFC 3339 time",
+	},
+	{
+		Name:        "sort",
+		In:          "query",
+		Type:        "string",
+		Description: "order, name, amount, or a year; :asc or :desc to flip",
+	},
+}
+
+func queryOptionFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "range",
+			Usage: "years to include as FROM-TO, FROM-, or YEAR",
+		},
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "first year to include",
+		},
+		&cli.StringFlag{
+			Name:  "to",
+			Usage: "last year to include",
+		},
+		&cli.StringSliceFlag{
+			Name:  "category",
+			Usage: "category slug or name; includes its subtree",
+		},
+		&cli.StringFlag{
+			Name:  "metric",
+			Usage: "amount, share, or growth",
+		},
+		&cli.StringFlag{
+			Name:  "units",
+			Usage: "only categories in these units",
+		},
+		&cli.StringFlag{
+			Name:  "dataset",
+			Usage: "retained dataset version to read",
+		},
+		&cli.StringFlag{
+			Name:  "as-of",
+			Usage: "read the dataset served on this date or time",
+		},
+		&cli.StringFlag{
+			Name:  "sort",
+			Usage: "order, name, amount, or a year, with :asc or :desc",
+		},
+	}
+}
+
+func parseYearRange(s string) (YearRange, error) {
+	var (
+		yr             YearRange
+		lo, hi, ranged = strings.Cut(s, "-")
+		err            error
+	)
+	if lo != "" {
+		if yr.From, err = strconv.Atoi(lo); err != nil {
+			return yr, badQuery("invalid year range %q", s)
+		}
+	}
+	if !ranged {
+		yr.To = yr.From
+		return yr, nil
+	}
+	if hi != "" {
+		if yr.To, err = strconv.Atoi(hi); err != nil {
+			return yr, badQuery("invalid year range %q", s)
+		}
+	}
+	if yr.From != 0 && yr.To != 0 && yr.From > yr.To {
+		return yr, badQuery("year range %q is reversed", s)
+	}
+	return yr, nil
+}
+
+func parseAsOf(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, badQuery("invalid as_of %q", s)
+	}
+	return t.UTC(), nil
+}
+
+func parseYearBounds(from, to string) (YearRange, error) {
+	var (
+		yr  YearRange
+		err error
+	)
+	if from != "" {
+		if yr.From, err = strconv.Atoi(from); err != nil {
+			return yr, badQuery("invalid from year %q", from)
+		}
+	}
+	if to != "" {
+		if yr.To, err = strconv.Atoi(to); err != nil {
+			return yr, badQuery("invalid to year %q", to)
+		}
+	}
+	if yr.From != 0 && yr.To != 0 && yr.From > yr.To {
+		return yr, badQuery("from %d is after to %d", yr.From, yr.To)
+	}
+	return yr, nil
+}
+
+func bindQueryOptions(get func(name string) []string) (QueryOptions, error) {
+	first := func(name string) string {
+		if v := get(name); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	o := QueryOptions{
+		Categories: get("category"),
+		Metric:     cmp.Or(first("metric"), MetricAmount),
+		Units:      first("units"),
+		Dataset:    first("dataset"),
+		Sort:       cmp.Or(first("sort"), SortOrder),
+	}
+
+	for _, s := range get("range") {
+		yr, err := parseYearRange(s)
+		if err != nil {
+			return o, err
+		}
+		o.Years = append(o.Years, yr)
+	}
+
+	bounds, err := parseYearBounds(first("from"), first("to"))
+	if err != nil {
+		return o, err
+	}
+	if bounds != (YearRange{}) {
+		o.Years = append(o.Years, bounds)
+	}
+
+	if s := first("as_of"); s != "" {
+		t, err := parseAsOf(s)
+		if err != nil {
+			return o, err
+		}
+		if o.Dataset != "" {
+			return o, badQuery("dataset and as_of are mutually exclusive")
+		}
+		o.AsOf = t
+	}
+
+	if !slices.Contains(queryMetrics, o.Metric) {
+		return o, badQuery("unknown metric %q", o.Metric)
+	}
+	if o.Units != "" && !slices.Contains(queryUnits, o.Units) {
+		return o, badQuery("unknown units %q", o.Units)
+	}
+	if _, _, err := parseSort(o.Sort); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func parseSort(s string) (string, bool, error) {
+	key, dir, found := strings.Cut(s, ":")
+	_, err := strconv.Atoi(key)
+	year := err == nil
+	if !year && !slices.Contains(querySorts, key) {
+		return key, false, badQuery("unknown sort %q", s)
+	}
+
+	desc := year || key == SortAmount
+
+	switch {
+	case !found:
+	case dir == "asc":
+		desc = false
+	case dir == "desc":
+		desc = true
+	default:
+		return key, false, badQuery("unknown sort direction %q", dir)
+	}
+	return key, desc, nil
+}
+
+func requestQueryOptions(r *http.Request) (QueryOptions, error) {
+	q := r.URL.Query()
+	return bindQueryOptions(func(name string) []string {
+		return q[name]
+	})
+}
+
+func cliQueryOptions(c *cli.Context) (QueryOptions, error) {
+	return bindQueryOptions(func(name string) []string {
+		switch {
+		case name == "range" || name == "category":
+			return c.StringSlice(name)
+		case name == "as_of" && c.IsSet("as-of"):
+			return []string{c.String("as-of")}
+		case c.IsSet(name):
+			return []string{c.String(name)}
+		}
+		return nil
+	})
+}
+
+func argsQueryOptions(args map[string]string) (QueryOptions, error) {
+	return bindQueryOptions(func(name string) []string {
+		if v, ok := args[name]; ok {
+			return []string{v}
+		}
+		return nil
+	})
+}
+
+func (o QueryOptions) key() string {
+	return fmt.Sprintf(
+		"%v:%q:%s:%s:%s:%d:%s",
+		o.Years,
+		o.Categories,
+		o.Metric,
+		o.Units,
+		o.Dataset,
+		o.AsOf.Unix(),
+		o.Sort,
+	)
+}
+
+func (o QueryOptions) amountsOnly() error {
+	if o.Metric != "" && o.Metric != MetricAmount {
+		return badQuery("metric %q is only available on series", o.Metric)
+	}
+	return nil
+}
+
+func (o QueryOptions) unfiltered(format string) error {
+	if len(o.Years) > 0 || len(o.Categories) > 0 || o.Units != "" ||
+		cmp.Or(o.Metric, MetricAmount) != MetricAmount ||
+		cmp.Or(o.Sort, SortOrder) != SortOrder {
+		return badQuery(
+			"%s exports cover the whole dataset; "+
+				"drop range, category, metric, units, and sort",
+			format,
+		)
+	}
+	return nil
+}
+
+var errDatasetNotRetained = errors.New("dataset not retained")
+
+func datasetDB(app *App, o QueryOptions) (*sql.DB, func(), error) {
+	if !o.AsOf.IsZero() {
+		version, err := versionAsOf(app.db, o.AsOf)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, fmt.Errorf(
+				"nothing loaded by %s: %w",
+				o.AsOf.Format(time.DateTime),
+				errDatasetNotRetained,
+			)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		o.Dataset = version
+	}
+
+	if o.Dataset == "" {
+		return app.db, func() {}, nil
+	}
+
+	db, err := openVersion(app, o.Dataset)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("%s: %w", o.Dataset, errDatasetNotRetained)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if db == app.db {
+		return db, func() {}, nil
+	}
+	return db, func() { closeVersion(db) }, nil
+}
+
+func writeReadError(w http.ResponseWriter, err error) {
+	var qe queryError
+	switch {
+	case errors.As(err, &qe):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errDatasetNotRetained):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type queryFilter struct {
+	QueryOptions
+	ids  map[int]bool
+	caps storeCaps
+}
+
+func (o QueryOptions) resolve(db *sql.DB) (queryFilter, error) {
+	f := queryFilter{QueryOptions: o, caps: capsOf(db)}
+	if len(o.Categories) == 0 {
+		return f, nil
+	}
+
+	refs, err := categoryRefs(db)
+	if err != nil {
+		return f, err
+	}
+	roots, err := resolveCategories(refs, QueryRequest{Categories: o.Categories})
+	if err != nil {
+		return f, err
+	}
+
+	f.ids = map[int]bool{}
+	for _, ref := range roots {
+		f.ids[ref.ID] = true
+	}
+	for _, ref := range refs {
+		if ref.ParentID != nil && f.ids[*ref.ParentID] {
+			f.ids[ref.ID] = true
+		}
+	}
+	return f, nil
+}
+
+func (f queryFilter) filtersCategories() bool {
+	return f.ids != nil || f.Units != ""
+}
+
+func (f queryFilter) wantsCategory(id int, units string) bool {
+	if f.ids != nil && !f.ids[id] {
+		return false
+	}
+	return f.Units == "" || f.Units == units
+}
+
+func (f queryFilter) wantsYear(year int) bool {
+	if len(f.Years) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(f.Years, func(yr YearRange) bool {
+		return yr.contains(year)
+	})
+}
+
+func (f queryFilter) categoryWhere() (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	if f.ids != nil {
+		ids := slices.Sorted(maps.Keys(f.ids))
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+		conds = append(conds, "c.id IN ("+marks+")")
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	if f.Units != "" {
+		conds = append(conds, f.caps.units("c")+" = ?")
+		args = append(args, f.Units)
+	}
+
+	if len(conds) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (f queryFilter) yearWhere() (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	for _, yr := range f.Years {
+		switch {
+		case yr.From != 0 && yr.To != 0:
+			conds = append(conds, "y.year BETWEEN ? AND ?")
+			args = append(args, yr.From, yr.To)
+		case yr.From != 0:
+			conds = append(conds, "y.year >= ?")
+			args = append(args, yr.From)
+		case yr.To != 0:
+			conds = append(conds, "y.year <= ?")
+			args = append(args, yr.To)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "1 = 1", nil
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+func (f queryFilter) where() (string, []any) {
+	var (
+		cats, catArgs   = f.categoryWhere()
+		years, yearArgs = f.yearWhere()
+	)
+	return cats + " AND " + years, append(catArgs, yearArgs...)
+}
+
+const latestAmountSQL = `(
+	SELECT le.amount
+	FROM expenditures le
+	JOIN years ly ON ly.id = le.year_id
+	WHERE le.category_id = c.id
+	ORDER BY ly.year DESC
+	LIMIT 1
+)`
+
+const yearAmountSQL = `(
+	SELECT ye.amount
+	FROM expenditures ye
+	JOIN years yy ON yy.id = ye.year_id
+	WHERE ye.category_id = c.id AND yy.year = %d
+)`
+
+const pathOrder = "c.sort_order, c.id, y.year"
+
+func (f queryFilter) orderBy() string {
+	key, desc, _ := parseSort(f.Sort)
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+
+	switch key {
+	case SortName:
+		return "c.name" + dir + ", " + pathOrder
+	case SortAmount:
+		return latestAmountSQL + dir + " NULLS LAST, " + pathOrder
+	case SortOrder, "":
+		return "c.sort_order" + dir + ", c.id" + dir + ", y.year"
+	}
+
+	year, _ := strconv.Atoi(key)
+	return fmt.Sprintf(yearAmountSQL, year) +
+		dir + " NULLS LAST, " + pathOrder
+}
@@ -0,0 +1,297 @@
+package nhe
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+const parquetMagic = "PAR1"
+
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8 = 0
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+type thriftWriter struct {
+	buf   bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func (t *thriftWriter) uvarint(v uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.uvarint(uint64(id<<1 ^ id>>15))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.uvarint(uint64(uint32(v<<1 ^ v>>31)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.uvarint(uint64(v<<1 ^ v>>63))
+}
+
+func (t *thriftWriter) binary(s string) {
+	t.uvarint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary(s)
+}
+
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.uvarint(uint64(n))
+}
+
+func (t *thriftWriter) begin() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) beginField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+type parquetColumn struct {
+	name     string
+	typ      int32
+	optional bool
+	utf8     bool
+	values   bytes.Buffer
+	defined  []bool
+}
+
+func (c *parquetColumn) null() {
+	c.defined = append(c.defined, false)
+}
+
+func (c *parquetColumn) str(s string) {
+	if c.utf8 {
+		s = strings.ToValidUTF8(s, "\uFFFD")
+	}
+	c.defined = append(c.defined, true)
+	c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s))))
+	c.values.WriteString(s)
+}
+
+func (c *parquetColumn) i32(v int32) {
+	c.defined = append(c.defined, true)
+	c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(v)))
+}
+
+func (c *parquetColumn) i64(v int64) {
+	c.defined = append(c.defined, true)
+	c.values.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (c *parquetColumn) definitionLevels() []byte {
+	var runs []byte
+	for i := 0; i < len(c.defined); {
+		j := i
+		for j < len(c.defined) && c.defined[j] == c.defined[i] {
+			j++
+		}
+		runs = binary.AppendUvarint(runs, uint64(j-i)<<1)
+		if c.defined[i] {
+			runs = append(runs, 1)
+		} else {
+			runs = append(runs, 0)
+		}
+		i = j
+	}
+	size := binary.LittleEndian.AppendUint32(nil, uint32(len(runs)))
+	return append(size, runs...)
+}
+
+func (c *parquetColumn) page() []byte {
+	var body []byte
+	if c.optional {
+		body = c.definitionLevels()
+	}
+	body = append(body, c.values.Bytes()...)
+
+	var t thriftWriter
+	t.i32(1, 0)
+	t.i32(2, int32(len(body)))
+	t.i32(3, int32(len(body)))
+	t.beginField(5)
+	t.i32(1, int32(len(c.defined)))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE)
+	t.i32(4, parquetRLE)
+	t.end()
+	t.buf.WriteByte(0)
+
+	return append(t.buf.Bytes(), body...)
+}
+
+func writeParquet(w io.Writer, cols []*parquetColumn, rows int) error {
+	out := bytes.NewBufferString(parquetMagic)
+
+	var (
+		offsets = make([]int64, len(cols))
+		sizes   = make([]int64, len(cols))
+	)
+	for i, c := range cols {
+		page := c.page()
+		offsets[i], sizes[i] = int64(out.Len()), int64(len(page))
+		out.Write(page)
+	}
+
+	var t thriftWriter
+	t.i32(1, 1)
+
+	t.list(2, thriftStruct, len(cols)+1)
+	t.begin()
+	t.str(4, "schema")
+	t.i32(5, int32(len(cols)))
+	t.end()
+	for _, c := range cols {
+		t.begin()
+		t.i32(1, c.typ)
+		if c.optional {
+			t.i32(3, parquetOptional)
+		} else {
+			t.i32(3, parquetRequired)
+		}
+		t.str(4, c.name)
+		if c.utf8 {
+			t.i32(6, parquetUTF8)
+		}
+		t.end()
+	}
+
+	t.i64(3, int64(rows))
+
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	t.list(4, thriftStruct, 1)
+	t.begin()
+	t.list(1, thriftStruct, len(cols))
+	for i, c := range cols {
+		t.begin()
+		t.i64(2, offsets[i])
+		t.beginField(3)
+		t.i32(1, c.typ)
+		t.list(2, thriftI32, 2)
+		t.uvarint(parquetPlain << 1)
+		t.uvarint(parquetRLE << 1)
+		t.list(3, thriftBinary, 1)
+		t.binary(c.name)
+		t.i32(4, 0)
+		t.i64(5, int64(len(c.defined)))
+		t.i64(6, sizes[i])
+		t.i64(7, sizes[i])
+		t.i64(9, offsets[i])
+		t.end()
+		t.end()
+	}
+	t.i64(2, total)
+	t.i64(3, int64(rows))
+	t.end()
+
+	t.str(6, "nhe")
+	t.buf.WriteByte(0)
+
+	out.Write(t.buf.Bytes())
+	out.Write(binary.LittleEndian.AppendUint32(nil, uint32(t.buf.Len())))
+	out.WriteString(parquetMagic)
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func writeExpendituresParquet(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	opts QueryOptions,
+) (int, error) {
+	var (
+		category = &parquetColumn{
+			name: "category",
+			typ:  parquetByteArray,
+			utf8: true,
+		}
+		parent = &parquetColumn{
+			name: "parent",
+			typ:  parquetByteArray,
+			utf8: true,
+		}
+		year   = &parquetColumn{name: "year", typ: parquetInt32}
+		amount = &parquetColumn{
+			name:     "amount",
+			typ:      parquetInt64,
+			optional: true,
+		}
+		rows int
+	)
+
+	err := eachExpenditure(ctx, db, opts, func(e expenditureRow) error {
+		category.str(e.Category)
+		parent.str(e.Parent)
+		year.i32(int32(e.Year))
+		if e.Amount == nil {
+			amount.null()
+		} else {
+			amount.i64(int64(*e.Amount))
+		}
+		rows++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	cols := []*parquetColumn{category, parent, year, amount}
+	return rows, writeParquet(w, cols, rows)
+}
@@ -0,0 +1,307 @@
+package nhe
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"image/color"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PayerLayer struct {
+	Name  string
+	Slugs []string
+	Color color.RGBA
+}
+
+var payerLayers = []PayerLayer{
+	{
+		Name:  "Out of pocket",
+		Slugs: []string{"out-of-pocket"},
+		Color: color.RGBA{0xd9, 0x77, 0x06, 0xff},
+	},
+	{
+		Name:  "Private health insurance",
+		Slugs: []string{"health-insurance/private-health-insurance"},
+		Color: color.RGBA{0x25, 0x63, 0xeb, 0xff},
+	},
+	{
+		Name:  "Medicare",
+		Slugs: []string{"health-insurance/medicare"},
+		Color: color.RGBA{0x16, 0xa3, 0x4a, 0xff},
+	},
+	{
+		Name: "Medicaid and CHIP",
+		Slugs: []string{
+			"health-insurance/medicaid-title-xix",
+			"chip-title-xix-and-title-xxi",
+		},
+		Color: color.RGBA{0x7c, 0x3a, 0xed, 0xff},
+	},
+	{
+		Name: "Defense and Veterans Affairs",
+		Slugs: []string{
+			"department-of-defense",
+			"department-of-veterans-affairs",
+		},
+		Color: color.RGBA{0x08, 0x91, 0xb2, 0xff},
+	},
+	{
+		Name:  "Other third party payers and programs",
+		Slugs: []string{"other-third-party-payers-and-programs"},
+		Color: color.RGBA{0xdb, 0x27, 0x77, 0xff},
+	},
+	{
+		Name:  "Public health activity",
+		Slugs: []string{"public-health-activity"},
+		Color: color.RGBA{0x65, 0xa3, 0x0d, 0xff},
+	},
+	{
+		Name:  "Investment",
+		Slugs: []string{"investment"},
+		Color: color.RGBA{0x4b, 0x55, 0x63, 0xff},
+	},
+}
+
+type PayerSeries struct {
+	Name   string
+	Color  string
+	Values []float64
+	Shares []float64
+}
+
+func (s PayerSeries) ShareChange() float64 {
+	return s.Shares[len(s.Shares)-1] - s.Shares[0]
+}
+
+type PayersPage struct {
+	Years  []int
+	Layers []PayerSeries
+	Mode   DisplayMode
+	SVG    template.HTML
+	Theme  Theme
+}
+
+func (p PayersPage) FirstYear() int {
+	return p.Years[0]
+}
+
+func (p PayersPage) LastYear() int {
+	return p.Years[len(p.Years)-1]
+}
+
+func payerSeries(
+	db *sql.DB,
+	refs []CategoryRef,
+) ([]int, []PayerSeries, error) {
+	root, ok := findRef(refs, func(ref CategoryRef) bool {
+		return ref.Name == totalCategory && ref.ParentID == nil
+	})
+	if !ok {
+		return nil, nil, fmt.Errorf("no %s category", totalCategory)
+	}
+
+	dollars := func(id int) ([]int, []float64, error) {
+		cs, err := categorySeries(db, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		var (
+			years  = make([]int, len(cs.Series))
+			values = make([]float64, len(cs.Series))
+		)
+		for j, p := range cs.Series {
+			years[j] = p.Year
+			if p.Amount != nil {
+				values[j] = float64(*p.Amount) * float64(cs.Scale)
+			}
+		}
+		return years, values, nil
+	}
+
+	years, totals, err := dollars(root.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load total: %w", err)
+	}
+
+	layers := make([]PayerSeries, len(payerLayers))
+	for n, layer := range payerLayers {
+		ps := PayerSeries{
+			Name:   layer.Name,
+			Color:  hexColor(layer.Color),
+			Values: make([]float64, len(years)),
+			Shares: make([]float64, len(years)),
+		}
+		for _, rel := range layer.Slugs {
+			slug := root.Slug + "/" + rel
+			ref, ok := findCategoryRef(refs, slug)
+			if !ok {
+				return nil, nil, fmt.Errorf("no payer category %s", slug)
+			}
+			_, values, err := dollars(ref.ID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("load %s: %w", slug, err)
+			}
+			for j, v := range values {
+				ps.Values[j] += v
+			}
+		}
+		for j, v := range ps.Values {
+			if totals[j] != 0 {
+				ps.Shares[j] = v / totals[j] * 100
+			}
+		}
+		layers[n] = ps
+	}
+	return years, layers, nil
+}
+
+type stackArea struct {
+	Fill   string
+	Points string
+	Name   string
+}
+
+type stackSVG struct {
+	Width  int
+	Height int
+	Title  string
+	Areas  []stackArea
+	Grid   []svgMark
+	Axes   []svgRect
+	Ticks  []svgMark
+}
+
+func renderStackSVG(
+	years []int,
+	layers []PayerSeries,
+	mode DisplayMode,
+) (string, error) {
+	var (
+		plotW = chartWidth - chartLeft - chartRight
+		plotH = chartHeight - chartTop - chartBottom
+		base  = chartTop + plotH
+		tops  = make([][]float64, len(layers)+1)
+		hi    = 0.0
+		svg   = stackSVG{
+			Width:  chartWidth,
+			Height: chartHeight,
+			Title:  "National health spending by payer",
+			Axes:   chartAxes(plotW, plotH),
+		}
+	)
+
+	tops[0] = make([]float64, len(years))
+	for n, layer := range layers {
+		values := layer.Values
+		if mode.Percent() {
+			values = layer.Shares
+		}
+		tops[n+1] = make([]float64, len(years))
+		for j, v := range values {
+			tops[n+1][j] = tops[n][j] + v
+			hi = max(hi, tops[n+1][j])
+		}
+	}
+	if mode.Percent() {
+		hi = 100
+	}
+	if hi == 0 {
+		hi = 1
+	}
+
+	x := func(j int) int {
+		return chartLeft + j*plotW/max(len(years)-1, 1)
+	}
+	y := func(v float64) int {
+		return base - int(v/hi*float64(plotH))
+	}
+	label := func(v float64) string {
+		if mode.Percent() {
+			return fmt.Sprintf("%.0f%%", v)
+		}
+		return unitFormat(unitsUSD).Format(v)
+	}
+
+	for n, layer := range layers {
+		points := make([]string, 0, 2*len(years))
+		point := func(j int, v float64) {
+			points = append(points, fmt.Sprintf("%d,%d", x(j), y(v)))
+		}
+		for j := range years {
+			point(j, tops[n+1][j])
+		}
+		for j := len(years) - 1; j >= 0; j-- {
+			point(j, tops[n][j])
+		}
+		svg.Areas = append(svg.Areas, stackArea{
+			Fill:   layer.Color,
+			Points: strings.Join(points, " "),
+			Name:   layer.Name,
+		})
+	}
+
+	for g := range chartGrid + 1 {
+		v := hi * float64(g) / chartGrid
+		svg.Grid = append(svg.Grid, svgMark{
+			Label: chartGridLabel(y(v), label(v)),
+		})
+	}
+
+	last := len(years) - 1
+	for j, year := range years {
+		tick := shortYear(year)
+		switch {
+		case j == 0 || j == last:
+			tick = strconv.Itoa(year)
+		case year%10 != 0 || x(last)-x(j) < textWidth(tick)+32:
+			continue
+		}
+		svg.Ticks = append(svg.Ticks, chartTick(x(j), base, tick))
+	}
+
+	return renderSVG("stack", svg)
+}
+
+func payersHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mode := DisplayPercent
+		if v := r.URL.Query().Get("mode"); v != "" {
+			var err error
+			if mode, err = parseDisplayMode(v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		start := time.Now()
+		refs, err := cachedCategoryRefs(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		years, layers, err := payerSeries(app.db, refs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		svg, err := renderStackSVG(years, layers, mode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		renderPage(w, r, tmpl, "payers.html", PayersPage{
+			Years:  years,
+			Layers: layers,
+			Mode:   mode,
+			SVG:    template.HTML(svg),
+			Theme:  requestTheme(r),
+		})
+	}
+}
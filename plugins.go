@@ -0,0 +1,159 @@
+package nhe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const defaultPluginsDir = "plugins"
+
+type PluginContext struct {
+	Name    string   `json:"name"`
+	Args    []string `json:"args"`
+	DB      string   `json:"db"`
+	Version string   `json:"version,omitempty"`
+	CSV     string   `json:"csv"`
+}
+
+func listPlugins(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func findPlugin(dir, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name[0] == '.' {
+		return "", fmt.Errorf("invalid plugin name %q", name)
+	}
+
+	names, err := listPlugins(dir)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(names, name) {
+		return "", fmt.Errorf("no plugin %q in %s", name, dir)
+	}
+	return filepath.Abs(filepath.Join(dir, name))
+}
+
+func snapshotDatabase(app *App, dir string) (string, error) {
+	path := filepath.Join(dir, "nhe.db")
+	if _, err := app.db.Exec("VACUUM INTO ?", path); err != nil {
+		return "", err
+	}
+	return path, os.Chmod(path, 0444)
+}
+
+func runPlugin(
+	ctx context.Context,
+	app *App,
+	dir string,
+	name string,
+	args []string,
+	stdout io.Writer,
+	stderr io.Writer,
+) error {
+	bin, err := findPlugin(dir, name)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "nhe-plugin-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	db, err := snapshotDatabase(app, tmp)
+	if err != nil {
+		return fmt.Errorf("snapshot database: %w", err)
+	}
+
+	version, err := currentVersion(app.db)
+	if err != nil {
+		return fmt.Errorf("current version: %w", err)
+	}
+
+	pctx, err := json.Marshal(PluginContext{
+		Name:    name,
+		Args:    args,
+		DB:      db,
+		Version: version,
+		CSV:     csvFilename,
+	})
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = append(
+		os.Environ(),
+		"NHE_DB="+db,
+		"NHE_CONTEXT="+string(pctx),
+	)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("plugin %s: %w", name, err)
+	}
+	return nil
+}
+
+func pluginsCommand(app *App) *cli.Command {
+	return &cli.Command{
+		Name:            "x",
+		Usage:           "run an external analysis from the plugins directory",
+		ArgsUsage:       "NAME [ARGS...]",
+		SkipFlagParsing: true,
+		Action: func(c *cli.Context) error {
+			dir := c.String("plugins-dir")
+			if c.NArg() == 0 {
+				names, err := listPlugins(dir)
+				if err != nil {
+					return err
+				}
+				for _, name := range names {
+					fmt.Println(name)
+				}
+				return nil
+			}
+
+			return runPlugin(
+				c.Context,
+				app,
+				dir,
+				c.Args().First(),
+				c.Args().Tail(),
+				os.Stdout,
+				os.Stderr,
+			)
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package nhe
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+)
+
+type PrintSection struct {
+	Rows []TableCategory
+}
+
+type PrintPage struct {
+	*TableData
+	Sections []PrintSection
+}
+
+func printSections(cats []TableCategory) []PrintSection {
+	var sections []PrintSection
+	for _, cat := range cats {
+		if len(sections) == 0 || cat.Major {
+			sections = append(sections, PrintSection{})
+		}
+		last := &sections[len(sections)-1]
+		last.Rows = append(last.Rows, cat)
+	}
+	return sections
+}
+
+func rootSlugs(refs []CategoryRef) []string {
+	var slugs []string
+	for _, ref := range refs {
+		if ref.ParentID == nil {
+			slugs = append(slugs, ref.Slug)
+		}
+	}
+	return slugs
+}
+
+func printHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		view, err := tableView(app, r.URL.Query())
+		if err != nil {
+			writeReadError(w, badQuery("%v", err))
+			return
+		}
+
+		opts, err := requestQueryOptions(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+
+		start := time.Now()
+		if len(opts.Categories) == 0 {
+			refs, err := cachedCategoryRefs(app)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			opts.Categories = rootSlugs(refs)
+		}
+
+		data, err := tableData(r.Context(), app, app.db, view, opts)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		renderPage(w, r, tmpl, "print.html", PrintPage{
+			TableData: data,
+			Sections:  printSections(data.Categories),
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package nhe
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+)
+
+const maxResidualRows = 25
+
+type QualityReport struct {
+	Decades   []string
+	Nulls     []QualityRow
+	Residuals []QualityRow
+	Loads     []LoadWarnings
+}
+
+type QualityRow struct {
+	Name  string
+	Cells []*float64
+	Worst float64
+}
+
+type LoadWarnings struct {
+	Dataset
+	Warnings []string
+}
+
+type qualityCell struct {
+	id       int
+	parentID *int
+	name     string
+	year     int
+	amount   *int
+	user     bool
+}
+
+type decadeStat struct {
+	nulls int
+	total int
+	worst *float64
+}
+
+func decadeLabel(year int) string {
+	return fmt.Sprintf("%ds", year/10*10)
+}
+
+func qualityReport(db *sql.DB) (*QualityReport, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT c.id, c.parent_id, c.name, y.year, e.amount, %s = '%s'
+		FROM expenditures e
+		JOIN categories c ON c.id = e.category_id
+		JOIN years y ON y.id = e.year_id
+		ORDER BY c.sort_order, c.id, y.year
+	`, capsOf(db).source("c"), SourceUser))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cells []qualityCell
+	for rows.Next() {
+		var c qualityCell
+		err := rows.Scan(
+			&c.id,
+			&c.parentID,
+			&c.name,
+			&c.year,
+			&c.amount,
+			&c.user,
+		)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &QualityReport{}
+	report.Decades = qualityDecades(cells)
+	report.Nulls = nullDensity(cells, report.Decades)
+	report.Residuals = sumResiduals(cells, report.Decades)
+
+	report.Loads, err = loadWarnings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func qualityDecades(cells []qualityCell) []string {
+	var decades []string
+	for _, c := range cells {
+		label := decadeLabel(c.year)
+		if !slices.Contains(decades, label) {
+			decades = append(decades, label)
+		}
+	}
+	slices.Sort(decades)
+	return decades
+}
+
+func qualityRow(
+	name string,
+	decades []string,
+	stats map[string]*decadeStat,
+	value func(*decadeStat) *float64,
+) QualityRow {
+	row := QualityRow{Name: name}
+	for _, d := range decades {
+		var v *float64
+		if st, ok := stats[d]; ok {
+			v = value(st)
+		}
+		if v != nil {
+			row.Worst = max(row.Worst, *v)
+		}
+		row.Cells = append(row.Cells, v)
+	}
+	return row
+}
+
+func nullDensity(cells []qualityCell, decades []string) []QualityRow {
+	var (
+		roots = map[int]int{}
+		names = map[int]string{}
+		order []int
+		stats = map[int]map[string]*decadeStat{}
+	)
+
+	for _, c := range cells {
+		if _, seen := roots[c.id]; !seen {
+			root := c.id
+			if c.parentID != nil {
+				root = roots[*c.parentID]
+			}
+			roots[c.id] = root
+
+			if root == c.id {
+				names[root] = c.name
+				order = append(order, root)
+				stats[root] = map[string]*decadeStat{}
+			}
+		}
+
+		root := roots[c.id]
+		label := decadeLabel(c.year)
+		st := stats[root][label]
+		if st == nil {
+			st = &decadeStat{}
+			stats[root][label] = st
+		}
+
+		st.total++
+		if c.amount == nil {
+			st.nulls++
+		}
+	}
+
+	var result []QualityRow
+	for _, root := range order {
+		result = append(result, qualityRow(
+			names[root],
+			decades,
+			stats[root],
+			func(st *decadeStat) *float64 {
+				pct := 100 * float64(st.nulls) / float64(st.total)
+				return &pct
+			},
+		))
+	}
+	return result
+}
+
+func sumResiduals(cells []qualityCell, decades []string) []QualityRow {
+	type key struct{ id, year int }
+
+	var (
+		amounts  = map[key]*int{}
+		names    = map[int]string{}
+		children = map[int][]int{}
+		order    []int
+		years    = map[int]bool{}
+	)
+
+	for _, c := range cells {
+		if c.user {
+			continue
+		}
+		amounts[key{c.id, c.year}] = c.amount
+		years[c.year] = true
+
+		if _, seen := names[c.id]; seen {
+			continue
+		}
+		names[c.id] = c.name
+		order = append(order, c.id)
+		if c.parentID != nil {
+			children[*c.parentID] = append(children[*c.parentID], c.id)
+		}
+	}
+
+	var result []QualityRow
+	for _, id := range order {
+		kids := children[id]
+		if len(kids) == 0 {
+			continue
+		}
+
+		stats := map[string]*decadeStat{}
+		for year := range years {
+			parent := amounts[key{id, year}]
+			if parent == nil || *parent == 0 {
+				continue
+			}
+
+			sum, found := 0, false
+			for _, kid := range kids {
+				if v := amounts[key{kid, year}]; v != nil {
+					sum += *v
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+
+			pct := math.Abs(float64(*parent-sum)) / float64(*parent) * 100
+			label := decadeLabel(year)
+			st := stats[label]
+			if st == nil {
+				st = &decadeStat{}
+				stats[label] = st
+			}
+			if st.worst == nil || pct > *st.worst {
+				st.worst = &pct
+			}
+		}
+
+		row := qualityRow(
+			names[id],
+			decades,
+			stats,
+			func(st *decadeStat) *float64 { return st.worst },
+		)
+		if row.Worst > 0 {
+			result = append(result, row)
+		}
+	}
+
+	slices.SortStableFunc(result, func(a, b QualityRow) int {
+		return cmp.Compare(b.Worst, a.Worst)
+	})
+
+	if len(result) > maxResidualRows {
+		result = result[:maxResidualRows]
+	}
+	return result
+}
+
+func loadWarnings(db *sql.DB) ([]LoadWarnings, error) {
+	rows, err := db.Query(`
+		SELECT l.id, l.version, l.source, l.loaded_at, w.message
+		FROM loads l
+		LEFT JOIN load_warnings w ON w.load_id = l.id
+		ORDER BY l.id DESC, w.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		result []LoadWarnings
+		lastID = -1
+	)
+	for rows.Next() {
+		var (
+			id      int
+			d       Dataset
+			message *string
+		)
+		err := rows.Scan(&id, &d.Version, &d.Source, &d.LoadedAt, &message)
+		if err != nil {
+			return nil, err
+		}
+
+		if id != lastID {
+			result = append(result, LoadWarnings{Dataset: d})
+			lastID = id
+		}
+
+		if message != nil {
+			last := &result[len(result)-1]
+			last.Warnings = append(last.Warnings, *message)
+		}
+	}
+	return result, rows.Err()
+}
+
+func qualityColor(pct *float64) string {
+	switch {
+	case pct == nil:
+		return "bg-gray-100"
+	case *pct >= 50:
+		return "bg-red-200"
+	case *pct >= 20:
+		return "bg-orange-200"
+	case *pct >= 5:
+		return "bg-amber-200"
+	case *pct >= 1:
+		return "bg-yellow-200"
+	case *pct > 0:
+		return "bg-lime-200"
+	}
+	return "bg-green-200"
+}
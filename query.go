@@ -0,0 +1,377 @@
+package nhe
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	maxQueryCategories = 200
+	maxQueryBodyBytes  = 1 << 20
+)
+
+const (
+	ShapeSeries = "series"
+	ShapeMatrix = "matrix"
+)
+
+const (
+	MetricAmount = "amount"
+	MetricShare  = "share"
+	MetricGrowth = "growth"
+)
+
+var queryMetrics = []string{MetricAmount, MetricShare, MetricGrowth}
+
+type YearRange struct {
+	From int `json:"from,omitempty"`
+	To   int `json:"to,omitempty"`
+}
+
+func (yr YearRange) contains(year int) bool {
+	return (yr.From == 0 || year >= yr.From) && (yr.To == 0 || year <= yr.To)
+}
+
+type QueryRequest struct {
+	Categories  []string    `json:"categories,omitempty"`
+	CategoryIDs []int       `json:"category_ids,omitempty"`
+	Years       []YearRange `json:"years,omitempty"`
+	Metrics     []string    `json:"metrics,omitempty"`
+	Shape       string      `json:"shape,omitempty"`
+}
+
+type QuerySeries struct {
+	Slug   string                `json:"slug"`
+	Name   string                `json:"name"`
+	Units  string                `json:"units"`
+	Scale  int64                 `json:"scale"`
+	Status []CellStatus          `json:"status"`
+	Values map[string][]*float64 `json:"values"`
+}
+
+type QueryRow struct {
+	ID    int    `json:"id"`
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Units string `json:"units"`
+	Scale int64  `json:"scale"`
+}
+
+type QueryMatrix struct {
+	Metric string       `json:"metric"`
+	Rows   []QueryRow   `json:"rows"`
+	Values [][]*float64 `json:"values"`
+}
+
+type QueryResponse struct {
+	Years       []int         `json:"years"`
+	Series      []QuerySeries `json:"series,omitempty"`
+	Matrix      *QueryMatrix  `json:"matrix,omitempty"`
+	Derivations []Derivation  `json:"derivations,omitempty"`
+}
+
+type queryError struct {
+	msg string
+}
+
+func (e queryError) Error() string {
+	return e.msg
+}
+
+func badQuery(format string, args ...any) error {
+	return queryError{fmt.Sprintf(format, args...)}
+}
+
+func (q *QueryRequest) validate() error {
+	n := len(q.Categories) + len(q.CategoryIDs)
+	switch {
+	case n == 0:
+		return badQuery("categories or category_ids is required")
+	case n > maxQueryCategories:
+		return badQuery(
+			"at most %d categories per query",
+			maxQueryCategories,
+		)
+	}
+
+	if len(q.Metrics) == 0 {
+		q.Metrics = []string{MetricAmount}
+	}
+	for _, m := range q.Metrics {
+		if !slices.Contains(queryMetrics, m) {
+			return badQuery(
+				"unknown metric %q (want one of %v)",
+				m,
+				queryMetrics,
+			)
+		}
+	}
+
+	switch q.Shape {
+	case "":
+		q.Shape = ShapeSeries
+	case ShapeSeries:
+	case ShapeMatrix:
+		if len(q.Metrics) != 1 {
+			return badQuery("matrix shape takes exactly one metric")
+		}
+	default:
+		return badQuery(
+			"unknown shape %q (want %s or %s)",
+			q.Shape,
+			ShapeSeries,
+			ShapeMatrix,
+		)
+	}
+
+	for _, yr := range q.Years {
+		if yr.From != 0 && yr.To != 0 && yr.From > yr.To {
+			return badQuery("year range %d-%d is reversed", yr.From, yr.To)
+		}
+	}
+	return nil
+}
+
+func (q *QueryRequest) wantsYear(year int) bool {
+	if len(q.Years) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(q.Years, func(yr YearRange) bool {
+		return yr.contains(year)
+	})
+}
+
+func amountOf(p SeriesPoint) *float64 {
+	if p.Amount == nil {
+		return nil
+	}
+	v := float64(*p.Amount)
+	return &v
+}
+
+func metricValue(
+	metric string,
+	series []SeriesPoint,
+	total []SeriesPoint,
+	i int,
+) *float64 {
+	amount := amountOf(series[i])
+	if amount == nil {
+		return nil
+	}
+
+	switch metric {
+	case MetricShare:
+		t := amountOf(total[i])
+		if t == nil || *t == 0 {
+			return nil
+		}
+		v := *amount / *t * 100
+		return &v
+	case MetricGrowth:
+		if i == 0 {
+			return nil
+		}
+		prev := amountOf(series[i-1])
+		if prev == nil || *prev == 0 {
+			return nil
+		}
+		v := (*amount - *prev) / *prev * 100
+		return &v
+	}
+	return amount
+}
+
+func resolveCategories(
+	refs []CategoryRef,
+	q QueryRequest,
+) ([]CategoryRef, error) {
+	var (
+		bySlug = map[string]CategoryRef{}
+		byID   = map[int]CategoryRef{}
+		byName = map[string][]CategoryRef{}
+	)
+	for _, ref := range refs {
+		bySlug[ref.Slug] = ref
+		byID[ref.ID] = ref
+		name := strings.ToLower(ref.Name)
+		byName[name] = append(byName[name], ref)
+	}
+
+	var out []CategoryRef
+	for _, key := range q.Categories {
+		if ref, ok := bySlug[key]; ok {
+			out = append(out, ref)
+			continue
+		}
+
+		named := byName[strings.ToLower(key)]
+		switch len(named) {
+		case 1:
+			out = append(out, named[0])
+			continue
+		case 0:
+			return nil, badQuery("unknown category %q", key)
+		}
+
+		slugs := make([]string, len(named))
+		for i, ref := range named {
+			slugs[i] = ref.Slug
+		}
+		return nil, badQuery(
+			"category name %q is ambiguous; use a slug: %s",
+			key,
+			strings.Join(slugs, ", "),
+		)
+	}
+
+	for _, id := range q.CategoryIDs {
+		ref, ok := byID[id]
+		if !ok {
+			return nil, badQuery("unknown category id %d", id)
+		}
+		out = append(out, ref)
+	}
+	return out, nil
+}
+
+func runQuery(
+	db *sql.DB,
+	refs []CategoryRef,
+	q QueryRequest,
+) (*QueryResponse, error) {
+	totalID := 0
+	for _, ref := range refs {
+		if ref.Name == totalCategory {
+			totalID = ref.ID
+			break
+		}
+	}
+
+	cats, err := resolveCategories(refs, q)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := categorySeries(db, totalID)
+	if err != nil {
+		return nil, fmt.Errorf("load total: %w", err)
+	}
+
+	resp := &QueryResponse{Years: []int{}}
+	var keep []int
+	for i, p := range total.Series {
+		if q.wantsYear(p.Year) {
+			keep = append(keep, i)
+			resp.Years = append(resp.Years, p.Year)
+		}
+	}
+
+	if q.Shape == ShapeMatrix {
+		resp.Matrix = &QueryMatrix{
+			Metric: q.Metrics[0],
+			Rows:   []QueryRow{},
+			Values: [][]*float64{},
+		}
+		resp.Derivations = metricDerivations(q.Metrics[0], "matrix.values")
+	} else {
+		for _, m := range q.Metrics {
+			resp.Derivations = append(
+				resp.Derivations,
+				metricDerivations(m, "series[].values."+m)...,
+			)
+		}
+	}
+
+	for _, ref := range cats {
+		cs, err := categorySeries(db, ref.ID)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", ref.Slug, err)
+		}
+
+		if m := resp.Matrix; m != nil {
+			m.Rows = append(m.Rows, QueryRow{
+				ID:    ref.ID,
+				Slug:  ref.Slug,
+				Name:  cs.Name,
+				Units: cs.Units,
+				Scale: cs.Scale,
+			})
+			values := make([]*float64, len(keep))
+			for j, i := range keep {
+				values[j] = metricValue(m.Metric, cs.Series, total.Series, i)
+			}
+			m.Values = append(m.Values, values)
+			continue
+		}
+
+		qs := QuerySeries{
+			Slug:   ref.Slug,
+			Name:   cs.Name,
+			Units:  cs.Units,
+			Scale:  cs.Scale,
+			Values: map[string][]*float64{},
+		}
+		for _, i := range keep {
+			qs.Status = append(qs.Status, cs.Series[i].Status)
+			for _, m := range q.Metrics {
+				qs.Values[m] = append(
+					qs.Values[m],
+					metricValue(m, cs.Series, total.Series, i),
+				)
+			}
+		}
+		resp.Series = append(resp.Series, qs)
+	}
+
+	return resp, nil
+}
+
+func queryHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxQueryBodyBytes)
+
+		var q QueryRequest
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&q); err != nil {
+			http.Error(
+				w,
+				fmt.Sprintf("invalid query: %v", err),
+				http.StatusBadRequest,
+			)
+			return
+		}
+		if err := q.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		refs, err := cachedCategoryRefs(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := runQuery(app.db, refs, q)
+		var qe queryError
+		if errors.As(err, &qe) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		writeJSON(w, r, resp)
+	}
+}
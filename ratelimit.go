@@ -0,0 +1,98 @@
+package nhe
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	maxRateBuckets = 4096
+	rateBucketIdle = time.Minute
+)
+
+type RateClass string
+
+const (
+	RateUnlimited RateClass = "unlimited"
+	RateStandard  RateClass = "standard"
+	RateExport    RateClass = "export"
+)
+
+type rateLimit struct {
+	perSecond float64
+	burst     float64
+}
+
+var rateLimits = map[RateClass]rateLimit{
+	RateStandard: {perSecond: 20, burst: 40},
+	RateExport:   {perSecond: 1, burst: 5},
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: map[string]*rateBucket{},
+	}
+}
+
+func (l *rateLimiter) allow(
+	class RateClass,
+	client string,
+	now time.Time,
+) bool {
+	limit, ok := rateLimits[class]
+	if !ok {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buckets) > maxRateBuckets {
+		l.prune(now)
+	}
+
+	key := string(class) + "|" + client
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &rateBucket{tokens: limit.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = min(limit.burst, b.tokens+elapsed*limit.perSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > rateBucketIdle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,287 @@
+package nhe
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRegimes      = "pre-aca=2000-2009,post-aca=2010-2019,covid=2020-"
+	regimeSignificanceT = 2.0
+	maxRegimes          = 8
+	maxRegimeLabel      = 40
+)
+
+type RegimePeriod struct {
+	Label string `json:"label"`
+	From  int    `json:"from"`
+	To    int    `json:"to,omitempty"`
+}
+
+func (p RegimePeriod) contains(year int) bool {
+	return YearRange{From: p.From, To: p.To}.contains(year)
+}
+
+type RegimeStats struct {
+	Years     int      `json:"years"`
+	AvgGrowth *float64 `json:"avg_growth"`
+	StdDev    *float64 `json:"std_dev"`
+}
+
+type RegimeChange struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Delta       *float64 `json:"delta"`
+	T           *float64 `json:"t"`
+	Significant bool     `json:"significant"`
+}
+
+type RegimeCategory struct {
+	ID      int            `json:"id"`
+	Slug    string         `json:"slug"`
+	Name    string         `json:"name"`
+	Periods []RegimeStats  `json:"periods"`
+	Changes []RegimeChange `json:"changes"`
+}
+
+type RegimeReport struct {
+	Periods     []RegimePeriod   `json:"periods"`
+	Categories  []RegimeCategory `json:"categories"`
+	Derivations []Derivation     `json:"derivations"`
+}
+
+func parseRegimes(spec string) ([]RegimePeriod, error) {
+	if spec == "" {
+		spec = defaultRegimes
+	}
+
+	parts := strings.Split(spec, ",")
+	if len(parts) > maxRegimes {
+		return nil, badQuery("at most %d regimes", maxRegimes)
+	}
+
+	var periods []RegimePeriod
+	for _, part := range parts {
+		label, span, ok := strings.Cut(part, "=")
+		if !ok {
+			label, span = part, part
+		}
+		if label == "" || len(label) > maxRegimeLabel {
+			return nil, badQuery("invalid regime label %q", label)
+		}
+
+		from, to, ranged := strings.Cut(span, "-")
+		if !ranged {
+			to = from
+		}
+		p := RegimePeriod{Label: label}
+
+		var err error
+		if p.From, err = strconv.Atoi(from); err != nil {
+			return nil, badQuery("invalid regime %q", part)
+		}
+		if to != "" {
+			if p.To, err = strconv.Atoi(to); err != nil {
+				return nil, badQuery("invalid regime %q", part)
+			}
+			if p.To < p.From {
+				return nil, badQuery("regime %q is reversed", part)
+			}
+		}
+		periods = append(periods, p)
+	}
+
+	if len(periods) < 2 {
+		return nil, badQuery("at least two regimes are required")
+	}
+	return periods, nil
+}
+
+func annualGrowth(series []SeriesPoint, p RegimePeriod) []float64 {
+	var growth []float64
+	for i := 1; i < len(series); i++ {
+		prev, cur := series[i-1], series[i]
+		if !p.contains(cur.Year) || prev.Year != cur.Year-1 {
+			continue
+		}
+		if prev.Amount == nil || cur.Amount == nil || *prev.Amount == 0 {
+			continue
+		}
+		a, b := float64(*prev.Amount), float64(*cur.Amount)
+		growth = append(growth, (b-a)/a*100)
+	}
+	return growth
+}
+
+func regimeStats(growth []float64) RegimeStats {
+	stats := RegimeStats{Years: len(growth)}
+	if len(growth) == 0 {
+		return stats
+	}
+
+	var sum float64
+	for _, g := range growth {
+		sum += g
+	}
+	mean := sum / float64(len(growth))
+	stats.AvgGrowth = &mean
+
+	if len(growth) < 2 {
+		return stats
+	}
+
+	var ss float64
+	for _, g := range growth {
+		ss += (g - mean) * (g - mean)
+	}
+	sd := math.Sqrt(ss / float64(len(growth)-1))
+	stats.StdDev = &sd
+	return stats
+}
+
+func regimeChange(
+	from, to RegimePeriod,
+	a, b RegimeStats,
+) RegimeChange {
+	c := RegimeChange{From: from.Label, To: to.Label}
+	if a.AvgGrowth == nil || b.AvgGrowth == nil {
+		return c
+	}
+
+	delta := *b.AvgGrowth - *a.AvgGrowth
+	c.Delta = &delta
+	if a.StdDev == nil || b.StdDev == nil {
+		return c
+	}
+
+	se := math.Sqrt(
+		*a.StdDev**a.StdDev/float64(a.Years) +
+			*b.StdDev**b.StdDev/float64(b.Years),
+	)
+	if se == 0 {
+		return c
+	}
+
+	t := delta / se
+	c.T = &t
+	c.Significant = math.Abs(t) >= regimeSignificanceT
+	return c
+}
+
+func regimeReport(
+	db *sql.DB,
+	cats []CategoryRef,
+	periods []RegimePeriod,
+) (*RegimeReport, error) {
+	report := &RegimeReport{
+		Periods:     periods,
+		Categories:  []RegimeCategory{},
+		Derivations: regimeDerivations,
+	}
+
+	for _, ref := range cats {
+		cs, err := categorySeries(db, ref.ID)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", ref.Slug, err)
+		}
+
+		rc := RegimeCategory{
+			ID:      ref.ID,
+			Slug:    ref.Slug,
+			Name:    cs.Name,
+			Changes: []RegimeChange{},
+		}
+		for _, p := range periods {
+			rc.Periods = append(
+				rc.Periods,
+				regimeStats(annualGrowth(cs.Series, p)),
+			)
+		}
+		for i := 1; i < len(periods); i++ {
+			rc.Changes = append(rc.Changes, regimeChange(
+				periods[i-1],
+				periods[i],
+				rc.Periods[i-1],
+				rc.Periods[i],
+			))
+		}
+		report.Categories = append(report.Categories, rc)
+	}
+
+	return report, nil
+}
+
+func regimeCategories(
+	refs []CategoryRef,
+	q url.Values,
+) ([]CategoryRef, error) {
+	if !q.Has("category") {
+		return refs, nil
+	}
+	if len(q["category"]) > maxQueryCategories {
+		return nil, badQuery(
+			"at most %d categories per query",
+			maxQueryCategories,
+		)
+	}
+	return resolveCategories(refs, QueryRequest{Categories: q["category"]})
+}
+
+func regimeKey(periods []RegimePeriod, cats []CategoryRef, all bool) string {
+	var b strings.Builder
+	b.WriteString("regimes:")
+	for _, p := range periods {
+		fmt.Fprintf(&b, "%q=%d-%d,", p.Label, p.From, p.To)
+	}
+	if all {
+		b.WriteString(":all")
+		return b.String()
+	}
+	b.WriteString(":")
+	for _, ref := range cats {
+		fmt.Fprintf(&b, "%d,", ref.ID)
+	}
+	return b.String()
+}
+
+func regimesHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		periods, err := parseRegimes(q.Get("periods"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		refs, err := cachedCategoryRefs(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		cats, err := regimeCategories(refs, q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key := regimeKey(periods, cats, !q.Has("category"))
+		report, err := cachedView(app, key, func() (*RegimeReport, error) {
+			return regimeReport(app.db, cats, periods)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		writeJSON(w, r, report)
+	}
+}
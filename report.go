@@ -0,0 +1,174 @@
+package nhe
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+type ReportChart struct {
+	Name string
+	Slug string
+	ID   string
+	SVG  template.HTML
+}
+
+type Report struct {
+	Table         *TableData
+	Dataset       *Dataset
+	Generated     time.Time
+	SelfContained bool
+	BaseURL       string
+	CSS           template.CSS
+	Charts        []ReportChart
+}
+
+func (r Report) ChartURL(slug string) string {
+	return r.BaseURL + "/chart/" + slug + ".png"
+}
+
+func buildReport(
+	ctx context.Context,
+	app *App,
+	db *sql.DB,
+	view TableView,
+	opts QueryOptions,
+) (*Report, error) {
+	data, err := tableData(ctx, app, db, view, opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err = annotatedTable(db, data)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Table:     data,
+		Generated: time.Now().UTC(),
+	}
+
+	if capsOf(db).has("loads", "") {
+		datasets, err := listDatasets(db)
+		if err != nil {
+			return nil, fmt.Errorf("list datasets: %w", err)
+		}
+		if len(datasets) > 0 {
+			report.Dataset = &datasets[0]
+		}
+	}
+
+	refs, err := categoryRefs(db)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int, len(refs))
+	for _, ref := range refs {
+		ids[ref.Slug] = ref.ID
+	}
+
+	for _, cat := range data.Categories {
+		chart := ReportChart{
+			Name: cat.Name,
+			Slug: cat.Slug,
+			ID:   "chart-" + strings.ReplaceAll(cat.Slug, "/", "-"),
+		}
+		cs, err := optionSeries(db, ids[cat.Slug], opts)
+		if err != nil {
+			return nil, fmt.Errorf("series for %s: %w", cat.Slug, err)
+		}
+		svg, err := renderChartSVG(cs, localeEnglish)
+		if err != nil {
+			return nil, fmt.Errorf("chart for %s: %w", cat.Slug, err)
+		}
+		chart.SVG = template.HTML(svg)
+		report.Charts = append(report.Charts, chart)
+	}
+	return report, nil
+}
+
+func writeReport(
+	w io.Writer,
+	report *Report,
+	tmpl *template.Template,
+) error {
+	if report.SelfContained {
+		css, err := staticFS.ReadFile("static/css/output.css")
+		if err != nil {
+			return fmt.Errorf("read stylesheet: %w", err)
+		}
+		report.CSS = template.CSS(css)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "report.html", report); err != nil {
+		return fmt.Errorf("render report: %w", err)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func reportCmd(app *App, c *cli.Context) error {
+	view, err := tableView(app, url.Values{"years": {c.String("years")}})
+	if err != nil {
+		return err
+	}
+
+	opts, err := cliQueryOptions(c)
+	if err != nil {
+		return err
+	}
+
+	db, done, err := datasetDB(app, opts)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	report, err := buildReport(c.Context, app, db, view, opts)
+	if err != nil {
+		return err
+	}
+	report.SelfContained = c.Bool("self-contained")
+	report.BaseURL = strings.TrimSuffix(c.String("base-url"), "/")
+
+	tmpl, err := parseTemplates(defaultTemplateSet)
+	if err != nil {
+		return err
+	}
+
+	output := c.Args().First()
+	if output == "" || output == "-" {
+		return writeReport(os.Stdout, report, tmpl)
+	}
+
+	store, err := openStore(c.String("dest"))
+	if err != nil {
+		return err
+	}
+
+	f, err := store.create(c.Context, output)
+	if err != nil {
+		store.close()
+		return err
+	}
+	if err := writeReport(f, report, tmpl); err != nil {
+		f.abort()
+		store.close()
+		return err
+	}
+	if err := f.commit(); err != nil {
+		store.close()
+		return fmt.Errorf("write %s: %w", output, err)
+	}
+	return store.close()
+}
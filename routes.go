@@ -0,0 +1,154 @@
+package nhe
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type AuthPolicy string
+
+const (
+	AuthPublic AuthPolicy = "public"
+	AuthExport AuthPolicy = "export-key"
+	AuthAdmin  AuthPolicy = "admin-key"
+)
+
+type CachePolicy string
+
+const (
+	CacheNone       CachePolicy = ""
+	CacheNoStore    CachePolicy = "no-store"
+	CacheRevalidate CachePolicy = "no-cache"
+	CacheStatic     CachePolicy = "public, max-age=3600"
+	CacheImmutable  CachePolicy = immutableCacheControl
+)
+
+type Route struct {
+	Method     string
+	Path       string
+	Summary    string
+	Params     []RouteParam
+	Request    any
+	Response   any
+	Handler    http.Handler
+	Auth       AuthPolicy
+	Cache      CachePolicy
+	Rate       RateClass
+	Stale      time.Duration
+	Deprecated bool
+}
+
+func (rt Route) Pattern() string {
+	return rt.Method + " " + rt.Path
+}
+
+func keyMatches(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func (rt Route) wrap(app *App, limiter *rateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.allow(rt.Rate, clientAddr(r), time.Now()) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		if rt.Auth == AuthAdmin && app.adminKey == "" {
+			http.Error(w, "admin routes are disabled", http.StatusForbidden)
+			return
+		}
+		if rt.Auth == AuthAdmin &&
+			!keyMatches(r.Header.Get("X-Admin-Key"), app.adminKey) {
+			http.Error(w, "admin key required", http.StatusUnauthorized)
+			return
+		}
+
+		if rt.Cache != CacheNone && rt.Cache != CacheImmutable {
+			w.Header().Set("Cache-Control", string(rt.Cache))
+		}
+
+		if rt.Stale > 0 {
+			r = r.WithContext(withStaleness(r.Context(), rt.Stale))
+		}
+
+		rt.Handler.ServeHTTP(w, r)
+	})
+}
+
+type apiVersion struct {
+	name   string
+	routes func(app *App) []Route
+}
+
+var apiVersions = []apiVersion{
+	{name: "v1", routes: apiV1Routes},
+}
+
+var legacyAPIPaths = []string{
+	"/table",
+	"/categories",
+	"/categories/{id}/series",
+	"/query",
+}
+
+func mountAPI(prefix string, routes []Route) []Route {
+	mounted := make([]Route, len(routes))
+	for i, rt := range routes {
+		rt.Path = prefix + rt.Path
+		if rt.Method == http.MethodGet {
+			rt.Params = append(slices.Clip(rt.Params), fieldsParam)
+		}
+		mounted[i] = rt
+	}
+	return mounted
+}
+
+func deprecatedAlias(app *App, rt Route, from, to string) Route {
+	next := rt.Handler
+	rt.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := to + strings.TrimPrefix(r.URL.EscapedPath(), from)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set(
+			"Link",
+			fmt.Sprintf(`<%s>; rel="successor-version"`, app.url(successor)),
+		)
+		next.ServeHTTP(w, r)
+	})
+	rt.Deprecated = true
+	return rt
+}
+
+func apiRoutes(app *App) []Route {
+	var routes []Route
+	for _, v := range apiVersions {
+		routes = append(routes, mountAPI("/api/"+v.name, v.routes(app))...)
+	}
+
+	for _, rt := range apiV1Routes(app) {
+		if !slices.Contains(legacyAPIPaths, rt.Path) {
+			continue
+		}
+		rt.Path = "/api" + rt.Path
+		routes = append(routes, deprecatedAlias(app, rt, "/api", "/api/v1"))
+	}
+	return routes
+}
+
+func registerRoutes(mux *http.ServeMux, app *App, routes []Route) {
+	limiter := newRateLimiter()
+	for _, rt := range routes {
+		mux.Handle(rt.Pattern(), rt.wrap(app, limiter))
+	}
+}
+
+func routesHandler(tmpl *template.Template, routes *[]Route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderPage(w, r, tmpl, "routes.html", *routes)
+	}
+}
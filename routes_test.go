@@ -0,0 +1,407 @@
+package nhe
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var (
+		l   = newRateLimiter()
+		now = time.Now()
+	)
+
+	for range 5 {
+		assert.True(t, l.allow(RateExport, "a", now))
+	}
+	assert.False(t, l.allow(RateExport, "a", now))
+	assert.True(t, l.allow(RateExport, "b", now))
+	assert.True(t, l.allow(RateExport, "a", now.Add(time.Second)))
+	assert.True(t, l.allow(RateUnlimited, "a", now))
+}
+
+func TestRouteWrap(t *testing.T) {
+	var (
+		app = &App{adminKey: "secret"}
+		rt  = Route{
+			Method: http.MethodGet,
+			Path:   "/admin/x",
+			Handler: http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				},
+			),
+			Auth:  AuthAdmin,
+			Cache: CacheNoStore,
+			Rate:  RateUnlimited,
+		}
+		h = rt.wrap(app, newRateLimiter())
+	)
+
+	assert.Equal(t, "GET /admin/x", rt.Pattern())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/admin/x", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r := httptest.NewRequest("GET", "/admin/x", nil)
+	r.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	r = httptest.NewRequest("GET", "/admin/x", nil)
+	r.AddCookie(&http.Cookie{Name: "admin_key", Value: "secret"})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	h = rt.wrap(&App{}, newRateLimiter())
+	r = httptest.NewRequest("GET", "/admin/x", nil)
+	r.Header.Set("X-Admin-Key", "")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAccessLog(t *testing.T) {
+	l := newAccessLog(accessLogConfig{
+		sampleAfter: 2,
+		sampleRate:  0.5,
+		scrub:       defaultScrubParams,
+	})
+
+	var roll float64
+	l.rand = func() float64 { return roll }
+
+	now := time.Now().Truncate(time.Second)
+	assert.True(t, l.sampled(now))
+	assert.True(t, l.sampled(now))
+	roll = 0.9
+	assert.False(t, l.sampled(now))
+	roll = 0.1
+	assert.True(t, l.sampled(now))
+	roll = 0.9
+	assert.True(t, l.sampled(now.Add(time.Second)))
+
+	assert.Equal(
+		t,
+		"api_key=REDACTED&basis=fiscal&token=REDACTED&token=REDACTED",
+		l.scrubQuery(url.Values{
+			"basis":   {"fiscal"},
+			"api_key": {"abc"},
+			"token":   {"x", "y"},
+		}),
+	)
+	assert.Equal(t, "", l.scrubQuery(url.Values{}))
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+
+	l.cfg.sampleAfter = 0
+	handler := withAccessLog(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "gone", http.StatusGone)
+		}),
+		l,
+	)
+	handler.ServeHTTP(
+		httptest.NewRecorder(),
+		httptest.NewRequest("GET", "/x?secret=hunter2&page=2", nil),
+	)
+
+	assert.Contains(t, buf.String(), `"status":410`)
+	assert.Contains(t, buf.String(), `"query":"page=2&secret=REDACTED"`)
+	assert.NotContains(t, buf.String(), "hunter2")
+}
+
+func TestHandler(t *testing.T) {
+	db, err := OpenEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = Handler(db, Options{Years: "bogus"})
+	assert.Error(t, err)
+
+	_, err = Handler(db, Options{BasePath: "nhe"})
+	assert.Error(t, err)
+
+	handler, err := Handler(db, Options{
+		Context:  t.Context(),
+		AdminKey: "secret",
+		BasePath: "/nhe/",
+	})
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/nhe/", http.StripPrefix("/nhe", handler))
+
+	for path, code := range map[string]int{
+		"/nhe/":                    http.StatusOK,
+		"/nhe/api/categories":      http.StatusOK,
+		"/nhe/admin/routes":        http.StatusUnauthorized,
+		"/elsewhere":               http.StatusNotFound,
+		"/nhe/series/medicare.csv": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, code, w.Code, path)
+		if w.Code == http.StatusOK {
+			assert.NotEmpty(t, w.Header().Get("Server-Timing"), path)
+		}
+	}
+
+	links := regexp.MustCompile(`(?:href|src|action)="(/[^"]*)"`)
+	for _, path := range []string{"/nhe/", "/nhe/category/1", "/nhe/lines"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+
+		found := links.FindAllStringSubmatch(w.Body.String(), -1)
+		assert.NotEmpty(t, found, path)
+		for _, link := range found {
+			assert.True(t, strings.HasPrefix(link[1], "/nhe/"), link[1])
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/nhe/", nil))
+	assert.Contains(t, w.Body.String(), `data-base="/nhe"`)
+	assert.Contains(t, w.Body.String(), `href="/nhe/static/css/output.css"`)
+}
+
+func TestAPIRoutes(t *testing.T) {
+	routes := apiRoutes(&App{})
+
+	paths := map[string]Route{}
+	for _, rt := range routes {
+		paths[rt.Path] = rt
+	}
+
+	for _, rt := range apiV1Routes(&App{}) {
+		v1, ok := paths["/api/v1"+rt.Path]
+		assert.True(t, ok, rt.Path)
+		assert.False(t, v1.Deprecated, rt.Path)
+	}
+
+	for _, p := range legacyAPIPaths {
+		legacy, ok := paths["/api"+p]
+		assert.True(t, ok, p)
+		assert.True(t, legacy.Deprecated, p)
+	}
+
+	alias := deprecatedAlias(
+		&App{base: "/nhe"},
+		Route{Handler: http.NotFoundHandler()},
+		"/api",
+		"/api/v1",
+	)
+	w := httptest.NewRecorder()
+	alias.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/table", nil))
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(
+		t,
+		`</nhe/api/v1/table>; rel="successor-version"`,
+		w.Header().Get("Link"),
+	)
+
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler, err := newHandler(
+		t.Context(),
+		&App{db: db, cache: newViewCache()},
+		exportGuard{},
+	)
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/api/categories/1/series",
+		nil,
+	))
+	assert.Equal(
+		t,
+		`</api/v1/categories/1/series>; rel="successor-version"`,
+		w.Header().Get("Link"),
+	)
+}
+
+func TestJobQueue(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		INSERT INTO jobs (kind, state, owner, heartbeat_at) VALUES
+			('load', 'running', 'elsewhere:1', CURRENT_TIMESTAMP),
+			('load', 'running', 'elsewhere:2', datetime('now', '-1 hour'))
+	`)
+	assert.NoError(t, err)
+	res, err := db.Exec(`
+		INSERT INTO jobs (kind, args)
+		VALUES ('export', '{"output":"early.csv"}')
+	`)
+	assert.NoError(t, err)
+	early, _ := res.LastInsertId()
+
+	app := &App{db: db, cache: newViewCache()}
+	q := newJobQueue(t.Context(), app, 1)
+
+	assert.Eventually(t, func() bool {
+		jobs, err := listJobs(db, 1)
+		assert.NoError(t, err)
+		return jobs[0].ID == early && jobs[0].State == JobDone
+	}, 5*time.Second, 10*time.Millisecond)
+
+	jobs, err := listJobs(db, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, JobFailed, jobs[1].State)
+	assert.Equal(t, JobRunning, jobs[2].State)
+	_, err = db.Exec("DELETE FROM jobs")
+	assert.NoError(t, err)
+
+	_, err = q.enqueue("fetch", nil)
+	assert.Error(t, err)
+
+	id, err := q.enqueue("export", map[string]string{"output": "out.csv"})
+	assert.NoError(t, err)
+
+	var job Job
+	assert.Eventually(t, func() bool {
+		jobs, err := listJobs(db, 10)
+		assert.NoError(t, err)
+		job = jobs[0]
+		return job.ID == id && job.State != JobQueued &&
+			job.State != JobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, JobDone, job.State, job.Error)
+	assert.Equal(t, "100%", job.Percent())
+
+	problems, err := verifyManifest(
+		filepath.Join(defaultExportDir, "out.csv"+manifestSuffix),
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	outside := t.TempDir()
+	assert.NoError(t, os.Symlink(
+		outside,
+		filepath.Join(defaultExportDir, "escape"),
+	))
+	for _, output := range []string{"../out.csv", "out.csv", "escape/out.csv"} {
+		id, err = q.enqueue("export", map[string]string{"output": output})
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			jobs, err := listJobs(db, 1)
+			assert.NoError(t, err)
+			return jobs[0].ID == id && jobs[0].State == JobFailed
+		}, 5*time.Second, 10*time.Millisecond, output)
+	}
+
+	entries, err := os.ReadDir(outside)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	closed := make(chan struct{})
+	go func() {
+		q.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job queue did not shut down")
+	}
+
+	res, err = db.Exec("INSERT INTO jobs (kind) VALUES ('load')")
+	assert.NoError(t, err)
+	queued, _ := res.LastInsertId()
+	ok, err := q.cancel(queued)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	jobs, err = listJobs(db, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, JobCancelled, jobs[0].State)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	embedded := &App{db: db, cache: newViewCache()}
+	_, err = newHandler(ctx, embedded, exportGuard{})
+	assert.NoError(t, err)
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		embedded.jobs.done.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler workers did not stop with their context")
+	}
+}
+
+func TestEnabledShortcuts(t *testing.T) {
+	keys := func(groups []ShortcutGroup) []string {
+		var keys []string
+		for _, g := range groups {
+			for _, sc := range g.Shortcuts {
+				keys = append(keys, sc.Key)
+			}
+		}
+		return keys
+	}
+
+	routes := []Route{
+		{Method: http.MethodGet, Path: "/table", Auth: AuthPublic},
+		{Method: http.MethodGet, Path: "/export.csv", Auth: AuthPublic},
+		{Method: http.MethodGet, Path: "/export.xlsx", Auth: AuthAdmin},
+	}
+	groups := enabledShortcuts(routes)
+	assert.Equal(
+		t,
+		[]string{"j", "k", "[", "]", "s", "d", "?"},
+		keys(groups),
+	)
+	assert.Equal(t, "Navigation", groups[0].Name)
+	assert.Equal(t, "Help", groups[len(groups)-1].Name)
+
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{db: db, cache: newViewCache()}
+	handler, err := newHandler(t.Context(), app, exportGuard{})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `<dialog id="shortcuts"`)
+	for _, sc := range tableShortcuts {
+		assert.Contains(t, body, "<kbd", sc.Key)
+		assert.Contains(t, body, sc.Action, sc.Key)
+	}
+}
@@ -0,0 +1,137 @@
+package nhe
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	pinnedCookie = "pinned"
+	hiddenCookie = "hidden"
+)
+
+type RowPrefs struct {
+	Pinned []string
+	Hidden []string
+}
+
+func requestRowPrefs(r *http.Request) RowPrefs {
+	var prefs RowPrefs
+	if c, err := r.Cookie(pinnedCookie); err == nil {
+		prefs.Pinned = parseExpanded(c.Value)
+	}
+	if c, err := r.Cookie(hiddenCookie); err == nil {
+		prefs.Hidden = parseExpanded(c.Value)
+	}
+	return prefs
+}
+
+func (p RowPrefs) update(form map[string][]string) RowPrefs {
+	without := func(slugs []string, slug string) []string {
+		return slices.DeleteFunc(slices.Clone(slugs), func(s string) bool {
+			return s == slug
+		})
+	}
+
+	if _, ok := form["reset"]; ok {
+		return RowPrefs{}
+	}
+	for _, slug := range form["pin"] {
+		p.Pinned = append(without(p.Pinned, slug), slug)
+	}
+	for _, slug := range form["unpin"] {
+		p.Pinned = without(p.Pinned, slug)
+	}
+	for _, slug := range form["hide"] {
+		p.Pinned = without(p.Pinned, slug)
+		p.Hidden = append(without(p.Hidden, slug), slug)
+	}
+	for _, slug := range form["unhide"] {
+		p.Hidden = without(p.Hidden, slug)
+	}
+	return p
+}
+
+func arrangeRows(data *TableData, prefs RowPrefs) *TableData {
+	if len(prefs.Pinned) == 0 && len(prefs.Hidden) == 0 {
+		return data
+	}
+
+	var (
+		arranged = *data
+		pinned   []TableCategory
+		rest     []TableCategory
+		pinOrder []int
+		order    []int
+		skip     = -1
+		within   = -1
+	)
+	arranged.HiddenRows = nil
+	for i, cat := range data.Categories {
+		if skip >= 0 && cat.Depth > skip {
+			continue
+		}
+		skip = -1
+		if within >= 0 && cat.Depth <= within {
+			within = -1
+		}
+
+		if slices.Contains(prefs.Hidden, cat.Slug) {
+			arranged.HiddenRows = append(arranged.HiddenRows, cat)
+			skip = cat.Depth
+			continue
+		}
+		if within < 0 && slices.Contains(prefs.Pinned, cat.Slug) {
+			cat.Pinned = true
+			within = cat.Depth
+		}
+		if within >= 0 {
+			pinned = append(pinned, cat)
+			pinOrder = append(pinOrder, data.rowIndex(i))
+			continue
+		}
+		rest = append(rest, cat)
+		order = append(order, data.rowIndex(i))
+	}
+
+	arranged.Categories = append(pinned, rest...)
+	arranged.Order = append(pinOrder, order...)
+	return &arranged
+}
+
+func (t *TableData) rowIndex(i int) int {
+	if t.Order != nil {
+		return t.Order[i]
+	}
+	return i
+}
+
+func rowPrefsHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prefs := requestRowPrefs(r).update(r.PostForm)
+		for name, slugs := range map[string][]string{
+			pinnedCookie: prefs.Pinned,
+			hiddenCookie: prefs.Hidden,
+		} {
+			maxAge := int(themeMaxAge.Seconds())
+			if len(slugs) == 0 {
+				maxAge = -1
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     name,
+				Value:    strings.Join(slugs, ","),
+				Path:     "/",
+				MaxAge:   maxAge,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		http.Redirect(w, r, themeReturn(app, r), http.StatusSeeOther)
+	}
+}
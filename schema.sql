@@ -22,3 +22,96 @@ CREATE TABLE IF NOT EXISTS expenditures (
     FOREIGN KEY (year_id) REFERENCES years(id),
     UNIQUE(category_id, year_id)
 );
+
+CREATE TABLE IF NOT EXISTS loads (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version TEXT NOT NULL,
+    source TEXT NOT NULL,
+    loaded_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS saved_views (
+    name TEXT PRIMARY KEY,
+    basis TEXT NOT NULL,
+    years TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS load_warnings (
+    id INTEGER PRIMARY KEY,
+    load_id INTEGER NOT NULL,
+    message TEXT NOT NULL,
+    FOREIGN KEY (load_id) REFERENCES loads(id)
+);
+
+CREATE TABLE IF NOT EXISTS load_notes (
+    id INTEGER PRIMARY KEY,
+    load_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    text TEXT NOT NULL,
+    FOREIGN KEY (load_id) REFERENCES loads(id)
+);
+
+CREATE TABLE IF NOT EXISTS annotations (
+    category TEXT NOT NULL,
+    year INTEGER NOT NULL,
+    note TEXT NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (category, year)
+);
+
+CREATE TABLE IF NOT EXISTS sparklines (
+    hash TEXT PRIMARY KEY,
+    svg TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    args TEXT NOT NULL DEFAULT '{}',
+    state TEXT NOT NULL DEFAULT 'queued',
+    progress REAL NOT NULL DEFAULT 0,
+    message TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TEXT,
+    finished_at TEXT
+);
+
+-- Total national health expenditures for each year.
+CREATE VIEW IF NOT EXISTS v_total_by_year AS
+SELECT
+    y.year,
+    e.amount
+FROM expenditures e
+JOIN years y ON y.id = e.year_id
+JOIN categories c ON c.id = e.category_id
+WHERE c.name = 'Total National Health Expenditures';
+
+-- Every category/year amount with its percentage of that year's total.
+CREATE VIEW IF NOT EXISTS v_share_of_total AS
+SELECT
+    c.id AS category_id,
+    c.name,
+    y.year,
+    e.amount,
+    t.amount AS total,
+    100.0 * e.amount / NULLIF(t.amount, 0) AS share
+FROM expenditures e
+JOIN categories c ON c.id = e.category_id
+JOIN years y ON y.id = e.year_id
+LEFT JOIN v_total_by_year t ON t.year = y.year;
+
+-- Categories with their depth and " > "-joined path from the root heading.
+CREATE VIEW IF NOT EXISTS v_category_tree AS
+WITH RECURSIVE tree(id, name, parent_id, depth, path, sort_order) AS (
+    SELECT id, name, parent_id, 0, name, sort_order
+    FROM categories
+    WHERE parent_id IS NULL
+    UNION ALL
+    SELECT c.id, c.name, c.parent_id, t.depth + 1,
+        t.path || ' > ' || c.name, c.sort_order
+    FROM categories c
+    JOIN tree t ON c.parent_id = t.id
+)
+SELECT id, name, parent_id, depth, path, sort_order
+FROM tree;
@@ -0,0 +1,105 @@
+package nhe
+
+import (
+	"html/template"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	maxSuggestions = 5
+	minSimilarity  = 0.25
+)
+
+type CategoryMatch struct {
+	CategoryRef
+	Score float64 `json:"score"`
+}
+
+func trigrams(s string) map[string]bool {
+	s = "  " + strings.ReplaceAll(slugify(s), "-", " ") + " "
+	rs := []rune(s)
+
+	grams := map[string]bool{}
+	for i := 0; i+3 <= len(rs); i++ {
+		grams[string(rs[i:i+3])] = true
+	}
+	return grams
+}
+
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for g := range a {
+		if b[g] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func matchCategories(refs []CategoryRef, q string, n int) []CategoryMatch {
+	want := trigrams(q)
+
+	var (
+		matches []CategoryMatch
+		seen    = map[string]bool{}
+	)
+	for _, ref := range refs {
+		score := similarity(want, trigrams(ref.Name))
+		if score < minSimilarity || seen[ref.Name] {
+			continue
+		}
+		seen[ref.Name] = true
+		matches = append(matches, CategoryMatch{ref, score})
+	}
+
+	slices.SortStableFunc(matches, func(a, b CategoryMatch) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches
+}
+
+type notFoundPage struct {
+	Path        string
+	Suggestions []CategoryMatch
+}
+
+func renderNotFound(
+	w http.ResponseWriter,
+	r *http.Request,
+	app *App,
+	tmpl *template.Template,
+	query string,
+) {
+	query = path.Base(query)
+	page := notFoundPage{Path: r.URL.Path}
+	if refs, err := cachedCategoryRefs(app); err == nil {
+		page.Suggestions = matchCategories(refs, query, maxSuggestions)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	renderPage(w, r, tmpl, "notfound.html", page)
+}
+
+func notFoundHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSuffix(r.URL.Path, path.Ext(r.URL.Path))
+		renderNotFound(w, r, app, tmpl, query)
+	}
+}
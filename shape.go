@@ -0,0 +1,102 @@
+package nhe
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+var shapeParam = RouteParam{
+	Name:        "shape",
+	In:          "query",
+	Type:        "string",
+	Description: "long (one row per year, default) or wide (year-keyed map)",
+}
+
+type WideSeries struct {
+	ID          int                `json:"id"`
+	Name        string             `json:"name"`
+	ParentID    *int               `json:"parent_id"`
+	Units       string             `json:"units"`
+	Scale       int64              `json:"scale"`
+	Metric      string             `json:"metric,omitempty"`
+	FirstYear   *int               `json:"first_year"`
+	Values      map[int]*float64   `json:"values"`
+	Status      map[int]CellStatus `json:"status"`
+	Derivations []Derivation       `json:"derivations,omitempty"`
+}
+
+func parseSeriesShape(s string) (string, error) {
+	switch s {
+	case "", LayoutLong:
+		return LayoutLong, nil
+	case LayoutWide:
+		return LayoutWide, nil
+	}
+	return "", badQuery(
+		"unknown shape %q (want %s or %s)",
+		s,
+		LayoutLong,
+		LayoutWide,
+	)
+}
+
+func (cs *CategorySeries) point(p SeriesPoint) *float64 {
+	if cs.Metric != "" {
+		return p.Value
+	}
+	return amountOf(p)
+}
+
+func (cs *CategorySeries) wide() WideSeries {
+	ws := WideSeries{
+		ID:          cs.ID,
+		Name:        cs.Name,
+		ParentID:    cs.ParentID,
+		Units:       cs.Units,
+		Scale:       cs.Scale,
+		Metric:      cs.Metric,
+		FirstYear:   cs.FirstYear,
+		Values:      make(map[int]*float64, len(cs.Series)),
+		Status:      make(map[int]CellStatus, len(cs.Series)),
+		Derivations: metricDerivations(cs.Metric, "values"),
+	}
+	for _, p := range cs.Series {
+		ws.Values[p.Year] = cs.point(p)
+		ws.Status[p.Year] = p.Status
+	}
+	return ws
+}
+
+func (cs *CategorySeries) cell(p SeriesPoint) string {
+	switch {
+	case cs.Metric != "":
+		if p.Value != nil {
+			return strconv.FormatFloat(*p.Value, 'f', 2, 64)
+		}
+	case p.Amount != nil:
+		return strconv.Itoa(*p.Amount)
+	}
+	return ""
+}
+
+func writeWideSeriesCSV(w io.Writer, cs *CategorySeries) error {
+	var (
+		cw     = csv.NewWriter(w)
+		header = []string{"category"}
+		row    = []string{cs.Name}
+	)
+	for _, p := range cs.Series {
+		header = append(header, strconv.Itoa(p.Year))
+		row = append(row, cs.cell(p))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,118 @@
+package nhe
+
+import "slices"
+
+type Shortcut struct {
+	Key    string
+	Group  string
+	Action string
+	Route  string
+}
+
+type ShortcutGroup struct {
+	Name      string
+	Shortcuts []Shortcut
+}
+
+var tableShortcuts = []Shortcut{
+	{
+		Key:    "j",
+		Group:  "Navigation",
+		Action: "Move to the next row",
+	},
+	{
+		Key:    "k",
+		Group:  "Navigation",
+		Action: "Move to the previous row",
+	},
+	{
+		Key:    "Enter",
+		Group:  "Navigation",
+		Action: "Expand or collapse the focused row",
+		Route:  "GET /children/{slug...}",
+	},
+	{
+		Key:    "[",
+		Group:  "Navigation",
+		Action: "Show later years",
+		Route:  "GET /table",
+	},
+	{
+		Key:    "]",
+		Group:  "Navigation",
+		Action: "Show earlier years",
+		Route:  "GET /table",
+	},
+	{
+		Key:    "c",
+		Group:  "Navigation",
+		Action: "Compare two years",
+		Route:  "GET /compare",
+	},
+	{
+		Key:    "l",
+		Group:  "Navigation",
+		Action: "Plot categories as lines",
+		Route:  "GET /lines",
+	},
+	{
+		Key:    "p",
+		Group:  "Navigation",
+		Action: "Open the print view",
+		Route:  "GET /print",
+	},
+	{
+		Key:    "s",
+		Group:  "Sorting",
+		Action: "Sort by category name",
+		Route:  "GET /table",
+	},
+	{
+		Key:    "d",
+		Group:  "Export",
+		Action: "Download this view as CSV",
+		Route:  "GET /export.csv",
+	},
+	{
+		Key:    "x",
+		Group:  "Export",
+		Action: "Download this view as XLSX",
+		Route:  "GET /export.xlsx",
+	},
+	{
+		Key:    "J",
+		Group:  "Export",
+		Action: "Download this view as JSON",
+		Route:  "GET /api/v1/table",
+	},
+	{
+		Key:    "?",
+		Group:  "Help",
+		Action: "Show or hide this help",
+	},
+}
+
+func visitorRoute(routes []Route, pattern string) bool {
+	return slices.ContainsFunc(routes, func(rt Route) bool {
+		return rt.Pattern() == pattern && rt.Auth != AuthAdmin
+	})
+}
+
+func enabledShortcuts(routes []Route) []ShortcutGroup {
+	var groups []ShortcutGroup
+	for _, sc := range tableShortcuts {
+		if sc.Route != "" && !visitorRoute(routes, sc.Route) {
+			continue
+		}
+
+		i := slices.IndexFunc(groups, func(g ShortcutGroup) bool {
+			return g.Name == sc.Group
+		})
+		if i < 0 {
+			groups = append(groups, ShortcutGroup{Name: sc.Group})
+			i = len(groups) - 1
+		}
+		groups[i].Shortcuts = append(groups[i].Shortcuts, sc)
+	}
+	return groups
+}
@@ -0,0 +1,137 @@
+package nhe
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+type CategoryRef struct {
+	ID       int    `json:"id"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	ParentID *int   `json:"parent_id"`
+}
+
+func slugify(s string) string {
+	var (
+		b    strings.Builder
+		dash = false
+	)
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func categoryRefs(db *sql.DB) ([]CategoryRef, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT c.id, c.name, c.parent_id, c.is_major_heading, %s = '%s'
+		FROM categories c
+		ORDER BY c.sort_order, c.id
+	`, capsOf(db).source("c"), SourceUser))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		refs    []CategoryRef
+		paths   = map[int]string{}
+		seen    = map[string]int{}
+		section string
+	)
+	for rows.Next() {
+		var (
+			ref     CategoryRef
+			heading bool
+			user    bool
+		)
+		err := rows.Scan(
+			&ref.ID,
+			&ref.Name,
+			&ref.ParentID,
+			&heading,
+			&user,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		path := slugify(ref.Name)
+		if ref.ParentID != nil {
+			path = paths[*ref.ParentID] + "/" + path
+		}
+		paths[ref.ID] = path
+
+		if heading {
+			section = slugify(ref.Name)
+		}
+		if user {
+			section = ""
+		}
+
+		ref.Slug = path
+		inSection := path == section ||
+			strings.HasPrefix(path, section+"/")
+		if section != "" && !inSection {
+			ref.Slug = section + "/" + path
+		}
+
+		seen[ref.Slug]++
+		if n := seen[ref.Slug]; n > 1 {
+			ref.Slug = fmt.Sprintf("%s-%d", ref.Slug, n)
+		}
+
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+func cachedCategoryRefs(app *App) ([]CategoryRef, error) {
+	return cachedView(app, "category-refs", func() ([]CategoryRef, error) {
+		return categoryRefs(app.db)
+	})
+}
+
+func cachedCategoryRef(app *App, slug string) (CategoryRef, bool, error) {
+	refs, err := cachedCategoryRefs(app)
+	if err != nil {
+		return CategoryRef{}, false, err
+	}
+	ref, ok := findCategoryRef(refs, slug)
+	return ref, ok, nil
+}
+
+func findCategoryRef(refs []CategoryRef, slug string) (CategoryRef, bool) {
+	return findRef(refs, func(ref CategoryRef) bool {
+		return ref.Slug == slug
+	})
+}
+
+func findCategoryRefByID(refs []CategoryRef, id int) (CategoryRef, bool) {
+	return findRef(refs, func(ref CategoryRef) bool {
+		return ref.ID == id
+	})
+}
+
+func findRef(
+	refs []CategoryRef,
+	match func(CategoryRef) bool,
+) (CategoryRef, bool) {
+	i := slices.IndexFunc(refs, match)
+	if i < 0 {
+		return CategoryRef{}, false
+	}
+	return refs[i], true
+}
@@ -0,0 +1,106 @@
+package nhe
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+const (
+	noteTitle    = "title"
+	noteFootnote = "footnote"
+)
+
+var footnotePrefixes = []string{"*", "NOTE:", "SOURCE:"}
+
+type SourceNotes struct {
+	Title     string   `json:"title,omitempty"`
+	Footnotes []string `json:"footnotes,omitempty"`
+}
+
+func (n SourceNotes) empty() bool {
+	return n.Title == "" && len(n.Footnotes) == 0
+}
+
+func footnoteRow(name string, cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	for _, prefix := range footnotePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func recordSourceNotes(
+	ctx context.Context,
+	tx *sql.Tx,
+	loadID int64,
+	notes SourceNotes,
+) error {
+	insert := func(kind, text string) error {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO load_notes (load_id, kind, text) VALUES (?, ?, ?)",
+			loadID,
+			kind,
+			text,
+		)
+		return err
+	}
+
+	if notes.Title != "" {
+		if err := insert(noteTitle, notes.Title); err != nil {
+			return err
+		}
+	}
+	for _, text := range notes.Footnotes {
+		if err := insert(noteFootnote, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sourceNotes(db *sql.DB) (*SourceNotes, error) {
+	if !capsOf(db).has("load_notes", "") {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT kind, text
+		FROM load_notes
+		WHERE load_id = (SELECT MAX(id) FROM loads)
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes SourceNotes
+	for rows.Next() {
+		var kind, text string
+		if err := rows.Scan(&kind, &text); err != nil {
+			return nil, err
+		}
+		switch kind {
+		case noteTitle:
+			notes.Title = text
+		case noteFootnote:
+			notes.Footnotes = append(notes.Footnotes, text)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if notes.empty() {
+		return nil, nil
+	}
+	return &notes, nil
+}
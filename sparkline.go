@@ -0,0 +1,187 @@
+package nhe
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	sparklineWidth  = 100
+	sparklineHeight = 24
+	sparklinePad    = 2
+)
+
+type sparklineSVG struct {
+	Width  int
+	Height int
+	Lines  []string
+}
+
+func renderSparkline(values []*int) (string, error) {
+	var (
+		lo, hi int
+		seen   bool
+	)
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if !seen || *v < lo {
+			lo = *v
+		}
+		if !seen || *v > hi {
+			hi = *v
+		}
+		seen = true
+	}
+
+	var (
+		svg    = sparklineSVG{Width: sparklineWidth, Height: sparklineHeight}
+		step   = float64(sparklineWidth) / float64(max(len(values)-1, 1))
+		span   = float64(max(hi-lo, 1))
+		height = float64(sparklineHeight - 2*sparklinePad)
+		points []string
+	)
+	flush := func() {
+		if len(points) > 1 {
+			svg.Lines = append(svg.Lines, strings.Join(points, " "))
+		}
+		points = nil
+	}
+	for i, v := range values {
+		if v == nil {
+			flush()
+			continue
+		}
+		y := sparklinePad + height - float64(*v-lo)/span*height
+		points = append(points, fmt.Sprintf("%.1f,%.1f", float64(i)*step, y))
+	}
+	flush()
+
+	return renderSVG("sparkline", svg)
+}
+
+func sparklineHash(svg string) string {
+	sum := sha256.Sum256([]byte(svg))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+func renderSparklines(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.id, e.amount
+		FROM categories c
+		LEFT JOIN expenditures e ON e.category_id = c.id
+		LEFT JOIN years y ON y.id = e.year_id
+		ORDER BY c.id, y.year
+	`)
+	if err != nil {
+		return err
+	}
+
+	var (
+		ids    []int
+		series = map[int][]*int{}
+	)
+	for rows.Next() {
+		var (
+			id     int
+			amount *int
+		)
+		if err := rows.Scan(&id, &amount); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := series[id]; !ok {
+			ids = append(ids, id)
+		}
+		series[id] = append(series[id], amount)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		svg, err := renderSparkline(series[id])
+		if err != nil {
+			return err
+		}
+		hash := sparklineHash(svg)
+
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT OR IGNORE INTO sparklines (hash, svg) VALUES (?, ?)",
+			hash,
+			svg,
+		)
+		if err != nil {
+			return fmt.Errorf("insert sparkline: %w", err)
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			"UPDATE categories SET sparkline = ? WHERE id = ?",
+			hash,
+			id,
+		)
+		if err != nil {
+			return fmt.Errorf("set sparkline of category %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func backfillSparklines(ctx context.Context, db *sql.DB) error {
+	var missing int
+	err := db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM categories WHERE sparkline = ''",
+	).Scan(&missing)
+	if err != nil || missing == 0 {
+		return err
+	}
+
+	tx, err := beginWrite(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := renderSparklines(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func sparklineHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash, ok := strings.CutSuffix(r.PathValue("file"), ".svg")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		var svg string
+		err := app.db.QueryRow(
+			"SELECT svg FROM sparklines WHERE hash = ?",
+			hash,
+		).Scan(&svg)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Cache-Control", immutableCacheControl)
+		fmt.Fprint(w, svg)
+	}
+}
@@ -0,0 +1,165 @@
+package nhe
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//go:embed export.sql
+var exportSQL string
+
+const sqlBatchRows = 500
+
+var sqlDumpTables = []struct {
+	name    string
+	columns []string
+}{
+	{"years", []string{"id", "year"}},
+	{"categories", []string{
+		"id",
+		"name",
+		"parent_id",
+		"indent_level",
+		"sort_order",
+		"is_major_heading",
+		"units",
+		"scale",
+		"source",
+	}},
+	{"expenditures", []string{
+		"id",
+		"category_id",
+		"year_id",
+		"amount",
+		"status",
+	}},
+}
+
+type sqlBatch struct {
+	w       *bufio.Writer
+	table   string
+	columns []string
+	n       int
+}
+
+func (b *sqlBatch) add(values []any) {
+	if b.n == 0 {
+		fmt.Fprintf(
+			b.w,
+			"INSERT INTO %s (%s) VALUES\n",
+			b.table,
+			strings.Join(b.columns, ", "),
+		)
+	} else {
+		fmt.Fprint(b.w, ",\n")
+	}
+
+	fmt.Fprint(b.w, "(")
+	for i, v := range values {
+		if i > 0 {
+			fmt.Fprint(b.w, ", ")
+		}
+		fmt.Fprint(b.w, sqlLiteral(v))
+	}
+	fmt.Fprint(b.w, ")")
+
+	b.n++
+	if b.n == sqlBatchRows {
+		b.flush()
+	}
+}
+
+func (b *sqlBatch) flush() {
+	if b.n == 0 {
+		return
+	}
+	fmt.Fprint(b.w, ";\n")
+	b.n = 0
+}
+
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []byte:
+		return sqlLiteral(string(v))
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return fmt.Sprint(v)
+}
+
+func dumpSQLTable(
+	ctx context.Context,
+	db *sql.DB,
+	b *sqlBatch,
+) (int, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s ORDER BY id",
+		strings.Join(b.columns, ", "),
+		b.table,
+	))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var (
+		values = make([]any, len(b.columns))
+		ptrs   = make([]any, len(b.columns))
+		n      int
+	)
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		b.add(values)
+		n++
+	}
+	b.flush()
+	return n, rows.Err()
+}
+
+func writeSQLDump(ctx context.Context, w io.Writer, db *sql.DB) (int, error) {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\nBEGIN;\n\n", exportSQL)
+
+	var (
+		caps  = capsOf(db)
+		total = 0
+	)
+	for _, t := range sqlDumpTables {
+		columns := slices.DeleteFunc(
+			slices.Clone(t.columns),
+			func(column string) bool {
+				return !caps.has(t.name, column)
+			},
+		)
+		n, err := dumpSQLTable(ctx, db, &sqlBatch{
+			w:       bw,
+			table:   t.name,
+			columns: columns,
+		})
+		if err != nil {
+			return total, fmt.Errorf("dump %s: %w", t.name, err)
+		}
+		total += n
+		fmt.Fprint(bw, "\n")
+	}
+
+	fmt.Fprint(bw, "COMMIT;\n")
+	return total, bw.Flush()
+}
@@ -0,0 +1,142 @@
+const lineColors = ["#2563eb", "#dc2626", "#16a34a", "#d97706", "#7c3aed", "#0891b2", "#db2777", "#4b5563"];
+const svgNS = "http://www.w3.org/2000/svg";
+const lineBox = { width: 800, height: 400, left: 72, right: 16, top: 16, bottom: 32 };
+
+function svgElement(name, attrs, text) {
+  const el = document.createElementNS(svgNS, name);
+  for (const [key, value] of Object.entries(attrs)) {
+    el.setAttribute(key, value);
+  }
+  if (text !== undefined) {
+    el.textContent = text;
+  }
+  return el;
+}
+
+function lineValue(series, metric, i) {
+  const v = series.values[metric][i];
+  if (v === null) {
+    return null;
+  }
+  return metric === "amount" ? v * series.scale : v;
+}
+
+function lineLabel(v, metric) {
+  if (metric !== "amount") {
+    return v.toFixed(1) + "%";
+  }
+  const abs = Math.abs(v);
+  for (const [size, suffix] of [[1e12, "T"], [1e9, "B"], [1e6, "M"], [1e3, "K"]]) {
+    if (abs >= size) {
+      return (v / size).toFixed(1) + suffix;
+    }
+  }
+  return v.toFixed(0);
+}
+
+function drawLines(chart, legend, data, metric) {
+  const { width, height, left, right, top, bottom } = lineBox;
+  const years = data.years;
+  const series = data.series ?? [];
+  const values = series.flatMap((s) => years.map((_, i) => lineValue(s, metric, i))).filter((v) => v !== null);
+
+  chart.replaceChildren();
+  legend.replaceChildren();
+  if (!years.length || !values.length) {
+    chart.textContent = "No data for the selected categories.";
+    return;
+  }
+
+  let lo = Math.min(0, ...values);
+  let hi = Math.max(...values);
+  if (hi === lo) {
+    hi = lo + 1;
+  }
+  const x = (i) => left + (years.length > 1 ? (i * (width - left - right)) / (years.length - 1) : 0);
+  const y = (v) => top + ((hi - v) * (height - top - bottom)) / (hi - lo);
+
+  const svg = svgElement("svg", { viewBox: `0 0 ${width} ${height}`, role: "img", class: "w-full h-auto text-gray-500 dark:text-gray-400" });
+  svg.append(svgElement("title", {}, series.map((s) => s.name).join(", ")));
+
+  for (let g = 0; g <= 4; g++) {
+    const v = lo + ((hi - lo) * g) / 4;
+    svg.append(svgElement("line", { x1: left, x2: width - right, y1: y(v), y2: y(v), stroke: "currentColor", "stroke-opacity": 0.2 }));
+    svg.append(svgElement("text", { x: left - 6, y: y(v) + 4, "text-anchor": "end", "font-size": 11, fill: "currentColor" }, lineLabel(v, metric)));
+  }
+  years.forEach((year, i) => {
+    if (year % 10 === 0 || i === 0 || i === years.length - 1) {
+      svg.append(svgElement("text", { x: x(i), y: height - 10, "text-anchor": "middle", "font-size": 11, fill: "currentColor" }, year));
+    }
+  });
+
+  series.forEach((s, n) => {
+    const color = lineColors[n % lineColors.length];
+    let d = "";
+    let pen = "M";
+    years.forEach((year, i) => {
+      const v = lineValue(s, metric, i);
+      if (v === null) {
+        pen = "M";
+        return;
+      }
+      d += `${pen}${x(i).toFixed(1)},${y(v).toFixed(1)}`;
+      pen = "L";
+    });
+    const path = svgElement("path", { d, fill: "none", stroke: color, "stroke-width": 2 });
+    path.append(svgElement("title", {}, s.name));
+    svg.append(path);
+
+    years.forEach((year, i) => {
+      const v = lineValue(s, metric, i);
+      if (v === null) {
+        return;
+      }
+      const dot = svgElement("circle", { cx: x(i), cy: y(v), r: 3, fill: color, "fill-opacity": 0 });
+      dot.append(svgElement("title", {}, `${s.name}, ${year}: ${lineLabel(v, metric)}`));
+      svg.append(dot);
+    });
+
+    const item = document.createElement("li");
+    item.innerHTML = `<span class="inline-block w-3 h-3 mr-1 rounded-sm" style="background: ${color}"></span>`;
+    item.append(s.name);
+    legend.append(item);
+  });
+
+  chart.append(svg);
+}
+
+async function plotLines(form) {
+  const chart = document.getElementById("line-chart");
+  const legend = document.getElementById("line-legend");
+  const params = new URLSearchParams(new FormData(form));
+  const categories = params.getAll("category");
+  const metric = params.get("metric");
+  history.replaceState(null, "", "?" + params.toString());
+
+  if (!categories.length) {
+    chart.textContent = "Pick at least one category.";
+    legend.replaceChildren();
+    return;
+  }
+
+  const res = await fetch(chart.dataset.endpoint, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ categories, metrics: [metric] }),
+  });
+  if (!res.ok) {
+    chart.textContent = await res.text();
+    return;
+  }
+  drawLines(chart, legend, await res.json(), metric);
+}
+
+const linesForm = document.getElementById("lines");
+if (linesForm) {
+  linesForm.addEventListener("change", () => plotLines(linesForm));
+  linesForm.addEventListener("submit", (event) => {
+    event.preventDefault();
+    plotLines(linesForm);
+  });
+  plotLines(linesForm);
+}
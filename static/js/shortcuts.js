@@ -0,0 +1,72 @@
+function tableRows() {
+  return [...document.querySelectorAll("#year-table tbody tr:not([hidden])")];
+}
+
+function moveRow(step) {
+  const rows = tableRows();
+  const current = rows.indexOf(document.activeElement?.closest("tr"));
+  const next = rows[Math.min(Math.max(current + step, 0), rows.length - 1)];
+  if (!next) {
+    return;
+  }
+  next.tabIndex = -1;
+  next.focus();
+  next.scrollIntoView({ block: "nearest" });
+}
+
+function toggleShortcuts() {
+  const dialog = document.getElementById("shortcuts");
+  if (!dialog) {
+    return;
+  }
+  if (dialog.open) {
+    dialog.close();
+    return;
+  }
+  dialog.showModal();
+}
+
+document.addEventListener("keydown", (event) => {
+  if (event.ctrlKey || event.metaKey || event.altKey) {
+    return;
+  }
+  if (event.target.closest("input, select, textarea")) {
+    return;
+  }
+
+  switch (event.key) {
+    case "?":
+      event.preventDefault();
+      toggleShortcuts();
+      return;
+    case "j":
+      event.preventDefault();
+      moveRow(1);
+      return;
+    case "k":
+      event.preventDefault();
+      moveRow(-1);
+      return;
+    case "Enter":
+      if (event.target.matches("tr")) {
+        event.preventDefault();
+        event.target.querySelector("button[data-expand]")?.click();
+      }
+      return;
+  }
+
+  if (document.getElementById("shortcuts")?.open) {
+    return;
+  }
+  const target = document.querySelector(`[data-shortcut="${CSS.escape(event.key)}"]`);
+  if (target) {
+    event.preventDefault();
+    target.click();
+  }
+});
+
+document.addEventListener("click", (event) => {
+  if (event.target.closest('button[data-shortcut="?"]')) {
+    toggleShortcuts();
+  }
+});
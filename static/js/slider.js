@@ -0,0 +1,34 @@
+function sliderParams(form) {
+  const params = new URLSearchParams(location.search);
+  for (const [name, value] of new FormData(form)) {
+    params.set(name, value);
+  }
+  for (const input of form.querySelectorAll("input[data-bound]")) {
+    params.set(input.dataset.bound, input.value);
+    form.elements[input.dataset.bound].value = input.value;
+  }
+  params.delete("page");
+  return params;
+}
+
+document.addEventListener("input", (event) => {
+  const input = event.target.closest("input[data-bound]");
+  if (!input) {
+    return;
+  }
+  const slider = input.closest("[data-year-slider]");
+  const [from, to] = slider.querySelectorAll("input[data-bound]");
+  if (Number(from.value) > Number(to.value)) {
+    if (input === from) {
+      to.value = from.value;
+    } else {
+      from.value = to.value;
+    }
+  }
+  slider.querySelector("[data-year-label]").textContent = from.value + "–" + to.value;
+  swapView(sliderParams(input.form), false);
+});
+
+for (const slider of document.querySelectorAll("[data-year-slider]")) {
+  slider.hidden = false;
+}
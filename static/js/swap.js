@@ -0,0 +1,54 @@
+let swapping;
+
+async function swapView(params, push) {
+  swapping?.abort();
+  swapping = new AbortController();
+
+  const url = new URL(document.documentElement.dataset.base + "/table", location.origin);
+  url.search = params.toString();
+
+  let res;
+  try {
+    res = await fetch(url, { signal: swapping.signal });
+  } catch {
+    return;
+  }
+  if (!res.ok) {
+    return;
+  }
+
+  const fragment = document.createElement("template");
+  fragment.innerHTML = await res.text();
+  for (const el of [...fragment.content.children]) {
+    document.getElementById(el.id)?.replaceWith(el);
+  }
+
+  const next = "?" + params.toString();
+  if (push) {
+    history.pushState(null, "", next);
+    return;
+  }
+  history.replaceState(null, "", next);
+}
+
+document.addEventListener("click", (event) => {
+  const link = event.target.closest("a[data-swap]");
+  if (!link || event.button !== 0) {
+    return;
+  }
+  if (event.metaKey || event.ctrlKey || event.shiftKey || event.altKey) {
+    return;
+  }
+  event.preventDefault();
+  const params = new URL(link.href).searchParams;
+  params.delete("expand");
+  const expanded = new URLSearchParams(location.search).get("expand");
+  if (expanded) {
+    params.set("expand", expanded);
+  }
+  swapView(params, true);
+});
+
+window.addEventListener("popstate", () => {
+  swapView(new URLSearchParams(location.search), false);
+});
@@ -0,0 +1,106 @@
+function rowDepth(row) {
+  return Number(row.dataset.depth);
+}
+
+function descendants(row) {
+  const rows = [];
+  const depth = rowDepth(row);
+  for (let next = row.nextElementSibling; next; next = next.nextElementSibling) {
+    if (rowDepth(next) <= depth) {
+      break;
+    }
+    rows.push(next);
+  }
+  return rows;
+}
+
+function collapse(row, button) {
+  for (const child of descendants(row)) {
+    child.hidden = true;
+    child.querySelector("button[data-expand]")?.setAttribute("aria-expanded", "false");
+  }
+  button.setAttribute("aria-expanded", "false");
+  button.innerHTML = "&#9656;";
+}
+
+async function expand(row, button) {
+  if (!row.dataset.loaded) {
+    const url = new URL(
+      document.documentElement.dataset.base + "/children/" + button.dataset.expand,
+      location.origin,
+    );
+    url.search = location.search;
+    const res = await fetch(url);
+    if (!res.ok) {
+      return;
+    }
+    row.insertAdjacentHTML("afterend", await res.text());
+    row.dataset.loaded = "true";
+  }
+
+  const depth = rowDepth(row);
+  for (const child of descendants(row)) {
+    child.hidden = rowDepth(child) !== depth + 1;
+  }
+  button.setAttribute("aria-expanded", "true");
+  button.innerHTML = "&#9662;";
+}
+
+function expandedInput() {
+  let input = document.querySelector('input[form="year-range"][name="expand"]');
+  if (!input) {
+    input = document.createElement("input");
+    input.type = "hidden";
+    input.name = "expand";
+    input.setAttribute("form", "year-range");
+    document.getElementById("view-controls")?.append(input);
+  }
+  return input;
+}
+
+function syncExpanded() {
+  const open = [];
+  for (const button of document.querySelectorAll('#year-table tr button[data-expand][aria-expanded="true"]')) {
+    open.push(button.dataset.expand);
+  }
+
+  const params = new URLSearchParams(location.search);
+  params.delete("expand");
+  if (open.length) {
+    params.set("expand", open.join(","));
+  }
+  history.replaceState(null, "", "?" + params.toString());
+  expandedInput().value = open.join(",");
+}
+
+document.addEventListener("click", async (event) => {
+  const button = event.target.closest("button[data-expand]");
+  if (!button) {
+    return;
+  }
+  const row = button.closest("tr");
+  if (button.getAttribute("aria-expanded") === "true") {
+    collapse(row, button);
+  } else {
+    await expand(row, button);
+  }
+  syncExpanded();
+});
+
+function cellTooltip(cell) {
+  const lines = [cell.dataset.exact];
+  if (cell.dataset.change) {
+    lines.push("Change from prior year: " + cell.dataset.change);
+  }
+  if (cell.dataset.share) {
+    lines.push("Share of total: " + cell.dataset.share);
+  }
+  return lines.join("\n");
+}
+
+document.addEventListener("pointerover", (event) => {
+  const cell = event.target.closest("td[data-exact]");
+  if (cell && !cell.title) {
+    cell.title = cellTooltip(cell);
+  }
+});
@@ -0,0 +1,385 @@
+package nhe
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type outputStore interface {
+	create(ctx context.Context, name string) (storeFile, error)
+	close() error
+}
+
+type storeFile interface {
+	io.Writer
+	commit() error
+	abort()
+}
+
+func openStore(dest string) (outputStore, error) {
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		return newS3Store(dest)
+	case strings.HasSuffix(dest, ".zip"):
+		return newZipStore(dest)
+	}
+	return dirStore{root: dest}, nil
+}
+
+type dirStore struct {
+	root string
+}
+
+type dirFile struct {
+	*os.File
+}
+
+func (s dirStore) create(_ context.Context, name string) (storeFile, error) {
+	p := filepath.Join(s.root, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", p, err)
+	}
+	return dirFile{f}, nil
+}
+
+func (s dirStore) close() error {
+	return nil
+}
+
+func (f dirFile) commit() error {
+	return f.Close()
+}
+
+func (f dirFile) abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+type rootStore struct {
+	root *os.Root
+}
+
+type rootFile struct {
+	*os.File
+	root *os.Root
+	name string
+}
+
+func openRootStore(dir string) (*rootStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", dir, err)
+	}
+	return &rootStore{root: root}, nil
+}
+
+func (s *rootStore) create(_ context.Context, name string) (storeFile, error) {
+	var (
+		dir   string
+		parts = strings.Split(filepath.Dir(name), string(filepath.Separator))
+	)
+	for _, part := range parts {
+		dir = filepath.Join(dir, part)
+		err := s.root.Mkdir(dir, 0o755)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+	}
+
+	f, err := s.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", name, err)
+	}
+	return rootFile{File: f, root: s.root, name: name}, nil
+}
+
+func (s *rootStore) close() error {
+	return s.root.Close()
+}
+
+func (f rootFile) commit() error {
+	return f.Close()
+}
+
+func (f rootFile) abort() {
+	f.Close()
+	f.root.Remove(f.name)
+}
+
+type zipStore struct {
+	f  *os.File
+	zw *zip.Writer
+}
+
+type bufferedFile struct {
+	bytes.Buffer
+	flush func(b []byte) error
+}
+
+func (f *bufferedFile) commit() error {
+	return f.flush(f.Bytes())
+}
+
+func (f *bufferedFile) abort() {
+	f.Reset()
+}
+
+func newZipStore(p string) (*zipStore, error) {
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", p, err)
+	}
+	return &zipStore{f: f, zw: zip.NewWriter(f)}, nil
+}
+
+func (s *zipStore) create(_ context.Context, name string) (storeFile, error) {
+	return &bufferedFile{flush: func(b []byte) error {
+		w, err := s.zw.CreateHeader(&zip.FileHeader{
+			Name:     filepath.ToSlash(name),
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}}, nil
+}
+
+func (s *zipStore) close() error {
+	if err := s.zw.Close(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+type awsCredentials struct {
+	id     string
+	secret string
+	token  string
+}
+
+type s3Store struct {
+	client   *http.Client
+	endpoint string
+	bucket   string
+	prefix   string
+	region   string
+	creds    awsCredentials
+	now      func() time.Time
+}
+
+func newS3Store(dest string) (*s3Store, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 destination %q", dest)
+	}
+
+	s := &s3Store{
+		client:   http.DefaultClient,
+		endpoint: os.Getenv("AWS_ENDPOINT_URL"),
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		region:   os.Getenv("AWS_REGION"),
+		creds: awsCredentials{
+			id:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secret: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			token:  os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		now: time.Now,
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.creds.id == "" || s.creds.secret == "" {
+		return nil, fmt.Errorf(
+			"S3 destination needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY",
+		)
+	}
+	return s, nil
+}
+
+func (s *s3Store) objectURL(key string) string {
+	key = awsEscape(key, true)
+	if s.endpoint != "" {
+		return strings.TrimSuffix(s.endpoint, "/") +
+			"/" + s.bucket + "/" + key
+	}
+	return fmt.Sprintf(
+		"https://%s.s3.%s.amazonaws.com/%s",
+		s.bucket,
+		s.region,
+		key,
+	)
+}
+
+func (s *s3Store) create(ctx context.Context, name string) (storeFile, error) {
+	key := path.Join(s.prefix, filepath.ToSlash(name))
+	return &bufferedFile{flush: func(b []byte) error {
+		return s.put(ctx, key, b)
+	}}, nil
+}
+
+func (s *s3Store) put(ctx context.Context, key string, body []byte) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPut,
+		s.objectURL(key),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	if s.creds.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.creds.token)
+	}
+	signV4(req, s.creds, s.region, "s3", s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("put s3://%s/%s: %w", s.bucket, key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf(
+			"put s3://%s/%s: %s: %s",
+			s.bucket,
+			key,
+			resp.Status,
+			bytes.TrimSpace(msg),
+		)
+	}
+	return nil
+}
+
+func (s *s3Store) close() error {
+	return nil
+}
+
+func awsEscape(s string, slash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z',
+			'a' <= c && c <= 'z',
+			'0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~',
+			c == '/' && slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func signV4(
+	req *http.Request,
+	creds awsCredentials,
+	region string,
+	service string,
+	at time.Time,
+) {
+	var (
+		stamp = at.UTC().Format("20060102T150405Z")
+		day   = stamp[:8]
+		scope = day + "/" + region + "/" + service + "/aws4_request"
+	)
+	req.Header.Set("X-Amz-Date", stamp)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := slices.Sorted(maps.Keys(headers))
+
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonHeaders, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+
+	q := req.URL.Query()
+	var params []string
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(
+				params,
+				awsEscape(k, false)+"="+awsEscape(v, false),
+			)
+		}
+	}
+	slices.Sort(params)
+
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = "UNSIGNED-PAYLOAD"
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, true),
+		strings.Join(params, "&"),
+		canonHeaders.String(),
+		signed,
+		payload,
+	}, "\n")
+	digest := sha256.Sum256([]byte(canonical))
+
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		stamp,
+		scope,
+		hex.EncodeToString(digest[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.secret), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.id,
+		scope,
+		signed,
+		hex.EncodeToString(hmacSHA256(key, toSign)),
+	))
+}
@@ -0,0 +1,140 @@
+package nhe
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const defaultYearStrategy = "every:3"
+
+type YearStrategy interface {
+	Select(years []int) []int
+	String() string
+}
+
+type YearStrategyPreset struct {
+	Spec  string
+	Label string
+}
+
+var yearStrategyPresets = []YearStrategyPreset{
+	{"every", "Every year"},
+	{"every:3", "Every 3rd year"},
+	{"every:5", "Every 5th year"},
+	{"every:10", "Every 10th year"},
+	{"decades", "Decade endpoints"},
+}
+
+var yearStrategies = map[string]func(arg string) (YearStrategy, error){
+	"every":      parseEveryN,
+	"milestones": parseMilestones,
+	"decades": func(arg string) (YearStrategy, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("decades takes no argument")
+		}
+		return decadeEndpoints{}, nil
+	},
+}
+
+func parseYearStrategy(spec string) (YearStrategy, error) {
+	if spec == "" {
+		spec = defaultYearStrategy
+	}
+
+	name, arg, _ := strings.Cut(spec, ":")
+	parse, ok := yearStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown year strategy %q", name)
+	}
+
+	s, err := parse(arg)
+	if err != nil {
+		return nil, fmt.Errorf("year strategy %q: %w", spec, err)
+	}
+	return s, nil
+}
+
+type everyNYears int
+
+func parseEveryN(arg string) (YearStrategy, error) {
+	if arg == "" {
+		return everyNYears(1), nil
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("step must be a positive integer")
+	}
+	return everyNYears(n), nil
+}
+
+func (n everyNYears) Select(years []int) []int {
+	var idx []int
+	for i := len(years) - 1; i >= 0; i -= int(n) {
+		idx = append(idx, i)
+	}
+	return idx
+}
+
+func (n everyNYears) String() string {
+	if n == 1 {
+		return "every"
+	}
+	return fmt.Sprintf("every:%d", int(n))
+}
+
+type milestoneYears []int
+
+func parseMilestones(arg string) (YearStrategy, error) {
+	var m milestoneYears
+	for _, field := range strings.Split(arg, ",") {
+		year, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid year %q", field)
+		}
+		m = append(m, year)
+	}
+
+	slices.Sort(m)
+	return slices.Compact(m), nil
+}
+
+func (m milestoneYears) Select(years []int) []int {
+	var idx []int
+	for i := len(years) - 1; i >= 0; i-- {
+		if slices.Contains(m, years[i]) {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+func (m milestoneYears) String() string {
+	fields := make([]string, len(m))
+	for i, year := range m {
+		fields[i] = strconv.Itoa(year)
+	}
+	return "milestones:" + strings.Join(fields, ",")
+}
+
+type decadeEndpoints struct{}
+
+func (decadeEndpoints) Select(years []int) []int {
+	var idx []int
+	for i := len(years) - 1; i >= 0; i-- {
+		var (
+			first = i == 0 || years[i-1]/10 != years[i]/10
+			last  = i == len(years)-1 || years[i+1]/10 != years[i]/10
+		)
+		if first || last {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+func (decadeEndpoints) String() string {
+	return "decades"
+}
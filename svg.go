@@ -0,0 +1,46 @@
+package nhe
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/svg/*
+var svgTemplateFS embed.FS
+
+var svgTemplates = template.Must(
+	template.New("").Funcs(template.FuncMap{
+		"xml": xmlEscape,
+	}).ParseFS(svgTemplateFS, "templates/svg/*"),
+)
+
+type svgRect struct {
+	X    int
+	Y    int
+	W    int
+	H    int
+	Fill string
+}
+
+type svgText struct {
+	X      int
+	Y      int
+	Anchor string
+	Fill   string
+	Text   string
+}
+
+type svgMark struct {
+	Rect  *svgRect
+	Label *svgText
+}
+
+func renderSVG(name string, data any) (string, error) {
+	var b strings.Builder
+	if err := svgTemplates.ExecuteTemplate(&b, name, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", name, err)
+	}
+	return b.String(), nil
+}
@@ -1,4 +1,5 @@
 module.exports = {
+  darkMode: 'class',
   content: [
     "./templates/**/*.html",
     "./demo.html",
@@ -15,6 +16,17 @@ module.exports = {
     'bg-orange-200',
     'bg-red-200',
     'bg-gray-100',
+    'bg-blue-900',
+    'bg-sky-900',
+    'bg-cyan-900',
+    'bg-teal-900',
+    'bg-green-900',
+    'bg-lime-900',
+    'bg-yellow-900',
+    'bg-amber-900',
+    'bg-orange-900',
+    'bg-red-900',
+    'bg-gray-800',
   ],
   theme: {
     extend: {},
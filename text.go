@@ -0,0 +1,51 @@
+package nhe
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/tqbf/nhe/texttable"
+)
+
+//go:embed templates/*.txt templates/*.tex templates/*.md
+var textTemplateFS embed.FS
+
+var textTemplates = template.Must(
+	template.New("").Funcs(template.FuncMap{
+		"rule":     textRule,
+		"latex":    latexEscape,
+		"markdown": markdownEscape,
+		"indent":   markdownIndent,
+	}).ParseFS(
+		textTemplateFS,
+		"templates/*.txt",
+		"templates/*.tex",
+		"templates/*.md",
+	),
+)
+
+func renderText(w io.Writer, t texttable.Table) error {
+	t.Layout()
+
+	if err := textTemplates.ExecuteTemplate(w, "table.txt", &t); err != nil {
+		return fmt.Errorf("render text table: %w", err)
+	}
+	return nil
+}
+
+func renderTable(w io.Writer, data *TableData, width int) error {
+	if err := renderText(w, nheTextTable(data, width)); err != nil {
+		return err
+	}
+	if err := textTemplates.ExecuteTemplate(w, "notes.txt", data.Notes); err != nil {
+		return fmt.Errorf("render text notes: %w", err)
+	}
+	return nil
+}
+
+func textRule(ch string, width int) string {
+	return strings.Repeat(ch, width)
+}
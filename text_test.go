@@ -0,0 +1,94 @@
+package nhe
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tqbf/nhe/texttable"
+)
+
+func TestRenderText(t *testing.T) {
+	var b strings.Builder
+	err := renderText(&b, texttable.Table{
+		Title: "Spending",
+		Width: 20,
+		Columns: []texttable.Column{
+			{Header: "NAME"},
+			{Header: "AMT", Width: 6, Align: texttable.Right},
+		},
+		Rows: [][]string{
+			{"Medicare", "42"},
+			{"CHIP", "N/A"},
+		},
+	})
+	assert.NoError(t, err)
+
+	lines := strings.Split(b.String(), "\n")
+	assert.Equal(t, "Spending", lines[0])
+	assert.Equal(t, strings.Repeat("=", 20), lines[1])
+	assert.Equal(t, "NAME             AMT", lines[2])
+	assert.Equal(t, "Medicare          42", lines[4])
+	assert.Equal(t, "CHIP             N/A", lines[5])
+}
+
+func TestDumpLaTeX(t *testing.T) {
+	from, to, err := parseDumpYears("2019-2023")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2019, 2023}, []int{from, to})
+	_, _, err = parseDumpYears("2023-2019")
+	assert.Error(t, err)
+
+	assert.Equal(t, `R\&D 50\% \$`, latexEscape("R&D 50% $"))
+	n := -1234567
+	assert.Equal(t, "$-$1{,}234{,}567", latexAmount(&n, CellValue))
+	assert.Equal(t, "---", latexAmount(nil, CellNoData))
+
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dump, err := queryDump(db, QueryOptions{
+		Years: []YearRange{{From: 2022, To: 2023}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2022, 2023}, dump.Years)
+
+	var buf bytes.Buffer
+	assert.NoError(t, renderLaTeX(&buf, dump))
+	out := buf.String()
+	assert.Contains(t, out, `\begin{tabular}{lrr}`)
+	assert.Contains(t, out, "Category & 2022 & 2023 \\\\")
+	assert.Contains(t, out, "4{,}866{,}494 \\\\")
+	assert.Contains(t, out, `\hspace{1em}Out of pocket`)
+	assert.NotContains(t, out, "SOURCE")
+
+	_, err = queryDump(db, QueryOptions{
+		Years: []YearRange{{From: 1900, To: 1901}},
+	})
+	assert.Error(t, err)
+}
+
+func TestDumpMarkdown(t *testing.T) {
+	assert.Equal(t, `a \| b \*c\* &lt;d&gt;`, markdownEscape("a | b *c* <d>"))
+
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dump, err := queryDump(db, QueryOptions{
+		Years: []YearRange{{From: 2023, To: 2023}},
+	})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, renderMarkdown(&buf, dump))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "### National Health Expenditures - Year 2023", lines[0])
+	assert.Equal(t, "| Category | 2023 |", lines[2])
+	assert.Equal(t, "|:---|---:|", lines[3])
+	assert.Equal(t, "| Total National Health Expenditures | 4866494 |", lines[4])
+	assert.Equal(t, "| &emsp;Out of pocket | 505684 |", lines[5])
+	assert.Contains(t, buf.String(), `Other Federal Programs\*`)
+}
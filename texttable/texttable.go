@@ -0,0 +1,187 @@
+package texttable
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Align int
+
+const (
+	Left Align = iota
+	Right
+	Center
+)
+
+const (
+	Gap      = "  "
+	Ellipsis = "…"
+)
+
+type Column struct {
+	Header   string
+	Width    int
+	Align    Align
+	Truncate bool
+}
+
+type Table struct {
+	Title   string
+	Width   int
+	Columns []Column
+	Rows    [][]string
+}
+
+var wideRanges = []*unicode.RangeTable{
+	unicode.Han,
+	unicode.Hangul,
+	unicode.Hiragana,
+	unicode.Katakana,
+	{
+		R16: []unicode.Range16{
+			{Lo: 0x1100, Hi: 0x115f, Stride: 1},
+			{Lo: 0x2e80, Hi: 0x303e, Stride: 1},
+			{Lo: 0x3041, Hi: 0x33ff, Stride: 1},
+			{Lo: 0xa000, Hi: 0xa4cf, Stride: 1},
+			{Lo: 0xac00, Hi: 0xd7a3, Stride: 1},
+			{Lo: 0xf900, Hi: 0xfaff, Stride: 1},
+			{Lo: 0xfe30, Hi: 0xfe4f, Stride: 1},
+			{Lo: 0xff00, Hi: 0xff60, Stride: 1},
+			{Lo: 0xffe0, Hi: 0xffe6, Stride: 1},
+		},
+		R32: []unicode.Range32{
+			{Lo: 0x1f300, Hi: 0x1f64f, Stride: 1},
+			{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1},
+			{Lo: 0x20000, Hi: 0x3fffd, Stride: 1},
+		},
+	},
+}
+
+func RuneWidth(r rune) int {
+	switch {
+	case r == 0:
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case unicode.In(r, wideRanges...):
+		return 2
+	}
+	return 1
+}
+
+func Width(s string) int {
+	width := 0
+	for _, r := range s {
+		width += RuneWidth(r)
+	}
+	return width
+}
+
+func Truncate(s string, width int) string {
+	if Width(s) <= width {
+		return s
+	}
+
+	limit := width - Width(Ellipsis)
+	if limit < 0 {
+		return ""
+	}
+
+	var (
+		b    strings.Builder
+		used = 0
+	)
+	for _, r := range s {
+		w := RuneWidth(r)
+		if used+w > limit {
+			break
+		}
+		b.WriteRune(r)
+		used += w
+	}
+	b.WriteString(Ellipsis)
+	return b.String()
+}
+
+func Pad(s string, width int, align Align) string {
+	fill := width - Width(s)
+	if fill <= 0 {
+		return s
+	}
+
+	switch align {
+	case Right:
+		return strings.Repeat(" ", fill) + s
+	case Center:
+		left := fill / 2
+		return strings.Repeat(" ", left) + s +
+			strings.Repeat(" ", fill-left)
+	}
+	return s + strings.Repeat(" ", fill)
+}
+
+func (t *Table) Headers() []string {
+	headers := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		headers[i] = col.Header
+	}
+	return headers
+}
+
+func (t *Table) Layout() {
+	t.Columns = append([]Column(nil), t.Columns...)
+
+	fixed := Width(Gap) * (len(t.Columns) - 1)
+	flex := -1
+	for i, col := range t.Columns {
+		if col.Width == 0 && flex < 0 {
+			flex = i
+			continue
+		}
+		fixed += col.Width
+	}
+
+	if flex >= 0 {
+		col := &t.Columns[flex]
+		col.Width = max(t.Width-fixed, Width(col.Header))
+		if t.Width == 0 {
+			col.Width = t.naturalWidth(flex)
+		}
+		fixed += col.Width
+	}
+
+	if t.Width < fixed {
+		t.Width = fixed
+	}
+}
+
+func (t *Table) naturalWidth(idx int) int {
+	width := Width(t.Columns[idx].Header)
+	for _, row := range t.Rows {
+		if idx < len(row) {
+			width = max(width, Width(row[idx]))
+		}
+	}
+	return width
+}
+
+func (t *Table) Line(values []string) string {
+	var b strings.Builder
+	for i, col := range t.Columns {
+		if i > 0 {
+			b.WriteString(Gap)
+		}
+
+		val := ""
+		if i < len(values) {
+			val = values[i]
+		}
+
+		if col.Truncate {
+			val = Truncate(val, col.Width)
+		}
+
+		b.WriteString(Pad(val, col.Width, col.Align))
+	}
+	return strings.TrimRight(b.String(), " ")
+}
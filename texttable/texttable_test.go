@@ -0,0 +1,43 @@
+package texttable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWidth(t *testing.T) {
+	assert.Equal(t, 8, Width("Medicare"))
+	assert.Equal(t, 8, Width("医疗保险"))
+	assert.Equal(t, 4, Width("café"))
+	assert.Equal(t, 4, Width("café"))
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "Medicare", Truncate("Medicare", 8))
+	assert.Equal(t, "Medi…", Truncate("Medicare", 5))
+	assert.Equal(t, "医疗…", Truncate("医疗保险", 6))
+	assert.Equal(t, "医…", Truncate("医疗保险", 4))
+	assert.Equal(t, "", Truncate("Medicare", 0))
+}
+
+func TestLineAlignment(t *testing.T) {
+	table := Table{
+		Width: 16,
+		Columns: []Column{
+			{Header: "NAME", Truncate: true},
+			{Header: "AMT", Width: 4, Align: Right},
+		},
+	}
+	table.Layout()
+
+	assert.Equal(t, "医疗保险      42", table.Line([]string{
+		"医疗保险",
+		"42",
+	}))
+	assert.Equal(t, "Total Nat…    42", table.Line([]string{
+		"Total National Health",
+		"42",
+	}))
+	assert.Equal(t, "  ab  ", Pad("ab", 6, Center))
+}
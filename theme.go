@@ -0,0 +1,100 @@
+package nhe
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type Theme string
+
+const (
+	ThemeLight Theme = "light"
+	ThemeDark  Theme = "dark"
+)
+
+const (
+	themeCookie = "theme"
+	themeMaxAge = 365 * 24 * time.Hour
+)
+
+func parseTheme(s string) (Theme, error) {
+	switch Theme(s) {
+	case "", ThemeLight:
+		return ThemeLight, nil
+	case ThemeDark:
+		return ThemeDark, nil
+	}
+	return "", fmt.Errorf("unknown theme %q", s)
+}
+
+func requestTheme(r *http.Request) Theme {
+	c, err := r.Cookie(themeCookie)
+	if err != nil {
+		return ThemeLight
+	}
+	theme, err := parseTheme(c.Value)
+	if err != nil {
+		return ThemeLight
+	}
+	return theme
+}
+
+func (t Theme) Dark() bool {
+	return t == ThemeDark
+}
+
+func (t Theme) Class() string {
+	if t.Dark() {
+		return "dark"
+	}
+	return ""
+}
+
+func (t Theme) Toggle() Theme {
+	if t.Dark() {
+		return ThemeLight
+	}
+	return ThemeDark
+}
+
+func (t Theme) Label() string {
+	if t.Dark() {
+		return "Dark mode"
+	}
+	return "Light mode"
+}
+
+func themeHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		theme, err := parseTheme(r.PostForm.Get("theme"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     themeCookie,
+			Value:    string(theme),
+			Path:     "/",
+			MaxAge:   int(themeMaxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, themeReturn(app, r), http.StatusSeeOther)
+	}
+}
+
+func themeReturn(app *App, r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Host != r.Host || u.Path == "" {
+		return app.url("/")
+	}
+	return u.RequestURI()
+}
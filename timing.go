@@ -0,0 +1,120 @@
+package nhe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type timingKey struct{}
+
+type timingPhase struct {
+	name string
+	dur  time.Duration
+}
+
+type serverTiming struct {
+	mu     sync.Mutex
+	start  time.Time
+	phases []timingPhase
+}
+
+func timingFrom(ctx context.Context) *serverTiming {
+	t, _ := ctx.Value(timingKey{}).(*serverTiming)
+	return t
+}
+
+func (t *serverTiming) track(name string, since time.Time) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.phases = append(t.phases, timingPhase{
+		name: name,
+		dur:  time.Since(since),
+	})
+}
+
+func (t *serverTiming) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b strings.Builder
+	for _, p := range t.phases {
+		fmt.Fprintf(&b, "%s;dur=%.2f, ", p.name, millis(p.dur))
+	}
+	fmt.Fprintf(&b, "total;dur=%.2f", millis(time.Since(t.start)))
+	return b.String()
+}
+
+func (t *serverTiming) attrs() []any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attrs := []any{}
+	for _, p := range t.phases {
+		attrs = append(attrs, p.name, p.dur)
+	}
+	return attrs
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type timingWriter struct {
+	http.ResponseWriter
+	timing      *serverTiming
+	wroteHeader bool
+}
+
+func (w *timingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Server-Timing", w.timing.header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func withTiming(next http.Handler, budget time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timing := &serverTiming{start: time.Now()}
+		ctx := context.WithValue(r.Context(), timingKey{}, timing)
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(&timingWriter{ResponseWriter: w, timing: timing}, r)
+
+		total := time.Since(timing.start)
+		if budget <= 0 || total <= budget {
+			return
+		}
+
+		attrs := append([]any{
+			"pattern", r.Pattern,
+			"path", r.URL.Path,
+			"total", total,
+			"budget", budget,
+		}, timing.attrs()...)
+		slog.Warn("view exceeded timing budget", attrs...)
+	})
+}
@@ -0,0 +1,49 @@
+package nhe
+
+import (
+	"fmt"
+	"strconv"
+)
+
+var scaleNames = map[int64]string{
+	1_000:         " thousand",
+	1_000_000:     " million",
+	1_000_000_000: " billion",
+}
+
+func groupThousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+func formatExact(n *int, units string, scale int64) string {
+	if n == nil {
+		return ""
+	}
+
+	v, sign := *n, ""
+	if v < 0 {
+		v, sign = -v, "-"
+	}
+	f := unitFormat(units)
+	return sign + f.Prefix + groupThousands(v) + scaleNames[scale] + f.Suffix
+}
+
+func (c TableCategory) Exact(i int) string {
+	return formatExact(c.Values[i], c.Units, c.Scale)
+}
+
+func (c TableCategory) Change(i int) string {
+	if i >= len(c.Previous) {
+		return ""
+	}
+	prev, cur := c.Previous[i], c.Values[i]
+	if prev == nil || cur == nil || *prev == 0 {
+		return ""
+	}
+	pct := float64(*cur-*prev) / float64(*prev) * 100
+	return fmt.Sprintf("%+.1f%%", pct)
+}
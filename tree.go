@@ -0,0 +1,151 @@
+package nhe
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+type treeNode struct {
+	id       int
+	name     string
+	units    string
+	scale    int64
+	amount   *int
+	children []*treeNode
+}
+
+func loadTree(
+	db *sql.DB,
+	year int,
+	opts QueryOptions,
+) ([]*treeNode, error) {
+	if err := opts.amountsOnly(); err != nil {
+		return nil, err
+	}
+
+	f, err := opts.resolve(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		caps        = capsOf(db)
+		where, args = f.categoryWhere()
+	)
+	rows, err := db.Query(`
+		SELECT
+			c.id,
+			c.name,
+			c.parent_id,
+			`+caps.units("c")+`,
+			`+caps.scale("c")+`,
+			e.amount
+		FROM categories c
+		LEFT JOIN years y ON y.year = ?
+		LEFT JOIN expenditures e
+			ON e.category_id = c.id AND e.year_id = y.id
+		WHERE `+where+`
+		ORDER BY `+f.orderBy(), append([]any{year}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		nodes = map[int]*treeNode{}
+		roots []*treeNode
+	)
+
+	for rows.Next() {
+		var (
+			parentID *int
+			node     = &treeNode{}
+		)
+		err := rows.Scan(
+			&node.id,
+			&node.name,
+			&parentID,
+			&node.units,
+			&node.scale,
+			&node.amount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes[node.id] = node
+
+		if parentID == nil || nodes[*parentID] == nil {
+			roots = append(roots, node)
+			continue
+		}
+
+		parent := nodes[*parentID]
+		parent.children = append(parent.children, node)
+	}
+
+	return roots, rows.Err()
+}
+
+func writeTree(
+	w io.Writer,
+	nodes []*treeNode,
+	prefix string,
+	depth int,
+	showAmounts bool,
+) {
+	for i, node := range nodes {
+		var (
+			last   = i == len(nodes)-1
+			branch = "├── "
+			indent = "│   "
+		)
+		if last {
+			branch = "└── "
+			indent = "    "
+		}
+
+		fmt.Fprintf(w, "%s%s%s", prefix, branch, node.name)
+		if showAmounts {
+			fmt.Fprintf(w, " (%s)", formatAmount(node.amount))
+		}
+		fmt.Fprintln(w)
+
+		if depth == 1 {
+			continue
+		}
+
+		writeTree(
+			w,
+			node.children,
+			prefix+indent,
+			max(depth-1, 0),
+			showAmounts,
+		)
+	}
+}
+
+func treeCmd(app *App, c *cli.Context) error {
+	opts, err := cliQueryOptions(c)
+	if err != nil {
+		return err
+	}
+
+	db, done, err := datasetDB(app, opts)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	roots, err := loadTree(db, c.Int("year"), opts)
+	if err != nil {
+		return err
+	}
+
+	writeTree(os.Stdout, roots, "", c.Int("depth"), c.IsSet("year"))
+	return nil
+}
@@ -0,0 +1,379 @@
+package nhe
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"image/color"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	treemapWidth  = 960
+	treemapHeight = 540
+	treemapDepth  = 3
+	treemapHeader = 16
+	treemapPad    = 2
+)
+
+var treemapPalette = []color.RGBA{
+	{0x25, 0x63, 0xeb, 0xff},
+	{0xd9, 0x77, 0x06, 0xff},
+	{0x16, 0xa3, 0x4a, 0xff},
+	{0x7c, 0x3a, 0xed, 0xff},
+	{0xdb, 0x27, 0x77, 0xff},
+	{0x08, 0x91, 0xb2, 0xff},
+	{0x65, 0xa3, 0x0d, 0xff},
+	{0x4b, 0x55, 0x63, 0xff},
+}
+
+type treemapRect struct {
+	x float64
+	y float64
+	w float64
+	h float64
+}
+
+type TreemapTile struct {
+	Slug   string
+	Name   string
+	Amount string
+	Share  float64
+	Depth  int
+	Color  string
+	rect   treemapRect
+}
+
+type TreemapPage struct {
+	Year     int
+	Years    []int
+	Category string
+	Name     string
+	Amount   string
+	Depth    int
+	Roots    []CategoryRef
+	Tiles    []TreemapTile
+	SVG      template.HTML
+	Theme    Theme
+}
+
+func (p TreemapPage) Children() []TreemapTile {
+	var tiles []TreemapTile
+	for _, t := range p.Tiles {
+		if t.Depth == 1 {
+			tiles = append(tiles, t)
+		}
+	}
+	return tiles
+}
+
+func worstRatio(row []float64, side float64) float64 {
+	var (
+		sum = 0.0
+		lo  = math.Inf(1)
+		hi  = 0.0
+	)
+	for _, a := range row {
+		sum += a
+		lo = min(lo, a)
+		hi = max(hi, a)
+	}
+	s2, w2 := sum*sum, side*side
+	return max(w2*hi/s2, s2/(w2*lo))
+}
+
+func squarify(areas []float64, r treemapRect) []treemapRect {
+	out := make([]treemapRect, 0, len(areas))
+	for len(areas) > 0 {
+		side := min(r.w, r.h)
+		n := 1
+		for n < len(areas) &&
+			worstRatio(areas[:n+1], side) <= worstRatio(areas[:n], side) {
+			n++
+		}
+
+		sum := 0.0
+		for _, a := range areas[:n] {
+			sum += a
+		}
+		thick, off := sum/side, 0.0
+		for _, a := range areas[:n] {
+			l := a / thick
+			if r.w >= r.h {
+				out = append(out, treemapRect{r.x, r.y + off, thick, l})
+			} else {
+				out = append(out, treemapRect{r.x + off, r.y, l, thick})
+			}
+			off += l
+		}
+		if r.w >= r.h {
+			r.x, r.w = r.x+thick, r.w-thick
+		} else {
+			r.y, r.h = r.y+thick, r.h-thick
+		}
+		areas = areas[n:]
+	}
+	return out
+}
+
+func nodeDollars(n *treeNode) float64 {
+	if n.amount == nil || *n.amount < 0 {
+		return 0
+	}
+	return float64(*n.amount) * float64(n.scale)
+}
+
+func layoutTreemap(
+	root *treeNode,
+	slugs map[int]string,
+	depth int,
+) []TreemapTile {
+	var (
+		tiles []TreemapTile
+		total = nodeDollars(root)
+		walk  func(n *treeNode, r treemapRect, d int, c color.RGBA)
+	)
+	walk = func(n *treeNode, r treemapRect, d int, c color.RGBA) {
+		v := nodeDollars(n)
+		tiles = append(tiles, TreemapTile{
+			Slug:   slugs[n.id],
+			Name:   n.name,
+			Amount: formatExact(n.amount, n.units, n.scale),
+			Share:  v / total * 100,
+			Depth:  d,
+			Color:  hexColor(c),
+			rect:   r,
+		})
+		if d == depth {
+			return
+		}
+
+		inner := treemapRect{
+			x: r.x + treemapPad,
+			y: r.y + treemapHeader,
+			w: r.w - 2*treemapPad,
+			h: r.h - treemapHeader - treemapPad,
+		}
+		if inner.w <= 0 || inner.h <= 0 {
+			return
+		}
+
+		var (
+			kids []*treeNode
+			sum  = 0.0
+		)
+		for _, k := range n.children {
+			if nodeDollars(k) > 0 {
+				kids = append(kids, k)
+				sum += nodeDollars(k)
+			}
+		}
+		if len(kids) == 0 {
+			return
+		}
+		slices.SortStableFunc(kids, func(a, b *treeNode) int {
+			return cmp.Compare(nodeDollars(b), nodeDollars(a))
+		})
+
+		var (
+			scale = inner.w * inner.h / max(sum, v)
+			areas = make([]float64, len(kids))
+		)
+		for i, k := range kids {
+			areas[i] = nodeDollars(k) * scale
+		}
+		if sum < v {
+			areas = append(areas, (v-sum)*scale)
+		}
+
+		for i, kr := range squarify(areas, inner)[:len(kids)] {
+			kc := c
+			if d == 0 {
+				kc = treemapPalette[i%len(treemapPalette)]
+			}
+			walk(kids[i], kr, d+1, kc)
+		}
+	}
+
+	if total > 0 {
+		full := treemapRect{0, 0, treemapWidth, treemapHeight}
+		walk(root, full, 0, chartAxis)
+	}
+	return tiles
+}
+
+func treemapLink(app *App, year, depth int, slug string) string {
+	q := url.Values{}
+	q.Set("year", strconv.Itoa(year))
+	q.Set("category", slug)
+	q.Set("depth", strconv.Itoa(depth))
+	return app.url("/treemap?" + q.Encode())
+}
+
+type treemapLabel struct {
+	X    float64
+	Y    float64
+	Text string
+}
+
+type treemapSVGTile struct {
+	Href    string
+	X       float64
+	Y       float64
+	W       float64
+	H       float64
+	Fill    string
+	Opacity float64
+	Title   string
+	Label   *treemapLabel
+}
+
+type treemapSVG struct {
+	Width  int
+	Height int
+	Title  string
+	Tiles  []treemapSVGTile
+}
+
+func renderTreemapSVG(
+	app *App,
+	tiles []TreemapTile,
+	year int,
+	depth int,
+) (string, error) {
+	svg := treemapSVG{
+		Width:  treemapWidth,
+		Height: treemapHeight,
+		Title:  fmt.Sprintf("Health spending in %d", year),
+	}
+	for _, t := range tiles {
+		r := t.rect
+		tile := treemapSVGTile{
+			Href:    treemapLink(app, year, depth, t.Slug),
+			X:       r.x,
+			Y:       r.y,
+			W:       r.w,
+			H:       r.h,
+			Fill:    t.Color,
+			Opacity: min(0.25+0.2*float64(t.Depth), 0.9),
+			Title: fmt.Sprintf(
+				"%s: %s (%.1f%% of total)",
+				t.Name,
+				t.Amount,
+				t.Share,
+			),
+		}
+		if r.h >= treemapHeader && float64(textWidth(t.Name)+8) <= r.w {
+			tile.Label = &treemapLabel{
+				X:    r.x + 4,
+				Y:    r.y + 12,
+				Text: t.Name,
+			}
+		}
+		svg.Tiles = append(svg.Tiles, tile)
+	}
+	return renderSVG("treemap", svg)
+}
+
+func treemapHandler(app *App, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		depth := treemapDepth
+		if v := q.Get("depth"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				writeReadError(w, badQuery("invalid depth %q", v))
+				return
+			}
+			depth = n
+		}
+
+		start := time.Now()
+		years, err := queryYears(app.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(years) == 0 {
+			http.Error(w, "no data loaded", http.StatusNotFound)
+			return
+		}
+		year := years[len(years)-1]
+		if v := q.Get("year"); v != "" {
+			if year, err = strconv.Atoi(v); err != nil {
+				writeReadError(w, badQuery("invalid year %q", v))
+				return
+			}
+			if !slices.Contains(years, year) {
+				writeReadError(w, badQuery("no data for year %d", year))
+				return
+			}
+		}
+
+		refs, err := cachedCategoryRefs(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var (
+			roots []CategoryRef
+			slugs = make(map[int]string, len(refs))
+		)
+		for _, ref := range refs {
+			slugs[ref.ID] = ref.Slug
+			if ref.ParentID == nil {
+				roots = append(roots, ref)
+			}
+		}
+
+		slug := q.Get("category")
+		if slug == "" {
+			i := slices.IndexFunc(roots, func(ref CategoryRef) bool {
+				return ref.Name == totalCategory
+			})
+			if i < 0 {
+				http.Error(w, "no "+totalCategory, http.StatusNotFound)
+				return
+			}
+			slug = roots[i].Slug
+		}
+
+		nodes, err := loadTree(app.db, year, QueryOptions{
+			Categories: []string{slug},
+		})
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		timingFrom(r.Context()).track("db", start)
+
+		page := TreemapPage{
+			Year:     year,
+			Years:    years,
+			Category: slug,
+			Depth:    depth,
+			Roots:    roots,
+			Theme:    requestTheme(r),
+		}
+		if len(nodes) > 0 {
+			root := nodes[0]
+			page.Name = root.name
+			page.Amount = formatExact(root.amount, root.units, root.scale)
+			page.Tiles = layoutTreemap(root, slugs, depth)
+			svg, err := renderTreemapSVG(app, page.Tiles, year, depth)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			page.SVG = template.HTML(svg)
+		}
+		renderPage(w, r, tmpl, "treemap.html", page)
+	}
+}
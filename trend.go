@@ -0,0 +1,82 @@
+package nhe
+
+import (
+	"fmt"
+	"math"
+)
+
+const defaultTrendThreshold = 10.0
+
+type Trend struct {
+	Up          bool
+	Significant bool
+	Since       int
+	Change      float64
+	Annual      float64
+}
+
+func (a *App) trendThreshold() float64 {
+	if a.threshold > 0 {
+		return a.threshold
+	}
+	return defaultTrendThreshold
+}
+
+func newTrend(prev, cur, since, year int) *Trend {
+	if prev == 0 || cur == prev || year <= since {
+		return nil
+	}
+
+	ratio := float64(cur) / float64(prev)
+	annual := math.Inf(1)
+	if ratio > 0 {
+		annual = (math.Pow(ratio, 1/float64(year-since)) - 1) * 100
+	}
+	return &Trend{
+		Up:     cur > prev,
+		Since:  since,
+		Change: float64(cur-prev) / math.Abs(float64(prev)) * 100,
+		Annual: annual,
+	}
+}
+
+func priorColumns(shown, all []int) []int {
+	prior := make([]int, len(shown))
+	for i, year := range shown {
+		prior[i] = -1
+		for j, y := range all {
+			if y < year && (prior[i] < 0 || y > all[prior[i]]) {
+				prior[i] = j
+			}
+		}
+	}
+	return prior
+}
+
+func yearAt(years []int, i int) int {
+	if i < 0 {
+		return 0
+	}
+	return years[i]
+}
+
+func (t TableData) Trend(c TableCategory, i int) *Trend {
+	if i >= len(c.Prior) || i >= len(t.PriorYears) {
+		return nil
+	}
+	prev, cur := c.Prior[i], c.Values[i]
+	if prev == nil || cur == nil || c.Status[i] == CellSuppressed {
+		return nil
+	}
+
+	tr := newTrend(*prev, *cur, t.PriorYears[i], t.Years[i])
+	if tr == nil {
+		return nil
+	}
+	tr.Significant = math.Abs(tr.Annual) >= t.Threshold
+	return tr
+}
+
+func (tr Trend) Label() string {
+	return fmt.Sprintf("%+.1f%% since %d", tr.Change, tr.Since)
+}
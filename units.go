@@ -0,0 +1,97 @@
+package nhe
+
+import (
+	"strings"
+)
+
+const (
+	unitsUSD          = "USD"
+	unitsPersons      = "persons"
+	unitsUSDPerCapita = "USD per capita"
+)
+
+func headerScale(header string) int64 {
+	header = strings.ToLower(header)
+	switch {
+	case strings.Contains(header, "(billions)"):
+		return 1_000_000_000
+	case strings.Contains(header, "(millions)"):
+		return 1_000_000
+	case strings.Contains(header, "(thousands)"):
+		return 1_000
+	}
+	return 1
+}
+
+func seriesUnits(name string, scale int64) (string, int64) {
+	switch {
+	case name == "POPULATION":
+		return unitsPersons, scale
+	case strings.Contains(strings.ToLower(name), "per capita"):
+		return unitsUSDPerCapita, 1
+	}
+	return unitsUSD, scale
+}
+
+type UnitFormat struct {
+	Prefix  string
+	Suffix  string
+	Digits  int
+	Compact bool
+	Noun    string
+	One     string
+}
+
+var unitFormats = map[string]UnitFormat{
+	unitsUSD: {
+		Prefix:  "$",
+		Digits:  2,
+		Compact: true,
+		Noun:    "dollars",
+		One:     "dollar",
+	},
+	unitsPersons: {
+		Suffix:  " people",
+		Digits:  1,
+		Compact: true,
+		Noun:    "people",
+		One:     "person",
+	},
+	unitsUSDPerCapita: {
+		Prefix: "$",
+		Suffix: " per person",
+		Noun:   "dollars per person",
+		One:    "dollar per person",
+	},
+}
+
+func (f UnitFormat) Format(v float64) string {
+	if v == 0 {
+		return f.Prefix + "0" + f.Suffix
+	}
+
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+
+	body := localeEnglish.Number(v, f.Digits)
+	if f.Compact {
+		body = localeEnglish.Compact(v, f.Digits)
+	}
+	return sign + f.Prefix + body + f.Suffix
+}
+
+func unitFormat(units string) UnitFormat {
+	if f, ok := unitFormats[units]; ok {
+		return f
+	}
+	return unitFormats[unitsUSD]
+}
+
+func formatScaled(n *int, units string, scale int64) string {
+	if n == nil {
+		return "N/A"
+	}
+	return unitFormat(units).Format(float64(*n) * float64(scale))
+}
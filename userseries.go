@@ -0,0 +1,321 @@
+package nhe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	SourceOfficial = "official"
+	SourceUser     = "user"
+)
+
+const userSortBase = 1000000
+
+type UserSeries struct {
+	Name   string
+	Units  string
+	Scale  int64
+	Points map[int]*int
+}
+
+type UserSeriesInfo struct {
+	Name   string
+	Slug   string
+	Units  string
+	Points int
+}
+
+func parseSeriesPoints(r io.Reader) (map[int]*int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	points := map[int]*int{}
+	for i, row := range records {
+		if len(row) < 2 {
+			return nil, fmt.Errorf("row %d: want year,amount", i+1)
+		}
+
+		year, err := strconv.Atoi(strings.TrimSpace(row[0]))
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("row %d: invalid year %q", i+1, row[0])
+		}
+		if _, dup := points[year]; dup {
+			return nil, fmt.Errorf("row %d: duplicate year %d", i+1, year)
+		}
+
+		val := strings.ReplaceAll(strings.TrimSpace(row[1]), ",", "")
+		if status, _ := classifyCell(val); status == CellNoData {
+			points[year] = nil
+			continue
+		}
+		amount, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid amount %q", i+1, row[1])
+		}
+		points[year] = &amount
+	}
+
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no year,amount rows")
+	}
+	return points, nil
+}
+
+func addUserSeries(ctx context.Context, db *sql.DB, s UserSeries) error {
+	name := strings.TrimSpace(s.Name)
+	if name == "" {
+		return badQuery("series name is required")
+	}
+
+	tx, err := beginWrite(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM categories WHERE name = ?)",
+		name,
+	).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return badQuery("category %q already exists", name)
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO categories
+		(name, parent_id, indent_level, sort_order, is_major_heading,
+		units, scale, source)
+		SELECT ?, NULL, 0, MAX(?, COALESCE(MAX(sort_order), 0) + 1), 0,
+		?, ?, ?
+		FROM categories`,
+		name,
+		userSortBase,
+		s.Units,
+		s.Scale,
+		SourceUser,
+	)
+	if err != nil {
+		return fmt.Errorf("insert series %s: %w", name, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, year := range slices.Sorted(maps.Keys(s.Points)) {
+		amount := s.Points[year]
+		var yearID int
+		err := tx.QueryRowContext(
+			ctx,
+			"SELECT id FROM years WHERE year = ?",
+			year,
+		).Scan(&yearID)
+		if err == sql.ErrNoRows {
+			slog.Warn("skipping year outside the loaded data",
+				"series", name,
+				"year", year,
+			)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO expenditures
+			(category_id, year_id, amount, status)
+			VALUES (?, ?, ?, ?)`,
+			id,
+			yearID,
+			amount,
+			cellStatus(amount, false),
+		)
+		if err != nil {
+			return fmt.Errorf("insert %s %d: %w", name, year, err)
+		}
+	}
+
+	if err := renderSparklines(ctx, tx); err != nil {
+		return fmt.Errorf("render sparklines: %w", err)
+	}
+	return tx.Commit()
+}
+
+func listUserSeries(db *sql.DB) ([]UserSeriesInfo, error) {
+	refs, err := categoryRefs(db)
+	if err != nil {
+		return nil, err
+	}
+	slugs := make(map[int]string, len(refs))
+	for _, ref := range refs {
+		slugs[ref.ID] = ref.Slug
+	}
+
+	rows, err := db.Query(`
+		SELECT c.id, c.name, c.units, COUNT(e.amount)
+		FROM categories c
+		LEFT JOIN expenditures e ON e.category_id = c.id
+		WHERE c.source = ?
+		GROUP BY c.id
+		ORDER BY c.sort_order, c.id
+	`, SourceUser)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []UserSeriesInfo
+	for rows.Next() {
+		var (
+			id   int
+			info UserSeriesInfo
+		)
+		err := rows.Scan(&id, &info.Name, &info.Units, &info.Points)
+		if err != nil {
+			return nil, err
+		}
+		info.Slug = slugs[id]
+		result = append(result, info)
+	}
+	return result, rows.Err()
+}
+
+func removeUserSeries(ctx context.Context, db *sql.DB, name string) error {
+	tx, err := beginWrite(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT id FROM categories WHERE name = ? AND source = ?",
+		name,
+		SourceUser,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return badQuery("no user series named %q", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM expenditures WHERE category_id = ?",
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM categories WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func seriesCommand(app *App) *cli.Command {
+	return &cli.Command{
+		Name:  "series",
+		Usage: "manage user-supplied series shown next to the official data",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "add",
+				Usage:     "add a series from a year,amount CSV",
+				ArgsUsage: "NAME FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "units",
+						Value: unitsUSD,
+						Usage: "units of the amounts",
+					},
+					&cli.Int64Flag{
+						Name:  "scale",
+						Value: 1000000,
+						Usage: "multiplier applied to the amounts",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 2 {
+						return fmt.Errorf("series add needs NAME and FILE")
+					}
+					f, err := os.Open(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+
+					points, err := parseSeriesPoints(f)
+					if err != nil {
+						return fmt.Errorf("parse series: %w", err)
+					}
+					return addUserSeries(c.Context, app.db, UserSeries{
+						Name:   c.Args().Get(0),
+						Units:  c.String("units"),
+						Scale:  c.Int64("scale"),
+						Points: points,
+					})
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "list user series",
+				Action: func(c *cli.Context) error {
+					series, err := listUserSeries(app.db)
+					if err != nil {
+						return err
+					}
+					for _, s := range series {
+						fmt.Printf(
+							"%s\t%s\t%s\t%d\n",
+							s.Slug,
+							s.Name,
+							s.Units,
+							s.Points,
+						)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "delete a user series",
+				ArgsUsage: "NAME",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("series remove needs NAME")
+					}
+					return removeUserSeries(c.Context, app.db, c.Args().First())
+				},
+			},
+		},
+	}
+}
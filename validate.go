@@ -0,0 +1,296 @@
+package nhe
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	nheTable         = "nhe"
+	defaultTolerance = 0.1
+)
+
+//go:embed rules.json
+var defaultRules []byte
+
+type RuleSet struct {
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Table       string   `json:"table"`
+	Total       string   `json:"total"`
+	Parts       []string `json:"parts"`
+	Tolerance   float64  `json:"tolerance"`
+}
+
+type RuleResult struct {
+	Rule     Rule
+	Skipped  string
+	Checked  int
+	Failures []RuleFailure
+}
+
+type RuleFailure struct {
+	Year     int
+	Total    int
+	Sum      int
+	Residual float64
+}
+
+func parseRules(b []byte) (*RuleSet, error) {
+	var rs RuleSet
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return nil, fmt.Errorf("decode rules: %w", err)
+	}
+
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if r.Name == "" || r.Total == "" || len(r.Parts) == 0 {
+			return nil, fmt.Errorf(
+				"rule %d: name, total, and parts are required",
+				i+1,
+			)
+		}
+		if r.Table == "" {
+			r.Table = nheTable
+		}
+		if r.Tolerance == 0 {
+			r.Tolerance = defaultTolerance
+		}
+	}
+	return &rs, nil
+}
+
+func loadRules(path string) (*RuleSet, error) {
+	if path == "" {
+		return parseRules(defaultRules)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules: %w", err)
+	}
+	return parseRules(b)
+}
+
+type ruleCategory struct {
+	id      int
+	name    string
+	heading bool
+}
+
+func ruleCategories(db *sql.DB) ([]ruleCategory, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT c.id, c.name, c.is_major_heading
+		FROM categories c
+		WHERE %s != '%s'
+		ORDER BY c.sort_order, c.id
+	`, capsOf(db).source("c"), SourceUser))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cats []ruleCategory
+	for rows.Next() {
+		var c ruleCategory
+		if err := rows.Scan(&c.id, &c.name, &c.heading); err != nil {
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+func resolveSeries(cats []ruleCategory, path string) (int, error) {
+	var (
+		parts = strings.Split(path, " > ")
+		at    = -1
+	)
+
+	for i, c := range cats {
+		if c.heading && c.name == parts[0] {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return 0, fmt.Errorf("no section %q", parts[0])
+	}
+
+	for _, name := range parts[1:] {
+		next := -1
+		for i := at + 1; i < len(cats) && !cats[i].heading; i++ {
+			if cats[i].name == name {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return 0, fmt.Errorf("no series at %q", path)
+		}
+		at = next
+	}
+
+	return cats[at].id, nil
+}
+
+func seriesValues(db *sql.DB, id int) (map[int]int, error) {
+	rows, err := db.Query(`
+		SELECT y.year, e.amount
+		FROM expenditures e
+		JOIN years y ON y.id = e.year_id
+		WHERE e.category_id = ? AND e.amount IS NOT NULL
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := map[int]int{}
+	for rows.Next() {
+		var year, amount int
+		if err := rows.Scan(&year, &amount); err != nil {
+			return nil, err
+		}
+		values[year] = amount
+	}
+	return values, rows.Err()
+}
+
+func ruleSeries(
+	db *sql.DB,
+	cats []ruleCategory,
+	path string,
+) (map[int]int, error) {
+	id, err := resolveSeries(cats, path)
+	if err != nil {
+		return nil, err
+	}
+	return seriesValues(db, id)
+}
+
+func runRule(
+	db *sql.DB,
+	cats []ruleCategory,
+	r Rule,
+) (RuleResult, error) {
+	result := RuleResult{Rule: r}
+	if r.Table != nheTable {
+		result.Skipped = fmt.Sprintf("table %q is not loaded", r.Table)
+		return result, nil
+	}
+
+	total, err := ruleSeries(db, cats, r.Total)
+	if err != nil {
+		return result, fmt.Errorf("rule %s: %w", r.Name, err)
+	}
+
+	var parts []map[int]int
+	for _, p := range r.Parts {
+		values, err := ruleSeries(db, cats, p)
+		if err != nil {
+			return result, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		parts = append(parts, values)
+	}
+
+	for year, want := range total {
+		sum, complete := 0, true
+		for _, values := range parts {
+			v, ok := values[year]
+			if !ok {
+				complete = false
+				break
+			}
+			sum += v
+		}
+		if !complete || want == 0 {
+			continue
+		}
+
+		result.Checked++
+		residual := math.Abs(float64(want-sum)) / math.Abs(float64(want)) * 100
+		if residual > r.Tolerance {
+			result.Failures = append(result.Failures, RuleFailure{
+				Year:     year,
+				Total:    want,
+				Sum:      sum,
+				Residual: residual,
+			})
+		}
+	}
+
+	slices.SortFunc(result.Failures, func(a, b RuleFailure) int {
+		return a.Year - b.Year
+	})
+	return result, nil
+}
+
+func validateCmd(app *App, c *cli.Context) error {
+	rules, err := loadRules(c.String("rules"))
+	if err != nil {
+		return err
+	}
+
+	cats, err := ruleCategories(app.db)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range rules.Rules {
+		result, err := runRule(app.db, cats, r)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case result.Skipped != "":
+			fmt.Printf("SKIP %s: %s\n", r.Name, result.Skipped)
+			continue
+		case len(result.Failures) == 0:
+			fmt.Printf(
+				"PASS %s (%d years): %s\n",
+				r.Name,
+				result.Checked,
+				r.Description,
+			)
+			continue
+		}
+
+		failed++
+		fmt.Printf(
+			"FAIL %s (%d of %d years): %s\n",
+			r.Name,
+			len(result.Failures),
+			result.Checked,
+			r.Description,
+		)
+		for _, f := range result.Failures {
+			fmt.Printf(
+				"  %d: total %d, parts sum to %d (%.2f%% off)\n",
+				f.Year,
+				f.Total,
+				f.Sum,
+				f.Residual,
+			)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rules failed", failed, len(rules.Rules))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package nhe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRules(t *testing.T) {
+	db, err := openEphemeral()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rules, err := loadRules("")
+	assert.NoError(t, err)
+
+	cats, err := ruleCategories(db)
+	assert.NoError(t, err)
+
+	for _, r := range rules.Rules {
+		result, err := runRule(db, cats, r)
+		assert.NoError(t, err)
+		assert.Empty(t, result.Failures, r.Name)
+		assert.Positive(t, result.Checked, r.Name)
+	}
+
+	result, err := runRule(db, cats, Rule{
+		Name:      "skewed",
+		Table:     nheTable,
+		Total:     "Personal Health Care",
+		Parts:     []string{"Total Hospital Expenditures"},
+		Tolerance: defaultTolerance,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, result.Checked, len(result.Failures))
+
+	result, err = runRule(db, cats, Rule{Name: "other", Table: "table-3"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.Skipped)
+
+	_, err = resolveSeries(cats, "Personal Health Care > Nothing")
+	assert.Error(t, err)
+
+	_, err = parseRules([]byte(`{"rules": [{"name": "empty"}]}`))
+	assert.Error(t, err)
+}
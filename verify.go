@@ -0,0 +1,172 @@
+package nhe
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/urfave/cli/v2"
+)
+
+type Mismatch struct {
+	Category string
+	Year     int
+	Expected *int
+	Actual   *int
+	Problem  string
+}
+
+type dbCell struct {
+	name   string
+	amount *int
+	found  bool
+}
+
+func verifyData(db *sql.DB, data *ParsedData) ([]Mismatch, error) {
+	rows, err := db.Query(`
+		SELECT
+			c.sort_order,
+			c.name,
+			y.year,
+			e.amount
+		FROM expenditures e
+		JOIN categories c ON c.id = e.category_id
+		JOIN years y ON y.id = e.year_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := map[int]map[int]*dbCell{}
+	for rows.Next() {
+		var (
+			sortOrder int
+			year      int
+			cell      = &dbCell{}
+		)
+		err := rows.Scan(&sortOrder, &cell.name, &year, &cell.amount)
+		if err != nil {
+			return nil, err
+		}
+
+		if cells[sortOrder] == nil {
+			cells[sortOrder] = map[int]*dbCell{}
+		}
+		cells[sortOrder][year] = cell
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var mismatches []Mismatch
+	for idx, cat := range data.Categories {
+		byYear := cells[cat.SortOrder]
+		for i, year := range data.Years {
+			expected, ok := data.Expenditures[idx+1][i+1]
+			if !ok {
+				continue
+			}
+
+			cell, ok := byYear[year]
+			if !ok {
+				mismatches = append(mismatches, Mismatch{
+					Category: cat.Name,
+					Year:     year,
+					Expected: expected,
+					Problem:  "missing",
+				})
+				continue
+			}
+			cell.found = true
+
+			if cell.name != cat.Name {
+				mismatches = append(mismatches, Mismatch{
+					Category: cat.Name,
+					Year:     year,
+					Problem:  fmt.Sprintf("name is %q", cell.name),
+				})
+				continue
+			}
+
+			if !sameAmount(expected, cell.amount) {
+				mismatches = append(mismatches, Mismatch{
+					Category: cat.Name,
+					Year:     year,
+					Expected: expected,
+					Actual:   cell.amount,
+					Problem:  "value differs",
+				})
+			}
+		}
+	}
+
+	var extra []Mismatch
+	for _, byYear := range cells {
+		for year, cell := range byYear {
+			if cell.found {
+				continue
+			}
+			extra = append(extra, Mismatch{
+				Category: cell.name,
+				Year:     year,
+				Actual:   cell.amount,
+				Problem:  "not in CSV",
+			})
+		}
+	}
+
+	slices.SortFunc(extra, func(a, b Mismatch) int {
+		return cmp.Or(
+			cmp.Compare(a.Category, b.Category),
+			cmp.Compare(a.Year, b.Year),
+		)
+	})
+
+	return append(mismatches, extra...), nil
+}
+
+func sameAmount(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func formatAmount(n *int) string {
+	if n == nil {
+		return "NULL"
+	}
+	return fmt.Sprintf("%d", *n)
+}
+
+func verifyCmd(app *App, c *cli.Context) error {
+	data, err := parse(c.Context, c.String("csv"), app.parse)
+	if err != nil {
+		return fmt.Errorf("parse CSV: %w", err)
+	}
+
+	mismatches, err := verifyData(app.db, data)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mismatches {
+		fmt.Printf(
+			"%s [%d]: %s (expected %s, got %s)\n",
+			m.Category,
+			m.Year,
+			m.Problem,
+			formatAmount(m.Expected),
+			formatAmount(m.Actual),
+		)
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d mismatched cells", len(mismatches))
+	}
+
+	fmt.Println("database matches CSV")
+	return nil
+}
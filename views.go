@@ -0,0 +1,208 @@
+package nhe
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/urfave/cli/v2"
+)
+
+type TableView struct {
+	Basis YearBasis
+	Years YearStrategy
+}
+
+func (v TableView) key() string {
+	return string(v.Basis) + ":" + v.Years.String()
+}
+
+type SavedView struct {
+	Name  string `json:"name"`
+	Basis string `json:"basis"`
+	Years string `json:"years"`
+}
+
+func (v SavedView) parse() (TableView, error) {
+	basis, err := parseBasis(v.Basis)
+	if err != nil {
+		return TableView{}, err
+	}
+
+	years, err := parseYearStrategy(v.Years)
+	if err != nil {
+		return TableView{}, err
+	}
+
+	return TableView{Basis: basis, Years: years}, nil
+}
+
+func defaultView(app *App) TableView {
+	view := TableView{Basis: CalendarYears, Years: app.years}
+	if view.Years == nil {
+		view.Years, _ = parseYearStrategy("")
+	}
+	return view
+}
+
+func tableView(app *App, q url.Values) (TableView, error) {
+	var (
+		view = defaultView(app)
+		err  error
+	)
+
+	if name := q.Get("view"); name != "" {
+		saved, err := loadSavedView(app.db, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return view, fmt.Errorf("no saved view %q", name)
+		}
+		if err != nil {
+			return view, err
+		}
+
+		view, err = saved.parse()
+		if err != nil {
+			return view, fmt.Errorf("saved view %q: %w", name, err)
+		}
+	}
+
+	if q.Has("basis") {
+		view.Basis, err = parseBasis(q.Get("basis"))
+		if err != nil {
+			return view, err
+		}
+	}
+
+	if q.Has("years") {
+		view.Years, err = parseYearStrategy(q.Get("years"))
+		if err != nil {
+			return view, err
+		}
+	}
+
+	if q.Has("interval") {
+		view.Years, err = parseEveryN(q.Get("interval"))
+		if err != nil {
+			return view, fmt.Errorf("interval: %w", err)
+		}
+	}
+
+	return view, nil
+}
+
+func loadSavedView(db *sql.DB, name string) (SavedView, error) {
+	v := SavedView{Name: name}
+	err := db.QueryRow(
+		"SELECT basis, years FROM saved_views WHERE name = ?",
+		name,
+	).Scan(&v.Basis, &v.Years)
+	return v, err
+}
+
+func listSavedViews(db *sql.DB) ([]SavedView, error) {
+	if !capsOf(db).has("saved_views", "") {
+		return nil, nil
+	}
+
+	rows, err := db.Query(
+		"SELECT name, basis, years FROM saved_views ORDER BY name",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []SavedView
+	for rows.Next() {
+		var v SavedView
+		if err := rows.Scan(&v.Name, &v.Basis, &v.Years); err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+func saveView(db *sql.DB, v SavedView) error {
+	view, err := v.parse()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO saved_views (name, basis, years) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			basis = excluded.basis,
+			years = excluded.years
+	`, v.Name, string(view.Basis), view.Years.String())
+	return err
+}
+
+func viewsCommand(app *App) *cli.Command {
+	return &cli.Command{
+		Name:  "views",
+		Usage: "manage saved table views",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "save",
+				Usage:     "save a named view",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "basis",
+						Value: string(CalendarYears),
+						Usage: "year basis (calendar or fiscal)",
+					},
+					&cli.StringFlag{
+						Name:  "years",
+						Value: defaultYearStrategy,
+						Usage: "display-year strategy",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("views save needs exactly one NAME")
+					}
+					return saveView(app.db, SavedView{
+						Name:  c.Args().First(),
+						Basis: c.String("basis"),
+						Years: c.String("years"),
+					})
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "list saved views",
+				Action: func(c *cli.Context) error {
+					views, err := listSavedViews(app.db)
+					if err != nil {
+						return err
+					}
+					for _, v := range views {
+						fmt.Printf("%s\t%s\t%s\n", v.Name, v.Basis, v.Years)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "delete a saved view",
+				ArgsUsage: "NAME",
+				Action: func(c *cli.Context) error {
+					res, err := app.db.Exec(
+						"DELETE FROM saved_views WHERE name = ?",
+						c.Args().First(),
+					)
+					if err != nil {
+						return err
+					}
+					if n, _ := res.RowsAffected(); n == 0 {
+						return fmt.Errorf("no saved view %q", c.Args().First())
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
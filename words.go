@@ -0,0 +1,107 @@
+package nhe
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type FigureStyle string
+
+const (
+	FiguresDigits FigureStyle = "digits"
+	FiguresWords  FigureStyle = "words"
+)
+
+func parseFigureStyle(s string) (FigureStyle, error) {
+	switch FigureStyle(s) {
+	case "", FiguresDigits:
+		return FiguresDigits, nil
+	case FiguresWords:
+		return FiguresWords, nil
+	}
+	return "", fmt.Errorf("unknown figures %q", s)
+}
+
+var onesWords = []string{
+	"zero", "one", "two", "three", "four",
+	"five", "six", "seven", "eight", "nine",
+	"ten", "eleven", "twelve", "thirteen", "fourteen",
+	"fifteen", "sixteen", "seventeen", "eighteen", "nineteen",
+}
+
+var tensWords = []string{
+	"", "", "twenty", "thirty", "forty",
+	"fifty", "sixty", "seventy", "eighty", "ninety",
+}
+
+var scaleWords = []struct {
+	Value float64
+	Word  string
+}{
+	{1e12, "trillion"},
+	{1e9, "billion"},
+	{1e6, "million"},
+	{1e3, "thousand"},
+}
+
+func spellHundreds(n int) string {
+	var parts []string
+	if n >= 100 {
+		parts = append(parts, onesWords[n/100], "hundred")
+		n %= 100
+		if n == 0 {
+			return strings.Join(parts, " ")
+		}
+	}
+	switch {
+	case n < 20:
+		parts = append(parts, onesWords[n])
+	case n%10 == 0:
+		parts = append(parts, tensWords[n/10])
+	default:
+		parts = append(parts, tensWords[n/10]+"-"+onesWords[n%10])
+	}
+	return strings.Join(parts, " ")
+}
+
+func leadingWords(v float64) string {
+	rounded := math.Round(v*10) / 10
+	switch {
+	case rounded != math.Trunc(rounded):
+		return localeEnglish.Number(rounded, 1)
+	case rounded < 10:
+		return spellHundreds(int(rounded))
+	}
+	return localeEnglish.Number(rounded, 0)
+}
+
+func numberWords(v float64) string {
+	if v < 0 {
+		return "minus " + numberWords(-v)
+	}
+	for _, s := range scaleWords {
+		if math.Round(v/s.Value*10)/10 >= 1 {
+			return leadingWords(v/s.Value) + " " + s.Word
+		}
+	}
+	return spellHundreds(int(math.Round(v)))
+}
+
+func (f UnitFormat) Words(v float64) string {
+	words := numberWords(v)
+	if f.Noun == "" {
+		return words
+	}
+	if words == "one" {
+		return words + " " + f.One
+	}
+	return words + " " + f.Noun
+}
+
+func formatFigure(style FigureStyle, n *int, units string, scale int64) string {
+	if n == nil || style != FiguresWords {
+		return formatScaled(n, units, scale)
+	}
+	return unitFormat(units).Words(float64(*n) * float64(scale))
+}
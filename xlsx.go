@@ -0,0 +1,298 @@
+package nhe
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const xlsxContentType = "application/" +
+	"vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDollars
+	xlsxStyleCount
+)
+
+type xlsxCell struct {
+	Text   string
+	Number *float64
+	Style  int
+}
+
+type xlsxSheet struct {
+	Name   string
+	Widths []float64
+	Rows   [][]xlsxCell
+}
+
+func xlsxText(s string) xlsxCell {
+	return xlsxCell{Text: s}
+}
+
+func xlsxAmount(n *int, units string, scale int64) xlsxCell {
+	if n == nil {
+		return xlsxCell{}
+	}
+
+	v := float64(*n) * float64(scale)
+	if units == unitsPersons {
+		return xlsxCell{Number: &v, Style: xlsxStyleCount}
+	}
+	return xlsxCell{Number: &v, Style: xlsxStyleDollars}
+}
+
+func xlsxHeader(cols ...string) []xlsxCell {
+	row := make([]xlsxCell, len(cols))
+	for i, c := range cols {
+		row[i] = xlsxCell{Text: c, Style: xlsxStyleHeader}
+	}
+	return row
+}
+
+func xlsxColumn(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+//go:embed templates/xlsx/*
+var xlsxTemplateFS embed.FS
+
+var xlsxTemplates = template.Must(
+	template.New("").Funcs(template.FuncMap{
+		"xml": xmlEscape,
+		"inc": func(i int) int { return i + 1 },
+		"ref": func(c, r int) string {
+			return xlsxColumn(c) + strconv.Itoa(r+1)
+		},
+		"number": func(v *float64) string {
+			return strconv.FormatFloat(*v, 'f', -1, 64)
+		},
+	}).ParseFS(xlsxTemplateFS, "templates/xlsx/*"),
+)
+
+func writeXLSXPart(
+	zw *zip.Writer,
+	name string,
+	part string,
+	data any,
+) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := xlsxTemplates.ExecuteTemplate(f, part, data); err != nil {
+		return fmt.Errorf("render %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	zw := zip.NewWriter(w)
+
+	parts := []struct {
+		name string
+		part string
+		data any
+	}{
+		{"[Content_Types].xml", "content_types.xml", sheets},
+		{"_rels/.rels", "rels.xml", nil},
+		{"xl/workbook.xml", "workbook.xml", sheets},
+		{"xl/_rels/workbook.xml.rels", "workbook.xml.rels", sheets},
+		{"xl/styles.xml", "styles.xml", nil},
+	}
+	for _, p := range parts {
+		if err := writeXLSXPart(zw, p.name, p.part, p.data); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range sheets {
+		name := fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		if err := writeXLSXPart(zw, name, "sheet.xml", sheet); err != nil {
+			return fmt.Errorf("write sheet %s: %w", sheet.Name, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+func summarySheet(data *TableData) xlsxSheet {
+	sheet := xlsxSheet{Name: "Summary", Widths: []float64{60}}
+
+	header := xlsxHeader("Category")
+	for _, year := range data.Years {
+		header = append(header, xlsxCell{
+			Text:  strconv.Itoa(year),
+			Style: xlsxStyleHeader,
+		})
+		sheet.Widths = append(sheet.Widths, 18)
+	}
+	sheet.Rows = append(sheet.Rows, header)
+
+	for _, cat := range data.Categories {
+		row := []xlsxCell{xlsxText(cat.Name)}
+		for _, v := range cat.Values {
+			row = append(row, xlsxAmount(v, cat.Units, cat.Scale))
+		}
+		sheet.Rows = append(sheet.Rows, row)
+	}
+	return sheet
+}
+
+func notesSheet(notes []TableNote) xlsxSheet {
+	sheet := xlsxSheet{
+		Name:   "Notes",
+		Widths: []float64{6, 60, 8, 80},
+		Rows:   [][]xlsxCell{xlsxHeader("#", "Category", "Year", "Note")},
+	}
+	for _, n := range notes {
+		number, year := float64(n.Number), float64(n.Year)
+		sheet.Rows = append(sheet.Rows, []xlsxCell{
+			{Number: &number},
+			xlsxText(n.Name),
+			{Number: &year},
+			xlsxText(n.Note),
+		})
+	}
+	return sheet
+}
+
+func hierarchySheet(
+	ctx context.Context,
+	db *sql.DB,
+	opts QueryOptions,
+) (xlsxSheet, error) {
+	sheet := xlsxSheet{
+		Name:   "Hierarchy",
+		Widths: []float64{60, 40, 8, 16},
+	}
+
+	f, err := opts.resolve(db)
+	if err != nil {
+		return sheet, err
+	}
+
+	all, err := queryYears(db)
+	if err != nil {
+		return sheet, err
+	}
+	years := slices.DeleteFunc(all, func(year int) bool {
+		return !f.wantsYear(year)
+	})
+
+	header := xlsxHeader("Category", "Parent", "Level", "Units")
+	column := map[int]int{}
+	for i, year := range years {
+		header = append(header, xlsxCell{
+			Text:  strconv.Itoa(year),
+			Style: xlsxStyleHeader,
+		})
+		sheet.Widths = append(sheet.Widths, 18)
+		column[year] = i
+	}
+	sheet.Rows = append(sheet.Rows, header)
+
+	where, args := f.categoryWhere()
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			c.id,
+			c.name,
+			COALESCE(p.name, ''),
+			c.indent_level,
+			`+f.caps.units("c")+`,
+			`+f.caps.scale("c")+`,
+			y.year,
+			e.amount
+		FROM categories c
+		LEFT JOIN categories p ON p.id = c.parent_id
+		LEFT JOIN expenditures e ON e.category_id = c.id
+		LEFT JOIN years y ON y.id = e.year_id
+		WHERE `+where+`
+		ORDER BY `+f.orderBy(), args...)
+	if err != nil {
+		return sheet, err
+	}
+	defer rows.Close()
+
+	lastID := -1
+	for rows.Next() {
+		var (
+			id     int
+			name   string
+			parent string
+			level  int
+			units  string
+			scale  int64
+			year   *int
+			amount *int
+		)
+		err := rows.Scan(
+			&id,
+			&name,
+			&parent,
+			&level,
+			&units,
+			&scale,
+			&year,
+			&amount,
+		)
+		if err != nil {
+			return sheet, err
+		}
+
+		if id != lastID {
+			lvl := float64(level)
+			row := make([]xlsxCell, 4+len(years))
+			row[0] = xlsxText(name)
+			row[1] = xlsxText(parent)
+			row[2] = xlsxCell{Number: &lvl}
+			row[3] = xlsxText(units)
+			sheet.Rows = append(sheet.Rows, row)
+			lastID = id
+		}
+
+		if year != nil && f.wantsYear(*year) {
+			row := sheet.Rows[len(sheet.Rows)-1]
+			row[4+column[*year]] = xlsxAmount(amount, units, scale)
+		}
+	}
+	return sheet, rows.Err()
+}
+
+func writeNHEXLSX(
+	ctx context.Context,
+	w io.Writer,
+	db *sql.DB,
+	data *TableData,
+	opts QueryOptions,
+) error {
+	hierarchy, err := hierarchySheet(ctx, db, opts)
+	if err != nil {
+		return fmt.Errorf("build hierarchy sheet: %w", err)
+	}
+	sheets := []xlsxSheet{summarySheet(data), hierarchy}
+	if len(data.Notes) > 0 {
+		sheets = append(sheets, notesSheet(data.Notes))
+	}
+	return writeXLSX(w, sheets)
+}